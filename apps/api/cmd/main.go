@@ -4,8 +4,10 @@ import (
 	"crypto-app-api/config"
 	"crypto-app-api/database"
 	"crypto-app-api/routes"
+	"crypto-app-api/services"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -55,6 +57,30 @@ func main() {
 	// Setup routes
 	routes.SetupRoutes(app)
 
+	// Deliver published events to the notification inbox, webhooks and copy
+	// traders, and step bots, refresh leaderboards and check margin on price
+	// updates
+	services.SubscribeNotifications()
+	services.SubscribeWebhooks()
+	services.SubscribeCopyTrading()
+	services.SubscribeBots()
+	services.SubscribeCompetitions()
+	services.SubscribeMargin()
+
+	// Start background jobs
+	services.StartJobs(
+		services.Job{Name: "settle-transfers", Interval: 10 * time.Second, Run: services.SettleDueTransfers},
+		services.Job{Name: "recurring-orders", Interval: 30 * time.Second, Run: services.ExecuteDueRecurringOrders},
+		services.Job{Name: "auto-rebalance", Interval: time.Minute, Run: services.RunScheduledRebalances},
+		services.Job{Name: "webhook-retries", Interval: 15 * time.Second, Run: services.RetryWebhookDeliveries},
+		services.Job{Name: "portfolio-snapshots", Interval: 5 * time.Minute, Run: services.RecordPortfolioSnapshots},
+		services.Job{Name: "backtests", Interval: 5 * time.Second, Run: services.RunPendingBacktests},
+		services.Job{Name: "bots", Interval: time.Minute, Run: services.RunBots},
+		services.Job{Name: "competitions", Interval: time.Minute, Run: services.FinalizeCompetitions},
+		services.Job{Name: "margin", Interval: time.Minute, Run: services.RunMarginChecks},
+		services.Job{Name: "funding", Interval: time.Minute, Run: services.RunFunding},
+	)
+
 	// Start server
 	port := os.Getenv("PORT")
 	if port == "" {
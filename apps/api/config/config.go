@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +14,18 @@ type Config struct {
 	Port        string
 	Host        string
 	Environment string
+
+	// Simulated confirmation delays for deposits and withdrawals
+	DepositDelay    time.Duration
+	WithdrawalDelay time.Duration
+
+	// Outgoing mail for alert notifications. Email is only logged when
+	// SMTPHost is empty.
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 var AppConfig Config
@@ -30,6 +43,15 @@ func LoadConfig() {
 		Port:        getEnv("PORT", "8080"),
 		Host:        getEnv("HOST", "localhost"),
 		Environment: getEnv("GO_ENV", "development"),
+
+		DepositDelay:    getEnvDuration("DEPOSIT_CONFIRMATION_DELAY", 30*time.Second),
+		WithdrawalDelay: getEnvDuration("WITHDRAWAL_CONFIRMATION_DELAY", 60*time.Second),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "alerts@crypto-app.local"),
 	}
 
 	log.Printf("Configuration loaded: Environment=%s, Port=%s", AppConfig.Environment, AppConfig.Port)
@@ -41,3 +63,16 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
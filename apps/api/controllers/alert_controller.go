@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetAlertRules(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if coinID := c.Query("coin_id"); coinID != "" {
+		query = query.Where("coin_id = ?", coinID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var rules []models.AlertRule
+	if err := query.Preload("Coin").Order("created_at desc").Find(&rules).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch alert rules",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    rules,
+	})
+}
+
+func GetAlertRule(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid alert rule ID",
+		})
+	}
+
+	var rule models.AlertRule
+	if err := database.DB.Preload("Coin").Where("id = ? AND user_id = ?", id, userID).First(&rule).Error; err != nil {
+		return serviceError(c, services.ErrAlertRuleNotFound, "")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    rule,
+	})
+}
+
+func CreateAlertRule(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.AlertRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	rule, err := services.CreateAlertRule(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create alert rule")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Alert rule created successfully",
+		Data:    rule,
+	})
+}
+
+func UpdateAlertRule(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid alert rule ID",
+		})
+	}
+
+	var req models.AlertRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	rule, err := services.UpdateAlertRule(userID, uint(id), req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update alert rule")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Alert rule updated successfully",
+		Data:    rule,
+	})
+}
+
+func DeleteAlertRule(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid alert rule ID",
+		})
+	}
+
+	result := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.AlertRule{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to delete alert rule",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return serviceError(c, services.ErrAlertRuleNotFound, "")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Alert rule deleted successfully",
+	})
+}
@@ -3,11 +3,13 @@ package controllers
 import (
 	"crypto-app-api/database"
 	"crypto-app-api/models"
+	"crypto-app-api/services"
 	"crypto-app-api/utils"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func Register(c *fiber.Ctx) error {
@@ -52,15 +54,21 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Create user
+	// Create user with a funded default portfolio
 	user := models.User{
 		Username: req.Username,
 		Email:    strings.ToLower(req.Email),
 		Password: string(hashedPassword),
-		Balance:  10000.0, // Starting balance
+		Balance:  models.DefaultStartingBalance,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		_, err := services.CreateDefaultPortfolio(tx, user.ID, user.Balance)
+		return err
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
 			Success: false,
 			Error:   "Failed to create user",
@@ -128,6 +136,7 @@ func Login(c *fiber.Ctx) error {
 			Error:   "Failed to generate token",
 		})
 	}
+	services.LoadDefaultBalance(&user)
 
 	return c.JSON(models.ApiResponse{
 		Success: true,
@@ -149,6 +158,7 @@ func GetProfile(c *fiber.Ctx) error {
 			Error:   "User not found",
 		})
 	}
+	services.LoadDefaultBalance(&user)
 
 	return c.JSON(models.ApiResponse{
 		Success: true,
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/strategies"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetBacktests lists the user's latest backtests without their results,
+// along with the available strategies.
+func GetBacktests(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	backtests, err := services.ListBacktests(userID, 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch backtests",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"backtests":  backtests,
+			"strategies": strategies.Names(),
+		},
+	})
+}
+
+// CreateBacktest queues a backtest. It runs in the background; poll
+// GetBacktest until its status is completed or failed.
+func CreateBacktest(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.BacktestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	backtest, err := services.CreateBacktest(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create backtest")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Backtest queued",
+		Data:    backtest,
+	})
+}
+
+func GetBacktest(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid backtest ID",
+		})
+	}
+
+	backtest, err := services.GetBacktest(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch backtest")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    backtest,
+	})
+}
+
+func DeleteBacktest(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid backtest ID",
+		})
+	}
+
+	if err := services.DeleteBacktest(userID, uint(id)); err != nil {
+		return serviceError(c, err, "Failed to delete backtest")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Backtest deleted successfully",
+	})
+}
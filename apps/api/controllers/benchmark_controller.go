@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetBenchmarks lists the built-in benchmarks and the user's baskets.
+func GetBenchmarks(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var baskets []models.Benchmark
+	if err := database.DB.Preload("Components.Coin").Where("user_id = ?", userID).Order("created_at asc").Find(&baskets).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch benchmarks",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"built_in": services.BuiltInBenchmarks,
+			"baskets":  baskets,
+		},
+	})
+}
+
+func CreateBenchmark(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.BenchmarkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	benchmark, err := services.CreateBenchmark(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create benchmark")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Benchmark created successfully",
+		Data:    benchmark,
+	})
+}
+
+func UpdateBenchmark(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid benchmark ID",
+		})
+	}
+
+	var req models.BenchmarkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	benchmark, err := services.UpdateBenchmark(userID, uint(id), req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update benchmark")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Benchmark updated successfully",
+		Data:    benchmark,
+	})
+}
+
+func DeleteBenchmark(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid benchmark ID",
+		})
+	}
+
+	if err := services.DeleteBenchmark(userID, uint(id)); err != nil {
+		return serviceError(c, err, "Failed to delete benchmark")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Benchmark deleted successfully",
+	})
+}
+
+// CompareToBenchmark returns the user's return series over ?range= next to
+// a benchmark's: ?benchmark=coin (with ?symbol=, BTC by default),
+// market_cap, equal_weight or basket (with ?basket_id=).
+func CompareToBenchmark(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	basketID, err := utils.ParseInt(c, "basket_id", 0)
+	if err != nil || basketID < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid basket ID",
+		})
+	}
+	riskFree, err := utils.ParseFloat(c, "risk_free", 0)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	spec := services.BenchmarkSpec{
+		Type:     c.Query("benchmark", models.BenchmarkCoin),
+		Symbol:   c.Query("symbol"),
+		BasketID: uint(basketID),
+	}
+
+	comparison, err := services.CompareToBenchmark(userID, c.Query("range", "30d"), spec, riskFree)
+	if err != nil {
+		return serviceError(c, err, "Failed to compare against benchmark")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    comparison,
+	})
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/strategies"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetBots lists the user's bots with their current status, along with the
+// available strategies.
+func GetBots(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	bots, err := services.ListBots(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch bots",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"bots":       bots,
+			"strategies": strategies.Names(),
+		},
+	})
+}
+
+// CreateBot sets up a bot in the requested portfolio. Bots are created
+// stopped; start them with StartBot.
+func CreateBot(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.BotRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := services.ActivePortfolio(userID, req.PortfolioID)
+	if err != nil {
+		return serviceError(c, err, "Failed to create bot")
+	}
+
+	bot, err := services.CreateBot(*portfolio, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create bot")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Bot created successfully",
+		Data:    bot,
+	})
+}
+
+func GetBot(c *fiber.Ctx) error {
+	return botAction(c, services.GetBot, "Failed to fetch bot", "")
+}
+
+func StartBot(c *fiber.Ctx) error {
+	return botAction(c, services.StartBot, "Failed to start bot", "Bot started")
+}
+
+func StopBot(c *fiber.Ctx) error {
+	return botAction(c, services.StopBot, "Failed to stop bot", "Bot stopped")
+}
+
+// botAction runs a service call on the bot in the :id param and responds
+// with the bot's status.
+func botAction(c *fiber.Ctx, action func(userID, id uint) (*services.BotStatus, error), fallback, message string) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid bot ID",
+		})
+	}
+
+	bot, err := action(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, fallback)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    bot,
+	})
+}
+
+// GetBotLogs lists the bot's log entries newest first, optionally narrowed
+// to one ?level=. Paged with ?page= or ?cursor= like GetTrades.
+func GetBotLogs(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid bot ID",
+		})
+	}
+
+	bot, err := services.ResolveBot(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch bot logs")
+	}
+
+	pagination := utils.ParsePagination(c, 50, 200)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	scope := database.DB.Model(&models.BotLog{}).Where("bot_id = ?", bot.ID)
+	if level := c.Query("level"); level != "" {
+		scope = scope.Where("level = ?", level)
+	}
+
+	var total int64
+	if err := scope.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch bot logs",
+		})
+	}
+
+	var logs []models.BotLog
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}), pagination, cursor, "created_at", "id", true).
+		Find(&logs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch bot logs",
+		})
+	}
+
+	logs, more := utils.TrimPage(logs, pagination)
+	var next string
+	if more {
+		last := logs[len(logs)-1]
+		next = utils.NewCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"logs":       logs,
+			"pagination": utils.KeysetMeta(pagination, cursor, total, next),
+		},
+	})
+}
+
+func DeleteBot(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid bot ID",
+		})
+	}
+
+	if err := services.DeleteBot(userID, uint(id)); err != nil {
+		return serviceError(c, err, "Failed to delete bot")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Bot deleted successfully",
+	})
+}
@@ -3,44 +3,90 @@ package controllers
 import (
 	"crypto-app-api/database"
 	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"log"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+// coinSortFields maps the accepted ?sort= values to coin columns.
+var coinSortFields = map[string]string{
+	"market_cap":                  "market_cap",
+	"price":                       "current_price",
+	"current_price":               "current_price",
+	"volume":                      "volume_24h",
+	"volume_24h":                  "volume_24h",
+	"change":                      "price_change_percentage_24h",
+	"price_change_percentage_24h": "price_change_percentage_24h",
+	"symbol":                      "symbol",
+	"name":                        "name",
+}
+
+// GetCoins lists coins with optional search (?q= prefix match on symbol and
+// name), category filter (?category=a,b), range filters (price_min/max,
+// market_cap_min/max, change_min/max) and whitelisted sorting.
 func GetCoins(c *fiber.Ctx) error {
-	// Parse query parameters
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
-	sort := c.Query("sort", "market_cap")
-	order := c.Query("order", "desc")
+	pagination := utils.ParsePagination(c, 20, 100)
 
-	// Validate pagination
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 || limit > 100 {
-		limit = 20
+	orderBy, err := utils.ParseSort(c, coinSortFields, "market_cap", "desc")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
 	}
 
-	// Calculate offset
-	offset := (page - 1) * limit
-
 	// Build query
 	query := database.DB.Model(&models.Coin{})
 
-	// Apply sorting
-	orderBy := sort + " " + order
-	query = query.Order(orderBy)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		prefix := utils.EscapeLike(q) + "%"
+		if tsQuery := utils.PrefixTSQuery(q); tsQuery != "" {
+			query = query.Where("symbol ILIKE ? OR name ILIKE ? OR to_tsvector('simple', name) @@ to_tsquery('simple', ?)",
+				prefix, prefix, tsQuery)
+		} else {
+			query = query.Where("symbol ILIKE ? OR name ILIKE ?", prefix, prefix)
+		}
+	}
+
+	if categories := utils.ParseList(c, "category"); len(categories) > 0 {
+		query = query.Where("category IN ?", categories)
+	}
+
+	for param, column := range map[string]string{
+		"price":      "current_price",
+		"market_cap": "market_cap",
+		"change":     "price_change_percentage_24h",
+	} {
+		min, max, err := utils.ParseFloatRange(c, param)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		if min != nil {
+			query = query.Where(column+" >= ?", *min)
+		}
+		if max != nil {
+			query = query.Where(column+" <= ?", *max)
+		}
+	}
 
 	// Get total count
 	var total int64
 	query.Count(&total)
 
-	// Get coins with pagination
+	// Get coins with pagination, breaking ties by ID so pages are stable
 	var coins []models.Coin
-	if err := query.Offset(offset).Limit(limit).Find(&coins).Error; err != nil {
+	if err := query.Order(orderBy).Order("id").
+		Offset(pagination.Offset()).
+		Limit(pagination.Limit).
+		Find(&coins).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
 			Success: false,
 			Error:   "Failed to fetch coins",
@@ -50,17 +96,58 @@ func GetCoins(c *fiber.Ctx) error {
 	return c.JSON(models.ApiResponse{
 		Success: true,
 		Data: fiber.Map{
-			"coins": coins,
-			"pagination": fiber.Map{
-				"page":  page,
-				"limit": limit,
-				"total": total,
-				"pages": (total + int64(limit) - 1) / int64(limit),
-			},
+			"coins":      coins,
+			"pagination": pagination.Meta(total),
 		},
 	})
 }
 
+// filterCoins narrows a list of rows referencing coins through column to the
+// coins given by ?coin_id= and ?symbol=, both comma-separated.
+func filterCoins(c *fiber.Ctx, query *gorm.DB, column string) (*gorm.DB, error) {
+	coinIDs, err := utils.ParseIDList(c, "coin_id")
+	if err != nil {
+		return nil, err
+	}
+	if len(coinIDs) > 0 {
+		query = query.Where(column+" IN ?", coinIDs)
+	}
+
+	symbols := utils.ParseList(c, "symbol")
+	for i := range symbols {
+		symbols[i] = strings.ToUpper(symbols[i])
+	}
+	if len(symbols) > 0 {
+		query = query.Where(column+" IN (SELECT id FROM coins WHERE symbol IN ?)", symbols)
+	}
+	return query, nil
+}
+
+// GetCoinCategories lists the categories coins can be filtered by, with the
+// number of coins in each.
+func GetCoinCategories(c *fiber.Ctx) error {
+	var categories []struct {
+		Category string `json:"category"`
+		Count    int64  `json:"count"`
+	}
+	if err := database.DB.Model(&models.Coin{}).
+		Select("category, COUNT(*) AS count").
+		Where("category IS NOT NULL AND category <> ''").
+		Group("category").
+		Order("category").
+		Scan(&categories).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch categories",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    categories,
+	})
+}
+
 func GetCoin(c *fiber.Ctx) error {
 	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
@@ -110,23 +197,16 @@ func UpdateCoinPrices(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update each coin
-	for _, update := range updates {
-		if err := database.DB.Model(&models.Coin{}).
-			Where("symbol = ?", update.Symbol).
-			Updates(map[string]interface{}{
-				"current_price":               update.CurrentPrice,
-				"market_cap":                  update.MarketCap,
-				"volume_24h":                  update.Volume24h,
-				"price_change_24h":            update.PriceChange24h,
-				"price_change_percentage_24h": update.PriceChangePercentage24h,
-				"last_updated":                time.Now(),
-			}).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-				Success: false,
-				Error:   "Failed to update coin prices",
-			})
-		}
+	coins, err := services.UpdateCoinPrices(updates)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to update coin prices",
+		})
+	}
+
+	if err := services.EvaluateAlerts(coins); err != nil {
+		log.Printf("Failed to evaluate price alerts: %v", err)
 	}
 
 	return c.JSON(models.ApiResponse{
@@ -145,8 +225,16 @@ func GetMarketData(c *fiber.Ctx) error {
 	database.DB.Model(&models.Coin{}).Select("SUM(volume_24h)").Scan(&totalVolume)
 	database.DB.Model(&models.Coin{}).Count(&coinCount)
 
-	// Calculate 24h market cap change (simplified)
-	marketCapChange := 2.5 // This should be calculated based on historical data
+	// Market cap 24h ago, backed out of each coin's reported 24h price change
+	var previousMarketCap float64
+	database.DB.Model(&models.Coin{}).
+		Select("COALESCE(SUM(market_cap / NULLIF(1 + price_change_percentage_24h / 100, 0)), 0)").
+		Scan(&previousMarketCap)
+
+	marketCapChange := 0.0
+	if previousMarketCap > 0 {
+		marketCapChange = (float64(totalMarketCap) - previousMarketCap) / previousMarketCap * 100
+	}
 
 	return c.JSON(models.ApiResponse{
 		Success: true,
@@ -158,3 +246,83 @@ func GetMarketData(c *fiber.Ctx) error {
 		},
 	})
 }
+
+// GetMarketMovers returns top gainers and losers over ?window= (1h, 24h or
+// 7d), plus the highest volume, most watched and most traded coins. ?limit=
+// above services.MaxMovers is clamped to it.
+func GetMarketMovers(c *fiber.Ctx) error {
+	limit, err := utils.ParseInt(c, "limit", 10)
+	if err == nil && limit < 1 {
+		err = &utils.QueryError{Param: "limit"}
+	}
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+	if limit > services.MaxMovers {
+		limit = services.MaxMovers
+	}
+
+	movers, err := services.GetMovers(c.Query("window", "24h"), limit)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch market movers")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    movers,
+	})
+}
+
+// GetCoinIndicators computes a technical indicator over the coin's price
+// history: ?name= (sma, ema, rsi, macd, bollinger or vwap), ?interval= candle
+// size, ?period= (or fast/slow/signal for MACD, stddev for Bollinger) and
+// ?limit= points.
+func GetCoinIndicators(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid coin ID",
+		})
+	}
+
+	query := services.IndicatorQuery{
+		Name:     strings.ToLower(c.Query("name")),
+		Interval: c.Query("interval", "1h"),
+	}
+	for param, target := range map[string]*int{
+		"period": &query.Period,
+		"fast":   &query.Fast,
+		"slow":   &query.Slow,
+		"signal": &query.Signal,
+		"limit":  &query.Limit,
+	} {
+		if *target, err = utils.ParseInt(c, param, 0); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+	}
+	if query.StdDev, err = utils.ParseFloat(c, "stddev", 0); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	points, err := services.ComputeIndicator(uint(id), query)
+	if err != nil {
+		return serviceError(c, err, "Failed to compute indicator")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"coin_id":  id,
+			"name":     query.Name,
+			"interval": query.Interval,
+			"points":   points,
+		},
+	})
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCompetitions lists competitions, optionally narrowed by ?status= to
+// upcoming, active, closing or finished.
+func GetCompetitions(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	competitions, err := services.ListCompetitions(userID, c.Query("status"))
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch competitions")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    competitions,
+	})
+}
+
+func CreateCompetition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.CompetitionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	competition, err := services.CreateCompetition(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create competition")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Competition created successfully",
+		Data:    competition,
+	})
+}
+
+func GetCompetition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid competition ID",
+		})
+	}
+
+	competition, err := services.GetCompetition(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch competition")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    competition,
+	})
+}
+
+// JoinCompetition enrolls the user. The response's entry names the contest
+// portfolio to trade in.
+func JoinCompetition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid competition ID",
+		})
+	}
+
+	competition, err := services.JoinCompetition(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to join competition")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Joined competition",
+		Data:    competition,
+	})
+}
+
+// GetLeaderboard returns the live leaderboard of a competition, or its
+// final standings once it has closed.
+func GetLeaderboard(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid competition ID",
+		})
+	}
+
+	leaderboard, err := services.GetLeaderboard(uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch leaderboard")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    leaderboard,
+	})
+}
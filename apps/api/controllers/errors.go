@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"crypto-app-api/indicators"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/strategies"
+	"crypto-app-api/utils"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Service errors whose message is safe to return to the client as-is.
+var (
+	notFoundErrors = []error{
+		services.ErrCoinNotFound,
+		services.ErrTransferNotFound,
+		services.ErrPortfolioNotFound,
+		services.ErrRecurringOrderNotFound,
+		services.ErrAlertRuleNotFound,
+		services.ErrNotificationNotFound,
+		services.ErrWebhookNotFound,
+		services.ErrWebhookDeliveryNotFound,
+		services.ErrWatchlistNotFound,
+		services.ErrWatchlistEntryNotFound,
+		services.ErrBenchmarkNotFound,
+		services.ErrBacktestNotFound,
+		services.ErrBotNotFound,
+		services.ErrCompetitionNotFound,
+		services.ErrTraderNotFound,
+		services.ErrCopyTradingNotFound,
+		services.ErrMarginAccountNotFound,
+		services.ErrMarginPositionNotFound,
+		services.ErrFuturesPositionNotFound,
+	}
+	badRequestErrors = []error{
+		services.ErrInsufficientBalance,
+		services.ErrUnsupportedCurrency,
+		services.ErrCoinNotOwned,
+		services.ErrInsufficientQuantity,
+		services.ErrInvalidTransfer,
+		services.ErrTransferNotPending,
+		services.ErrPortfolioArchived,
+		services.ErrDefaultPortfolioArchive,
+		services.ErrInvalidPortfolioName,
+		services.ErrInvalidPortfolioTransfer,
+		services.ErrInvalidTradeType,
+		services.ErrInvalidTradeAmount,
+		services.ErrInvalidSchedule,
+		services.ErrRecurringOrderState,
+		services.ErrInvalidTargets,
+		services.ErrInvalidDriftThreshold,
+		services.ErrEmptyPortfolio,
+		services.ErrInvalidAlertCondition,
+		services.ErrInvalidAlertThreshold,
+		services.ErrInvalidAlertWindow,
+		services.ErrInvalidAlertMode,
+		services.ErrInvalidAlertCooldown,
+		services.ErrInvalidAlertChannel,
+		services.ErrInvalidWebhookURL,
+		services.ErrUnknownNotificationType,
+		services.ErrInvalidWebhookEndpoint,
+		services.ErrWebhookAddressBlocked,
+		services.ErrInvalidWebhookEvent,
+		services.ErrTooManyWebhooks,
+		services.ErrInvalidWatchlistName,
+		services.ErrDefaultWatchlistDelete,
+		services.ErrInvalidWatchlistOrder,
+		services.ErrInvalidTargetPrice,
+		services.ErrInvalidMoversWindow,
+		services.ErrUnknownIndicator,
+		services.ErrInvalidInterval,
+		indicators.ErrInvalidPeriod,
+		indicators.ErrInsufficientData,
+		services.ErrInvalidPerformanceRange,
+		services.ErrInvalidBenchmark,
+		services.ErrInvalidBenchmarkName,
+		services.ErrInvalidBenchmarkWeights,
+		services.ErrTooManyBenchmarks,
+		services.ErrInvalidCorrelationWindow,
+		services.ErrInvalidLotMethod,
+		services.ErrInvalidLotSelection,
+		services.ErrInvalidTaxYear,
+		services.ErrInvalidExportFormat,
+		services.ErrUnknownImportProfile,
+		services.ErrInvalidImportFile,
+		services.ErrTooManyImportRows,
+		strategies.ErrUnknownStrategy,
+		strategies.ErrInvalidParams,
+		services.ErrInvalidBacktestRange,
+		services.ErrInvalidBacktestCosts,
+		services.ErrTooManyBacktests,
+		services.ErrInvalidBotName,
+		services.ErrInvalidBotLimits,
+		services.ErrTooManyBots,
+		services.ErrInvalidCompetitionName,
+		services.ErrInvalidCompetitionSchedule,
+		services.ErrInvalidCompetitionBalance,
+		services.ErrInvalidCompetitionMetric,
+		services.ErrInvalidCompetitionStatus,
+		services.ErrCompetitionEnded,
+		services.ErrCompetitionNotRunning,
+		services.ErrCoinNotAllowed,
+		services.ErrContestPortfolio,
+		services.ErrInvalidBio,
+		services.ErrInvalidLeader,
+		services.ErrCopyingNotAllowed,
+		services.ErrInvalidCopyLimits,
+		services.ErrInvalidLeverage,
+		services.ErrInvalidMarginAmount,
+		services.ErrInsufficientMargin,
+		services.ErrInvalidMarginSide,
+		services.ErrMarginPositionClosed,
+		services.ErrFuturesPositionClosed,
+		services.ErrInvalidMarginMode,
+	}
+	conflictErrors = []error{
+		services.ErrDuplicateWatchlistCoin,
+		services.ErrBotRunning,
+		services.ErrAlreadyEntered,
+		services.ErrDuplicateCopyTrading,
+	}
+)
+
+// serviceError maps an error returned by the services package, or a
+// utils.QueryError, to a response, falling back to a 500 with the given
+// message for unexpected errors.
+func serviceError(c *fiber.Ctx, err error, fallback string) error {
+	var queryErr *utils.QueryError
+	if errors.As(err, &queryErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	for _, target := range notFoundErrors {
+		if errors.Is(err, target) {
+			return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	for _, target := range badRequestErrors {
+		if errors.Is(err, target) {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	for _, target := range conflictErrors {
+		if errors.Is(err, target) {
+			return c.Status(fiber.StatusConflict).JSON(models.ApiResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+		Success: false,
+		Error:   fallback,
+	})
+}
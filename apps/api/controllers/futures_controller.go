@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetFuturesPositions lists the futures positions of the ?portfolio_id=
+// portfolio newest first, optionally narrowed by ?status=, ?side=,
+// ?margin_mode= and ?coin_id=. Paged with ?page= or ?cursor= like
+// GetTrades.
+func GetFuturesPositions(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	scope, err := services.FuturesPositionsScope(*portfolio)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch futures positions")
+	}
+	coinID, err := utils.ParseInt(c, "coin_id", 0)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+	if coinID > 0 {
+		scope = scope.Where("coin_id = ?", coinID)
+	}
+	for _, param := range []string{"status", "side", "margin_mode"} {
+		if value := c.Query(param); value != "" {
+			scope = scope.Where(param+" = ?", value)
+		}
+	}
+
+	pagination := utils.ParsePagination(c, 20, 100)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	var total int64
+	if err := scope.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch futures positions",
+		})
+	}
+
+	var positions []models.FuturesPosition
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}).Preload("Coin"), pagination, cursor, "created_at", "id", true).
+		Find(&positions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch futures positions",
+		})
+	}
+
+	positions, more := utils.TrimPage(positions, pagination)
+	var next string
+	if more {
+		last := positions[len(positions)-1]
+		next = utils.NewCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"positions":  positions,
+			"pagination": utils.KeysetMeta(pagination, cursor, total, next),
+		},
+	})
+}
+
+// GetFuturesPosition returns a futures position, with its mark price,
+// unrealized P&L and, when isolated, liquidation price while it is open.
+func GetFuturesPosition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid position ID",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	position, err := services.GetFuturesPosition(*portfolio, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch futures position")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    position,
+	})
+}
+
+func OpenFuturesPosition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.FuturesPositionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := bodyPortfolio(c, userID, req.PortfolioID)
+	if err != nil {
+		return serviceError(c, err, "Failed to open position")
+	}
+
+	position, err := services.OpenFuturesPosition(*portfolio, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to open position")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Position opened successfully",
+		Data:    position,
+	})
+}
+
+func CloseFuturesPosition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid position ID",
+		})
+	}
+
+	var req models.MarginCloseRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+		}
+	}
+
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to close position")
+	}
+
+	position, err := services.CloseFuturesPosition(*portfolio, uint(id), req.Quantity)
+	if err != nil {
+		return serviceError(c, err, "Failed to close position")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Position closed successfully",
+		Data:    position,
+	})
+}
+
+// GetFundingPayments lists the funding paid and received by the futures
+// positions of the ?portfolio_id= portfolio newest first, optionally for
+// one ?position_id=. Paged with ?page= or ?cursor= like GetTrades.
+func GetFundingPayments(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	scope, err := services.FundingPaymentsScope(*portfolio)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch funding payments")
+	}
+	positionID, err := utils.ParseInt(c, "position_id", 0)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+	if positionID > 0 {
+		scope = scope.Where("position_id = ?", positionID)
+	}
+
+	pagination := utils.ParsePagination(c, 50, 200)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	var total int64
+	if err := scope.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch funding payments",
+		})
+	}
+
+	var payments []models.FundingPayment
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}), pagination, cursor, "created_at", "id", true).
+		Find(&payments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch funding payments",
+		})
+	}
+
+	payments, more := utils.TrimPage(payments, pagination)
+	var next string
+	if more {
+		last := payments[len(payments)-1]
+		next = utils.NewCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"payments":   payments,
+			"pagination": utils.KeysetMeta(pagination, cursor, total, next),
+		},
+	})
+}
+
+// GetFundingRates lists past funding rates newest first, optionally for
+// one ?coin_id=. Paged with ?page= or ?cursor= like GetTrades.
+func GetFundingRates(c *fiber.Ctx) error {
+	coinID, err := utils.ParseInt(c, "coin_id", 0)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+	scope := database.DB.Model(&models.FundingRate{})
+	if coinID > 0 {
+		scope = scope.Where("coin_id = ?", coinID)
+	}
+
+	pagination := utils.ParsePagination(c, 50, 200)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	var total int64
+	if err := scope.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch funding rates",
+		})
+	}
+
+	var rates []models.FundingRate
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}), pagination, cursor, "funded_at", "id", true).
+		Find(&rates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch funding rates",
+		})
+	}
+
+	rates, more := utils.TrimPage(rates, pagination)
+	var next string
+	if more {
+		last := rates[len(rates)-1]
+		next = utils.NewCursor(last.FundedAt, last.ID)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"rates":      rates,
+			"pagination": utils.KeysetMeta(pagination, cursor, total, next),
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+func GetFxRates(c *fiber.Ctx) error {
+	var rates []models.FxRate
+	if err := database.DB.Order("currency asc").Find(&rates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch FX rates",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"base":  models.BaseCurrency,
+			"rates": rates,
+		},
+	})
+}
+
+func UpdateFxRates(c *fiber.Ctx) error {
+	var updates []models.FxRateUpdate
+	if err := c.BodyParser(&updates); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	// Upsert each rate
+	for _, update := range updates {
+		currency := services.NormalizeCurrency(update.Currency)
+		if len(currency) != 3 || currency == models.BaseCurrency || update.Rate <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Invalid FX rate for " + currency,
+			})
+		}
+
+		rate := models.FxRate{
+			Currency:    currency,
+			Rate:        update.Rate,
+			LastUpdated: time.Now(),
+		}
+		if err := database.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "currency"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate", "last_updated"}),
+		}).Create(&rate).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Failed to update FX rates",
+			})
+		}
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "FX rates updated successfully",
+	})
+}
@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetMarginAccount returns the margin account of the ?portfolio_id=
+// portfolio with its open positions valued at current prices.
+func GetMarginAccount(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	account, err := services.GetMarginAccount(*portfolio)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch margin account")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    account,
+	})
+}
+
+func DepositMargin(c *fiber.Ctx) error {
+	return marginTransfer(c, services.DepositMargin, "Failed to deposit margin", "Margin deposited successfully")
+}
+
+func WithdrawMargin(c *fiber.Ctx) error {
+	return marginTransfer(c, services.WithdrawMargin, "Failed to withdraw margin", "Margin withdrawn successfully")
+}
+
+// marginTransfer moves cash between the requested portfolio and its margin
+// account and responds with the account.
+func marginTransfer(c *fiber.Ctx, transfer func(models.Portfolio, float64) (*services.MarginReport, error), fallback, message string) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.MarginTransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := bodyPortfolio(c, userID, req.PortfolioID)
+	if err != nil {
+		return serviceError(c, err, fallback)
+	}
+
+	account, err := transfer(*portfolio, req.Amount)
+	if err != nil {
+		return serviceError(c, err, fallback)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    account,
+	})
+}
+
+func SetMarginLeverage(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.MarginLeverageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := bodyPortfolio(c, userID, req.PortfolioID)
+	if err != nil {
+		return serviceError(c, err, "Failed to set leverage")
+	}
+
+	account, err := services.SetMarginLeverage(*portfolio, req.CoinID, req.Leverage)
+	if err != nil {
+		return serviceError(c, err, "Failed to set leverage")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Leverage updated successfully",
+		Data:    account,
+	})
+}
+
+// GetMarginPositions lists the margin positions of the ?portfolio_id=
+// portfolio newest first, optionally narrowed to one ?status= and ?side=
+// (long or short). Paged with ?page= or ?cursor= like GetTrades.
+func GetMarginPositions(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	scope, err := services.MarginPositionsScope(*portfolio)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch margin positions")
+	}
+	if status := c.Query("status"); status != "" {
+		scope = scope.Where("status = ?", status)
+	}
+	if side := c.Query("side"); side != "" {
+		scope = scope.Where("side = ?", side)
+	}
+
+	pagination := utils.ParsePagination(c, 20, 100)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	var total int64
+	if err := scope.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch margin positions",
+		})
+	}
+
+	var positions []models.MarginPosition
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}).Preload("Coin"), pagination, cursor, "created_at", "id", true).
+		Find(&positions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch margin positions",
+		})
+	}
+
+	positions, more := utils.TrimPage(positions, pagination)
+	var next string
+	if more {
+		last := positions[len(positions)-1]
+		next = utils.NewCursor(last.CreatedAt, last.ID)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"positions":  positions,
+			"pagination": utils.KeysetMeta(pagination, cursor, total, next),
+		},
+	})
+}
+
+// GetMarginPnL reports the realized and unrealized P&L of the ?portfolio_id=
+// portfolio's margin positions, split into longs and shorts and by coin.
+func GetMarginPnL(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	report, err := services.GetMarginPnL(*portfolio)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch margin P&L")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// OpenMarginPosition opens a leveraged long or short position with the
+// account's leverage for the coin.
+func OpenMarginPosition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.MarginPositionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := bodyPortfolio(c, userID, req.PortfolioID)
+	if err != nil {
+		return serviceError(c, err, "Failed to open position")
+	}
+
+	position, err := services.OpenMarginPosition(*portfolio, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to open position")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Position opened successfully",
+		Data:    position,
+	})
+}
+
+// CloseMarginPosition closes all or part of a position, buying back the
+// coin to cover a short.
+func CloseMarginPosition(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid position ID",
+		})
+	}
+
+	var req models.MarginCloseRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+		}
+	}
+
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to close position")
+	}
+
+	position, err := services.CloseMarginPosition(*portfolio, uint(id), req.Quantity)
+	if err != nil {
+		return serviceError(c, err, "Failed to close position")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Position closed successfully",
+		Data:    position,
+	})
+}
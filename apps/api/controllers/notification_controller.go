@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetNotifications lists the user's notifications newest first. Pages are
+// keyed by ID: pass the returned next_cursor as ?cursor= to get the next one.
+func GetNotifications(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if cursor := c.Query("cursor"); cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Invalid cursor",
+			})
+		}
+		query = query.Where("id < ?", id)
+	}
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if notificationType := c.Query("type"); notificationType != "" {
+		query = query.Where("type = ?", notificationType)
+	}
+
+	// Fetch one extra row to tell whether there is another page
+	var notifications []models.Notification
+	if err := query.Order("id desc").Limit(limit + 1).Find(&notifications).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch notifications",
+		})
+	}
+
+	var nextCursor *uint
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		nextCursor = &notifications[limit-1].ID
+	}
+
+	var unread int64
+	database.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread)
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"notifications": notifications,
+			"unread_count":  unread,
+			"next_cursor":   nextCursor,
+		},
+	})
+}
+
+func GetUnreadNotificationCount(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var counts []struct {
+		Type  string `json:"type"`
+		Count int64  `json:"count"`
+	}
+	if err := database.DB.Model(&models.Notification{}).
+		Select("type, COUNT(*) AS count").
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Group("type").
+		Scan(&counts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to count notifications",
+		})
+	}
+
+	byType := make(map[string]int64, len(counts))
+	var total int64
+	for _, count := range counts {
+		byType[count.Type] = count.Count
+		total += count.Count
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"unread_count": total,
+			"by_type":      byType,
+		},
+	})
+}
+
+func MarkNotificationRead(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid notification ID",
+		})
+	}
+
+	notification, err := services.MarkNotificationRead(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to update notification")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    notification,
+	})
+}
+
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	updated, err := services.MarkAllNotificationsRead(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to update notifications",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "All notifications marked as read",
+		Data:    fiber.Map{"updated": updated},
+	})
+}
+
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	prefs, err := services.NotificationPreferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch notification preferences",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    prefs,
+	})
+}
+
+// UpdateNotificationPreferences takes a map of event type to enabled, e.g.
+// {"trade.executed": false}.
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req map[string]bool
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	prefs, err := services.SetNotificationPreferences(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update notification preferences")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Notification preferences updated successfully",
+		Data:    prefs,
+	})
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetUserPerformance returns the user's equity curve across all portfolios
+// and return metrics over ?range= (1d, 7d, 30d, 90d, 1y or all). The Sharpe
+// ratio uses ?risk_free=, an annual rate in percent.
+func GetUserPerformance(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	riskFree, err := utils.ParseFloat(c, "risk_free", 0)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	performance, err := services.UserPerformance(userID, c.Query("range", "30d"), riskFree)
+	if err != nil {
+		return serviceError(c, err, "Failed to calculate performance")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    performance,
+	})
+}
+
+// GetUserAllocation breaks the portfolio's holdings down by coin, category
+// and market cap, with concentration metrics and correlations between held
+// coins over ?window= (7d, 30d or 90d).
+func GetUserAllocation(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	allocation, err := services.PortfolioAllocation(*portfolio, c.Query("window", "30d"))
+	if err != nil {
+		return serviceError(c, err, "Failed to calculate allocation")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    allocation,
+	})
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetPortfolios(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.Query("include_archived") != "true" {
+		query = query.Where("archived_at IS NULL")
+	}
+
+	var portfolios []models.Portfolio
+	if err := query.Order("is_default desc, created_at asc").Find(&portfolios).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch portfolios",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    portfolios,
+	})
+}
+
+func CreatePortfolio(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.PortfolioRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := services.CreatePortfolio(userID, req.Name)
+	if err != nil {
+		return serviceError(c, err, "Failed to create portfolio")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Portfolio created successfully",
+		Data:    portfolio,
+	})
+}
+
+func RenamePortfolio(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid portfolio ID",
+		})
+	}
+
+	var req models.PortfolioRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := services.RenamePortfolio(userID, uint(id), req.Name)
+	if err != nil {
+		return serviceError(c, err, "Failed to rename portfolio")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Portfolio renamed successfully",
+		Data:    portfolio,
+	})
+}
+
+func ArchivePortfolio(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid portfolio ID",
+		})
+	}
+
+	portfolio, err := services.ArchivePortfolio(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to archive portfolio")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Portfolio archived successfully",
+		Data:    portfolio,
+	})
+}
+
+func TransferBetweenPortfolios(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.PortfolioTransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	if err := services.TransferBetweenPortfolios(userID, req); err != nil {
+		return serviceError(c, err, "Failed to transfer between portfolios")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Transfer completed successfully",
+	})
+}
+
+// requestPortfolio resolves the optional ?portfolio_id= query parameter to one
+// of the user's portfolios, falling back to their default portfolio.
+func requestPortfolio(c *fiber.Ctx, userID uint) (*models.Portfolio, error) {
+	portfolioID, err := strconv.ParseUint(c.Query("portfolio_id", "0"), 10, 32)
+	if err != nil {
+		return nil, services.ErrPortfolioNotFound
+	}
+	return services.ResolvePortfolio(userID, uint(portfolioID))
+}
+
+// requestActivePortfolio is requestPortfolio for handlers that modify the
+// portfolio, so archived portfolios are rejected.
+func requestActivePortfolio(c *fiber.Ctx, userID uint) (*models.Portfolio, error) {
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio.IsArchived() {
+		return nil, services.ErrPortfolioArchived
+	}
+	return portfolio, nil
+}
+
+// bodyPortfolio resolves a portfolio ID taken from a request body, falling
+// back to requestActivePortfolio when it is zero.
+func bodyPortfolio(c *fiber.Ctx, userID, portfolioID uint) (*models.Portfolio, error) {
+	if portfolioID != 0 {
+		return services.ActivePortfolio(userID, portfolioID)
+	}
+	return requestActivePortfolio(c, userID)
+}
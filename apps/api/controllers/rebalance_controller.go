@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetTargetAllocations(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	var targets []models.TargetAllocation
+	if err := database.DB.Preload("Coin").Where("portfolio_id = ?", portfolio.ID).Order("weight desc").Find(&targets).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch target allocations",
+		})
+	}
+
+	settings, err := services.GetRebalanceSettings(*portfolio)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch rebalance settings",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"portfolio_id": portfolio.ID,
+			"targets":      targets,
+			"settings":     settings,
+		},
+	})
+}
+
+func SetTargetAllocations(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.TargetAllocationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	settings, err := services.SetTargetAllocations(*portfolio, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update target allocations")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Target allocations updated successfully",
+		Data:    settings,
+	})
+}
+
+// RebalancePortfolio computes the trades needed to reach the portfolio's
+// target allocations and executes them unless dry_run is set. Requests
+// default to a dry run.
+func RebalancePortfolio(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.RebalanceRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+		}
+	}
+
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	settings, err := services.GetRebalanceSettings(*portfolio)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch rebalance settings",
+		})
+	}
+
+	threshold := settings.DriftThreshold
+	if req.DriftThreshold != nil {
+		threshold = *req.DriftThreshold
+	}
+	if threshold < 0 || threshold > 100 {
+		return serviceError(c, services.ErrInvalidDriftThreshold, "")
+	}
+
+	dryRun := req.DryRun == nil || *req.DryRun
+
+	plan, err := services.Rebalance(*portfolio, threshold, dryRun, models.RebalanceTriggerManual)
+	if err != nil {
+		return serviceError(c, err, "Failed to rebalance portfolio")
+	}
+
+	message := "Rebalance planned"
+	if !plan.NeedsRebalance {
+		message = "Portfolio is within drift threshold"
+	} else if !dryRun {
+		message = "Portfolio rebalanced successfully"
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    plan,
+	})
+}
+
+func GetRebalanceRuns(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	var runs []models.RebalanceRun
+	if err := database.DB.Where("portfolio_id = ?", portfolio.ID).
+		Order("created_at desc").
+		Limit(50).
+		Find(&runs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch rebalance runs",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    runs,
+	})
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetRecurringOrders(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.Query("portfolio_id") != "" {
+		portfolio, err := requestPortfolio(c, userID)
+		if err != nil {
+			return serviceError(c, err, "Failed to fetch portfolio")
+		}
+		query = query.Where("portfolio_id = ?", portfolio.ID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var orders []models.RecurringOrder
+	if err := query.Preload("Coin").Order("created_at desc").Find(&orders).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch recurring orders",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    orders,
+	})
+}
+
+func CreateRecurringOrder(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.RecurringOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := bodyPortfolio(c, userID, req.PortfolioID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	order, err := services.CreateRecurringOrder(*portfolio, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create recurring order")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Recurring order created successfully",
+		Data:    order,
+	})
+}
+
+func PauseRecurringOrder(c *fiber.Ctx) error {
+	return setRecurringOrderStatus(c, models.RecurringStatusPaused, "Recurring order paused")
+}
+
+func ResumeRecurringOrder(c *fiber.Ctx) error {
+	return setRecurringOrderStatus(c, models.RecurringStatusActive, "Recurring order resumed")
+}
+
+func CancelRecurringOrder(c *fiber.Ctx) error {
+	return setRecurringOrderStatus(c, models.RecurringStatusCancelled, "Recurring order cancelled")
+}
+
+func setRecurringOrderStatus(c *fiber.Ctx, status, message string) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid recurring order ID",
+		})
+	}
+
+	order, err := services.SetRecurringOrderStatus(userID, uint(id), status)
+	if err != nil {
+		return serviceError(c, err, "Failed to update recurring order")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: message,
+		Data:    order,
+	})
+}
+
+func GetRecurringOrderRuns(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid recurring order ID",
+		})
+	}
+
+	// Check the order belongs to the user
+	var order models.RecurringOrder
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&order).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Recurring order not found",
+		})
+	}
+
+	pagination := utils.ParsePagination(c, 20, 100)
+
+	var total int64
+	database.DB.Model(&models.RecurringOrderRun{}).Where("recurring_order_id = ?", order.ID).Count(&total)
+
+	var runs []models.RecurringOrderRun
+	if err := database.DB.Preload("Trade").
+		Where("recurring_order_id = ?", order.ID).
+		Order("created_at desc").
+		Offset(pagination.Offset()).
+		Limit(pagination.Limit).
+		Find(&runs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch recurring order runs",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"runs":       runs,
+			"pagination": pagination.Meta(total),
+		},
+	})
+}
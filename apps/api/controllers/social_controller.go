@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetPublicProfile returns the user's own public profile and privacy settings.
+func GetPublicProfile(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	profile, err := services.GetProfile(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch profile",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    profile,
+	})
+}
+
+func UpdatePublicProfile(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.ProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	profile, err := services.UpdateProfile(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update profile")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Profile updated successfully",
+		Data:    profile,
+	})
+}
+
+// GetTraderProfile returns a public profile, with performance over ?range=
+// (1d, 7d, 30d, 90d, 1y or all) when the trader shows it.
+func GetTraderProfile(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	trader, err := services.GetTraderProfile(userID, c.Params("username"), c.Query("range", "30d"))
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch profile")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    trader,
+	})
+}
+
+func FollowTrader(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	if err := services.FollowTrader(userID, c.Params("username")); err != nil {
+		return serviceError(c, err, "Failed to follow trader")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Following " + c.Params("username"),
+	})
+}
+
+func UnfollowTrader(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	if err := services.UnfollowTrader(userID, c.Params("username")); err != nil {
+		return serviceError(c, err, "Failed to unfollow trader")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Unfollowed " + c.Params("username"),
+	})
+}
+
+func GetFollowing(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	following, err := services.ListFollowing(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch followed traders",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    following,
+	})
+}
+
+// GetFollowers lists the user's followers with public profiles, along with
+// the total number of followers.
+func GetFollowers(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	followers, total, err := services.ListFollowers(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch followers",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"followers": followers,
+			"total":     total,
+		},
+	})
+}
+
+// GetFeed lists the trades of followed traders newest first. Paged with
+// ?page= or ?cursor= like GetTrades.
+func GetFeed(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	pagination := utils.ParsePagination(c, 20, 100)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	scope := services.FeedScope(userID)
+	var total int64
+	if err := scope.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch feed",
+		})
+	}
+
+	var trades []models.Trade
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}).Preload("Coin").Preload("User"), pagination, cursor, "trades.created_at", "trades.id", true).
+		Find(&trades).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch feed",
+		})
+	}
+
+	trades, more := utils.TrimPage(trades, pagination)
+	var next string
+	if more {
+		last := trades[len(trades)-1]
+		next = utils.NewCursor(last.CreatedAt, last.ID)
+	}
+
+	feed, err := services.PublicTrades(trades)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch feed",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"trades":     feed,
+			"pagination": utils.KeysetMeta(pagination, cursor, total, next),
+		},
+	})
+}
+
+func GetCopyTradings(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	copies, err := services.ListCopyTradings(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch copy tradings",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    copies,
+	})
+}
+
+// CreateCopyTrading starts mirroring a trader's trades into one of the
+// user's portfolios.
+func CreateCopyTrading(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.CopyTradingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	copying, err := services.CreateCopyTrading(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to start copy trading")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Copy trading started",
+		Data:    copying,
+	})
+}
+
+func UpdateCopyTrading(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid copy trading ID",
+		})
+	}
+
+	var req models.CopyTradingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	copying, err := services.UpdateCopyTrading(userID, uint(id), req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update copy trading")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Copy trading updated successfully",
+		Data:    copying,
+	})
+}
+
+func DeleteCopyTrading(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid copy trading ID",
+		})
+	}
+
+	if err := services.DeleteCopyTrading(userID, uint(id)); err != nil {
+		return serviceError(c, err, "Failed to stop copy trading")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Copy trading stopped",
+	})
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTaxLots lists the portfolio's open tax lots, optionally for one
+// ?coin_id=, oldest first. Their IDs can be passed with a sell to pick lots.
+func GetTaxLots(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	coinID, err := utils.ParseInt(c, "coin_id", 0)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	query := database.DB.Preload("Coin").Where("portfolio_id = ? AND remaining > 0", portfolio.ID)
+	if coinID > 0 {
+		query = query.Where("coin_id = ?", coinID)
+	}
+
+	var lots []models.TaxLot
+	if err := query.Order("acquired_at asc, id asc").Find(&lots).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch tax lots",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    lots,
+	})
+}
+
+// GetTaxReport returns the realized gains report for ?year= (the current
+// year by default), as JSON or, with ?format=csv, as a CSV download.
+func GetTaxReport(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	year, err := utils.ParseInt(c, "year", time.Now().Year())
+	if err != nil {
+		return serviceError(c, services.ErrInvalidTaxYear, "")
+	}
+
+	report, err := services.BuildTaxReport(userID, year)
+	if err != nil {
+		return serviceError(c, err, "Failed to build tax report")
+	}
+
+	switch c.Query("format", "json") {
+	case "json":
+		return c.JSON(models.ApiResponse{
+			Success: true,
+			Data:    report,
+		})
+	case "csv":
+		var buf bytes.Buffer
+		if err := services.WriteTaxReportCSV(&buf, report); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Failed to export tax report",
+			})
+		}
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="capital-gains-%d.csv"`, year))
+		return c.Send(buf.Bytes())
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Format must be json or csv",
+		})
+	}
+}
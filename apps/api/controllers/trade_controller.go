@@ -1,12 +1,19 @@
 package controllers
 
 import (
+	"bufio"
 	"crypto-app-api/database"
 	"crypto-app-api/middlewares"
 	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"encoding/json"
+	"fmt"
+	"log"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 func CreateTrade(c *fiber.Ctx) error {
@@ -26,174 +33,183 @@ func CreateTrade(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate trade type
-	if req.Type != "buy" && req.Type != "sell" {
-		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+	portfolio, err := bodyPortfolio(c, userID, req.PortfolioID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	trade, err := services.ExecuteTrade(*portfolio, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to complete trade")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Trade executed successfully",
+		Data:    trade,
+	})
+}
+
+// tradeAggregates are the totals returned for a filtered trade list.
+var tradeAggregates = map[string]string{
+	"count":        "COUNT(*)",
+	"total_bought": "SUM(CASE WHEN type = 'buy' THEN total_amount ELSE 0 END)",
+	"total_sold":   "SUM(CASE WHEN type = 'sell' THEN total_amount ELSE 0 END)",
+	"fees":         "SUM(fee)",
+	"volume":       "SUM(total_amount)",
+}
+
+// GetTrades lists trades newest first, filtered as described by tradeScope,
+// with totals over every matching trade. Pages are requested with ?page= or,
+// stable under concurrent trading, by passing the returned next_cursor as
+// ?cursor=.
+func GetTrades(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Trade type must be 'buy' or 'sell'",
+			Error:   "Unauthorized",
 		})
 	}
 
-	// Get user
-	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+	pagination := utils.ParsePagination(c, 20, 100)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	scope, _, err := tradeScope(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch trades")
+	}
+
+	totals, err := utils.Aggregates(scope, tradeAggregates)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "User not found",
+			Error:   "Failed to fetch trades",
 		})
 	}
 
-	// Get coin
-	var coin models.Coin
-	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+	var trades []models.Trade
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}).Preload("Coin"), pagination, cursor, "created_at", "id", true).
+		Find(&trades).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Coin not found",
+			Error:   "Failed to fetch trades",
 		})
 	}
 
-	totalAmount := req.Quantity * req.Price
-
-	// Begin transaction
-	tx := database.DB.Begin()
+	trades, more := utils.TrimPage(trades, pagination)
+	var next string
+	if more {
+		last := trades[len(trades)-1]
+		next = utils.NewCursor(last.CreatedAt, last.ID)
+	}
 
-	if req.Type == "buy" {
-		// Check if user has enough balance
-		if user.Balance < totalAmount {
-			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
-				Success: false,
-				Error:   "Insufficient balance",
-			})
-		}
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"trades":     trades,
+			"totals":     totals,
+			"pagination": utils.KeysetMeta(pagination, cursor, int64(totals["count"]), next),
+		},
+	})
+}
 
-		// Update user balance
-		if err := tx.Model(&user).Update("balance", user.Balance-totalAmount).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-				Success: false,
-				Error:   "Failed to update balance",
-			})
-		}
+// tradeScope selects the trades of ?portfolio_id=, the default portfolio when
+// missing or all of the user's portfolios with "all", narrowed by ?coin_id=,
+// ?symbol=, ?type=, ?from= and ?to=, and ?amount_min= and ?amount_max= on the
+// total amount. Archived trades are only returned when asking for a specific
+// ?reset_id=. The portfolio is nil when selecting all of them.
+func tradeScope(c *fiber.Ctx, userID uint) (*gorm.DB, *models.Portfolio, error) {
+	scope := database.DB.Model(&models.Trade{})
 
-		// Update or create user coin holding
-		var userCoin models.UserCoin
-		if err := tx.Where("user_id = ? AND coin_id = ?", userID, req.CoinID).First(&userCoin).Error; err != nil {
-			// Create new holding
-			userCoin = models.UserCoin{
-				UserID:       userID,
-				CoinID:       req.CoinID,
-				Quantity:     req.Quantity,
-				AveragePrice: req.Price,
-			}
-			if err := tx.Create(&userCoin).Error; err != nil {
-				tx.Rollback()
-				return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-					Success: false,
-					Error:   "Failed to create holding",
-				})
-			}
-		} else {
-			// Update existing holding
-			newQuantity := userCoin.Quantity + req.Quantity
-			newAveragePrice := ((userCoin.Quantity * userCoin.AveragePrice) + totalAmount) / newQuantity
-
-			if err := tx.Model(&userCoin).Updates(map[string]interface{}{
-				"quantity":      newQuantity,
-				"average_price": newAveragePrice,
-			}).Error; err != nil {
-				tx.Rollback()
-				return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-					Success: false,
-					Error:   "Failed to update holding",
-				})
-			}
-		}
-	} else { // sell
-		// Get user coin holding
-		var userCoin models.UserCoin
-		if err := tx.Where("user_id = ? AND coin_id = ?", userID, req.CoinID).First(&userCoin).Error; err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
-				Success: false,
-				Error:   "You don't own this coin",
-			})
-		}
-
-		// Check if user has enough coins
-		if userCoin.Quantity < req.Quantity {
-			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
-				Success: false,
-				Error:   "Insufficient coin quantity",
-			})
+	var portfolio *models.Portfolio
+	if c.Query("portfolio_id") == "all" {
+		scope = scope.Where("user_id = ?", userID)
+	} else {
+		var err error
+		if portfolio, err = requestPortfolio(c, userID); err != nil {
+			return nil, nil, err
 		}
+		scope = scope.Where("portfolio_id = ?", portfolio.ID)
+	}
 
-		// Update user balance
-		if err := tx.Model(&user).Update("balance", user.Balance+totalAmount).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-				Success: false,
-				Error:   "Failed to update balance",
-			})
+	if c.Query("reset_id") == "" {
+		scope = scope.Where("reset_id IS NULL")
+	} else {
+		resetID, err := strconv.ParseUint(c.Query("reset_id"), 10, 32)
+		if err != nil {
+			return nil, nil, &utils.QueryError{Param: "reset_id"}
 		}
+		scope = scope.Where("reset_id = ?", resetID)
+	}
 
-		// Update user coin holding
-		newQuantity := userCoin.Quantity - req.Quantity
-		if newQuantity > 0 {
-			if err := tx.Model(&userCoin).Update("quantity", newQuantity).Error; err != nil {
-				tx.Rollback()
-				return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-					Success: false,
-					Error:   "Failed to update holding",
-				})
-			}
-		} else {
-			// Delete holding if quantity is 0
-			if err := tx.Delete(&userCoin).Error; err != nil {
-				tx.Rollback()
-				return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-					Success: false,
-					Error:   "Failed to delete holding",
-				})
-			}
+	if tradeType := c.Query("type"); tradeType != "" {
+		if tradeType != "buy" && tradeType != "sell" {
+			return nil, nil, services.ErrInvalidTradeType
 		}
+		scope = scope.Where("type = ?", tradeType)
 	}
 
-	// Create trade record
-	trade := models.Trade{
-		UserID:      userID,
-		CoinID:      req.CoinID,
-		Type:        req.Type,
-		Quantity:    req.Quantity,
-		Price:       req.Price,
-		TotalAmount: totalAmount,
+	scope, err := filterCoins(c, scope, "coin_id")
+	if err != nil {
+		return nil, nil, err
 	}
+	if scope, err = utils.FilterTimeRange(c, scope, "created_at"); err != nil {
+		return nil, nil, err
+	}
+	if scope, err = utils.FilterFloatRange(c, scope, "amount", "total_amount"); err != nil {
+		return nil, nil, err
+	}
+	return scope, portfolio, nil
+}
 
-	if err := tx.Create(&trade).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+// ExportTrades streams the trades selected by tradeScope as a ?format=csv
+// (the default), json or xlsx download.
+func ExportTrades(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Failed to create trade",
+			Error:   "Unauthorized",
 		})
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
-			Success: false,
-			Error:   "Failed to complete trade",
-		})
+	format := c.Query("format", "csv")
+	contentType, ok := services.ExportFormats[format]
+	if !ok {
+		return serviceError(c, services.ErrInvalidExportFormat, "")
+	}
+
+	scope, portfolio, err := tradeScope(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to export trades")
 	}
 
-	// Load trade with relations
-	database.DB.Preload("Coin").First(&trade, trade.ID)
+	filename := "trades." + format
+	if portfolio != nil {
+		filename = fmt.Sprintf("trades-%d.%s", portfolio.ID, format)
+	}
 
-	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
-		Success: true,
-		Message: "Trade executed successfully",
-		Data:    trade,
+	// The status is sent before streaming starts, so a failure part way
+	// through can only be logged and leaves a truncated file.
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := services.ExportTrades(w, format, scope); err != nil {
+			log.Printf("Failed to export trades of user %d: %v", userID, err)
+		}
 	})
+	return nil
 }
 
-func GetTrades(c *fiber.Ctx) error {
+// ImportTrades imports a multipart trade history CSV uploaded as file, read
+// with the ?profile= column mapping (generic by default) adjusted by an
+// optional JSON mapping form field. With ?dry_run=true it only returns the
+// validation report.
+func ImportTrades(c *fiber.Ctx) error {
 	userID := middlewares.GetUserIDFromContext(c)
 	if userID == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
@@ -202,48 +218,60 @@ func GetTrades(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse query parameters
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
-
-	if page < 1 {
-		page = 1
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
 	}
-	if limit < 1 || limit > 100 {
-		limit = 20
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "A CSV file is required",
+		})
 	}
 
-	offset := (page - 1) * limit
+	var mapping *models.TradeImportMapping
+	if raw := c.FormValue("mapping"); raw != "" {
+		mapping = &models.TradeImportMapping{}
+		if err := json.Unmarshal([]byte(raw), mapping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Invalid column mapping",
+			})
+		}
+	}
 
-	var trades []models.Trade
-	var total int64
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "A CSV file is required",
+		})
+	}
+	defer file.Close()
 
-	// Get total count
-	database.DB.Model(&models.Trade{}).Where("user_id = ?", userID).Count(&total)
+	dryRun := c.QueryBool("dry_run")
+	report, err := services.ImportTrades(*portfolio, file, c.Query("profile", "generic"), mapping, dryRun)
+	if err != nil {
+		return serviceError(c, err, "Failed to import trades")
+	}
 
-	// Get trades with pagination
-	if err := database.DB.Preload("Coin").
-		Where("user_id = ?", userID).
-		Order("created_at desc").
-		Offset(offset).
-		Limit(limit).
-		Find(&trades).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+	if len(report.Errors) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Failed to fetch trades",
+			Error:   "Some rows are invalid, nothing was imported",
+			Data:    report,
 		})
 	}
 
+	message := "Trades imported successfully"
+	if dryRun {
+		message = "Import file is valid"
+	}
 	return c.JSON(models.ApiResponse{
 		Success: true,
-		Data: fiber.Map{
-			"trades": trades,
-			"pagination": fiber.Map{
-				"page":  page,
-				"limit": limit,
-				"total": total,
-				"pages": (total + int64(limit) - 1) / int64(limit),
-			},
-		},
+		Message: message,
+		Data:    report,
 	})
 }
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func Deposit(c *fiber.Ctx) error {
+	return createTransfer(c, models.TransferDeposit)
+}
+
+func Withdraw(c *fiber.Ctx) error {
+	return createTransfer(c, models.TransferWithdrawal)
+}
+
+func createTransfer(c *fiber.Ctx, direction string) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.TransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	transfer, err := services.CreateTransfer(*portfolio, direction, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create transfer")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Transfer created successfully",
+		Data:    transfer,
+	})
+}
+
+func GetTransfers(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	pagination := utils.ParsePagination(c, 20, 100)
+
+	query := database.DB.Model(&models.Transfer{}).Where("user_id = ?", userID)
+	if c.Query("portfolio_id") != "" {
+		portfolio, err := requestPortfolio(c, userID)
+		if err != nil {
+			return serviceError(c, err, "Failed to fetch portfolio")
+		}
+		query = query.Where("portfolio_id = ?", portfolio.ID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var transfers []models.Transfer
+	if err := query.Preload("Coin").
+		Order("created_at desc").
+		Offset(pagination.Offset()).
+		Limit(pagination.Limit).
+		Find(&transfers).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch transfers",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"transfers":  transfers,
+			"pagination": pagination.Meta(total),
+		},
+	})
+}
+
+func CancelTransfer(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid transfer ID",
+		})
+	}
+
+	transfer, err := services.CancelTransfer(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to cancel transfer")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Transfer cancelled successfully",
+		Data:    transfer,
+	})
+}
@@ -4,9 +4,11 @@ import (
 	"crypto-app-api/database"
 	"crypto-app-api/middlewares"
 	"crypto-app-api/models"
-	"strconv"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 func GetUserProfile(c *fiber.Ctx) error {
@@ -25,6 +27,7 @@ func GetUserProfile(c *fiber.Ctx) error {
 			Error:   "User not found",
 		})
 	}
+	services.LoadDefaultBalance(&user)
 
 	return c.JSON(models.ApiResponse{
 		Success: true,
@@ -32,6 +35,9 @@ func GetUserProfile(c *fiber.Ctx) error {
 	})
 }
 
+// GetUserBalance returns the portfolio's cash. balance, the BaseCurrency
+// cash, and total_cash are in the requested currency; balances lists each
+// currency's balance in its own currency.
 func GetUserBalance(c *fiber.Ctx) error {
 	userID := middlewares.GetUserIDFromContext(c)
 	if userID == 0 {
@@ -42,21 +48,73 @@ func GetUserBalance(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	if err := database.DB.Select("balance").First(&user, userID).Error; err != nil {
+	if err := database.DB.First(&user, userID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
 			Success: false,
 			Error:   "User not found",
 		})
 	}
 
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	currency, rate, err := requestedCurrency(c, user)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	balances, err := services.CashBalances(*portfolio)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch balances",
+		})
+	}
+
+	totalCash, err := services.TotalCash(balances, currency)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to convert balances",
+		})
+	}
+
 	return c.JSON(models.ApiResponse{
 		Success: true,
 		Data: fiber.Map{
-			"balance": user.Balance,
+			"portfolio_id": portfolio.ID,
+			"balance":      portfolio.Balance * rate,
+			"balances":     balances,
+			"total_cash":   totalCash,
+			"currency":     currency,
+			"fx_rate":      rate,
 		},
 	})
 }
 
+// holdingValue is the SQL value of a holding at the current price.
+const holdingValue = "user_coins.quantity * coins.current_price"
+
+// holdingAggregates are the totals returned for a filtered holdings list.
+var holdingAggregates = map[string]string{
+	"count":      "COUNT(*)",
+	"value":      "SUM(" + holdingValue + ")",
+	"cost_basis": "SUM(user_coins.quantity * user_coins.average_price)",
+}
+
+// GetUserHoldings lists the portfolio's holdings, optionally filtered by
+// ?coin_id=, ?symbol=, ?category= and ?value_min= and ?value_max= (in
+// BaseCurrency). Prices and totals over every matching holding are returned
+// in the requested currency.
+//
+// By default the largest position comes first and pages are requested with
+// ?page=, as values move with prices between requests. ?sort=created_at
+// lists the newest holding first and can also be paged with ?cursor=.
 func GetUserHoldings(c *fiber.Ctx) error {
 	userID := middlewares.GetUserIDFromContext(c)
 	if userID == 0 {
@@ -66,31 +124,71 @@ func GetUserHoldings(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse query parameters
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+	}
 
-	if page < 1 {
-		page = 1
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
 	}
-	if limit < 1 || limit > 100 {
-		limit = 20
+
+	currency, rate, err := requestedCurrency(c, user)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
 	}
 
-	offset := (page - 1) * limit
+	pagination := utils.ParsePagination(c, 20, 100)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+	sortBy := c.Query("sort", "value")
+	if sortBy != "value" && sortBy != "created_at" {
+		return serviceError(c, &utils.QueryError{Param: "sort"}, "")
+	}
+	if sortBy == "value" && cursor != nil {
+		return serviceError(c, &utils.QueryError{Param: "cursor"}, "")
+	}
 
-	var holdings []models.UserCoin
-	var total int64
+	scope := database.DB.Model(&models.UserCoin{}).
+		Joins("JOIN coins ON coins.id = user_coins.coin_id").
+		Where("user_coins.portfolio_id = ? AND user_coins.quantity > 0", portfolio.ID)
+	if scope, err = filterCoins(c, scope, "user_coins.coin_id"); err != nil {
+		return serviceError(c, err, "")
+	}
+	if categories := utils.ParseList(c, "category"); len(categories) > 0 {
+		scope = scope.Where("coins.category IN ?", categories)
+	}
+	if scope, err = utils.FilterFloatRange(c, scope, "value", holdingValue); err != nil {
+		return serviceError(c, err, "")
+	}
 
-	// Get total count
-	database.DB.Model(&models.UserCoin{}).Where("user_id = ? AND quantity > 0", userID).Count(&total)
+	totals, err := utils.Aggregates(scope, holdingAggregates)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch holdings",
+		})
+	}
+	for _, name := range []string{"value", "cost_basis"} {
+		totals[name] *= rate
+	}
+	totals["unrealized_pnl"] = totals["value"] - totals["cost_basis"]
 
-	// Get holdings with pagination
-	if err := database.DB.Preload("Coin").
-		Where("user_id = ? AND quantity > 0", userID).
-		Order("quantity * coin.current_price desc").
-		Offset(offset).
-		Limit(limit).
+	key := "user_coins.created_at"
+	if sortBy == "value" {
+		key = holdingValue
+	}
+	var holdings []models.UserCoin
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}).Preload("Coin"), pagination, cursor, key, "user_coins.id", true).
 		Find(&holdings).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
 			Success: false,
@@ -98,25 +196,26 @@ func GetUserHoldings(c *fiber.Ctx) error {
 		})
 	}
 
-	// Calculate total portfolio value
-	var portfolioValue float64
-	for _, holding := range holdings {
-		if holding.Coin.CurrentPrice > 0 {
-			portfolioValue += holding.Quantity * holding.Coin.CurrentPrice
-		}
+	holdings, more := utils.TrimPage(holdings, pagination)
+	var next string
+	if more && sortBy == "created_at" {
+		last := holdings[len(holdings)-1]
+		next = utils.NewCursor(last.CreatedAt, last.ID)
+	}
+	for i := range holdings {
+		convertHolding(&holdings[i], rate)
 	}
 
 	return c.JSON(models.ApiResponse{
 		Success: true,
 		Data: fiber.Map{
+			"portfolio_id":    portfolio.ID,
 			"holdings":        holdings,
-			"portfolio_value": portfolioValue,
-			"pagination": fiber.Map{
-				"page":  page,
-				"limit": limit,
-				"total": total,
-				"pages": (total + int64(limit) - 1) / int64(limit),
-			},
+			"portfolio_value": totals["value"],
+			"totals":          totals,
+			"currency":        currency,
+			"fx_rate":         rate,
+			"pagination":      utils.KeysetMeta(pagination, cursor, int64(totals["count"]), next),
 		},
 	})
 }
@@ -139,37 +238,309 @@ func GetUserStats(c *fiber.Ctx) error {
 		})
 	}
 
+	portfolio, err := requestPortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	currency, rate, err := requestedCurrency(c, user)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	// Get cash across all currencies
+	balances, err := services.CashBalances(*portfolio)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch balances",
+		})
+	}
+	totalCash, err := services.TotalCash(balances, currency)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to convert balances",
+		})
+	}
+
 	// Get total trades count
 	var totalTrades int64
-	database.DB.Model(&models.Trade{}).Where("user_id = ?", userID).Count(&totalTrades)
+	database.DB.Model(&models.Trade{}).Where("portfolio_id = ? AND reset_id IS NULL", portfolio.ID).Count(&totalTrades)
 
 	// Get total holdings count
 	var totalHoldings int64
-	database.DB.Model(&models.UserCoin{}).Where("user_id = ? AND quantity > 0", userID).Count(&totalHoldings)
+	database.DB.Model(&models.UserCoin{}).Where("portfolio_id = ? AND quantity > 0", portfolio.ID).Count(&totalHoldings)
 
-	// Get watchlist count
+	// Get watchlist count (distinct coins across all of the user's watchlists)
 	var watchlistCount int64
-	database.DB.Model(&models.Watchlist{}).Where("user_id = ?", userID).Count(&watchlistCount)
+	database.DB.Model(&models.Watchlist{}).Where("user_id = ?", userID).Distinct("coin_id").Count(&watchlistCount)
 
 	// Calculate portfolio value
 	var portfolioValue float64
 	var holdings []models.UserCoin
-	database.DB.Preload("Coin").Where("user_id = ? AND quantity > 0", userID).Find(&holdings)
+	database.DB.Preload("Coin").Where("portfolio_id = ? AND quantity > 0", portfolio.ID).Find(&holdings)
 	for _, holding := range holdings {
 		if holding.Coin.CurrentPrice > 0 {
 			portfolioValue += holding.Quantity * holding.Coin.CurrentPrice
 		}
 	}
 
+	portfolioValue *= rate
+
 	return c.JSON(models.ApiResponse{
 		Success: true,
 		Data: fiber.Map{
-			"balance":         user.Balance,
+			"portfolio_id":    portfolio.ID,
+			"balance":         portfolio.Balance * rate,
+			"total_cash":      totalCash,
 			"portfolio_value": portfolioValue,
-			"total_value":     user.Balance + portfolioValue,
+			"total_value":     totalCash + portfolioValue,
 			"total_trades":    totalTrades,
 			"total_holdings":  totalHoldings,
 			"watchlist_count": watchlistCount,
+			"currency":        currency,
+			"fx_rate":         rate,
+		},
+	})
+}
+
+func UpdateUserProfile(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+	}
+
+	if req.PreferredCurrency != "" {
+		currency := services.NormalizeCurrency(req.PreferredCurrency)
+		if _, err := services.GetFxRate(currency); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		user.PreferredCurrency = currency
+	}
+
+	if req.TaxLotMethod != "" {
+		if !services.IsValidLotMethod(req.TaxLotMethod) {
+			return serviceError(c, services.ErrInvalidLotMethod, "")
+		}
+		user.TaxLotMethod = req.TaxLotMethod
+	}
+
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"preferred_currency": user.PreferredCurrency,
+		"tax_lot_method":     user.TaxLotMethod,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to update profile",
+		})
+	}
+
+	services.LoadDefaultBalance(&user)
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Profile updated successfully",
+		Data:    user,
+	})
+}
+
+// ConvertCurrency moves cash from one currency balance to another at the
+// current FX rate.
+func ConvertCurrency(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.CurrencyConversionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	from, to := services.NormalizeCurrency(req.From), services.NormalizeCurrency(req.To)
+	if req.Amount <= 0 || from == to {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Amount must be positive and currencies must differ",
+		})
+	}
+
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+	if portfolio.IsContest() {
+		return serviceError(c, services.ErrContestPortfolio, "")
+	}
+
+	converted, err := services.Convert(req.Amount, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	// Begin transaction
+	tx := database.DB.Begin()
+
+	if err := services.AdjustCashBalance(tx, *portfolio, from, -req.Amount); err != nil {
+		tx.Rollback()
+		return serviceError(c, err, "Failed to update balance")
+	}
+	if err := services.AdjustCashBalance(tx, *portfolio, to, converted); err != nil {
+		tx.Rollback()
+		return serviceError(c, err, "Failed to update balance")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to convert currency",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Currency converted successfully",
+		Data: fiber.Map{
+			"portfolio_id":     portfolio.ID,
+			"from":             from,
+			"to":               to,
+			"amount":           req.Amount,
+			"converted_amount": converted,
 		},
 	})
 }
+
+// requestedCurrency resolves the ?currency= query parameter, defaulting to the
+// user's preferred display currency, and returns it with its FX rate.
+func requestedCurrency(c *fiber.Ctx, user models.User) (string, float64, error) {
+	currency := c.Query("currency", user.PreferredCurrency)
+	currency = services.NormalizeCurrency(currency)
+
+	rate, err := services.GetFxRate(currency)
+	if err != nil {
+		return "", 0, err
+	}
+	return currency, rate, nil
+}
+
+// convertHolding converts a holding's prices and its coin's market figures
+// from BaseCurrency at rate, for responses in the requested currency.
+func convertHolding(holding *models.UserCoin, rate float64) {
+	holding.AveragePrice *= rate
+	holding.Coin.CurrentPrice *= rate
+	holding.Coin.PriceChange24h *= rate
+	holding.Coin.MarketCap = int64(float64(holding.Coin.MarketCap) * rate)
+	holding.Coin.Volume24h = int64(float64(holding.Coin.Volume24h) * rate)
+}
+
+// ResetAccount archives a portfolio's current trade history and restores it to
+// a starting balance chosen by the user.
+func ResetAccount(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	req := models.ResetAccountRequest{StartingBalance: models.DefaultStartingBalance}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+		}
+	}
+
+	if req.StartingBalance <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Starting balance must be positive",
+		})
+	}
+
+	portfolio, err := requestActivePortfolio(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch portfolio")
+	}
+
+	reset, err := services.ResetAccount(*portfolio, req.StartingBalance)
+	if err != nil {
+		return serviceError(c, err, "Failed to reset account")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Account reset successfully",
+		Data:    reset,
+	})
+}
+
+func GetAccountResets(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.Query("portfolio_id") != "" {
+		portfolio, err := requestPortfolio(c, userID)
+		if err != nil {
+			return serviceError(c, err, "Failed to fetch portfolio")
+		}
+		query = query.Where("portfolio_id = ?", portfolio.ID)
+	}
+
+	var resets []models.AccountReset
+	if err := query.Order("created_at desc").Find(&resets).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch account resets",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    resets,
+	})
+}
@@ -4,11 +4,17 @@ import (
 	"crypto-app-api/database"
 	"crypto-app-api/middlewares"
 	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+// GetWatchlist, AddToWatchlist and RemoveFromWatchlist serve the original
+// /api/watchlist endpoints, which operate on the user's default watchlist.
+
 func GetWatchlist(c *fiber.Ctx) error {
 	userID := middlewares.GetUserIDFromContext(c)
 	if userID == 0 {
@@ -18,8 +24,13 @@ func GetWatchlist(c *fiber.Ctx) error {
 		})
 	}
 
-	var watchlist []models.Watchlist
-	if err := database.DB.Preload("Coin").Where("user_id = ?", userID).Find(&watchlist).Error; err != nil {
+	group, err := services.ResolveWatchlist(userID, 0)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	watchlist, err := services.WatchlistEntries(group.ID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
 			Success: false,
 			Error:   "Failed to fetch watchlist",
@@ -41,9 +52,7 @@ func AddToWatchlist(c *fiber.Ctx) error {
 		})
 	}
 
-	var req struct {
-		CoinID uint `json:"coin_id"`
-	}
+	var req models.WatchlistEntryRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
 			Success: false,
@@ -51,48 +60,226 @@ func AddToWatchlist(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if coin exists
-	var coin models.Coin
-	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+	group, err := services.ResolveWatchlist(userID, 0)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	watchlist, err := services.AddWatchlistEntry(*group, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to add to watchlist")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Added to watchlist successfully",
+		Data:    watchlist,
+	})
+}
+
+func RemoveFromWatchlist(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Coin not found",
+			Error:   "Unauthorized",
 		})
 	}
 
-	// Check if already in watchlist
-	var existing models.Watchlist
-	if err := database.DB.Where("user_id = ? AND coin_id = ?", userID, req.CoinID).First(&existing).Error; err == nil {
-		return c.Status(fiber.StatusConflict).JSON(models.ApiResponse{
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Coin already in watchlist",
+			Error:   "Invalid watchlist ID",
 		})
 	}
 
-	// Add to watchlist
-	watchlist := models.Watchlist{
-		UserID: userID,
-		CoinID: req.CoinID,
+	if err := services.RemoveWatchlistEntry(userID, 0, uint(id)); err != nil {
+		return serviceError(c, err, "Failed to remove from watchlist")
 	}
 
-	if err := database.DB.Create(&watchlist).Error; err != nil {
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Removed from watchlist successfully",
+	})
+}
+
+func GetWatchlists(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	// Make sure the default list exists before listing
+	if _, err := services.ResolveWatchlist(userID, 0); err != nil {
+		return serviceError(c, err, "Failed to fetch watchlists")
+	}
+
+	var groups []models.WatchlistGroup
+	if err := database.DB.Preload("Entries", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc, id asc")
+	}).Preload("Entries.Coin").
+		Where("user_id = ?", userID).
+		Order("is_default desc, created_at asc").
+		Find(&groups).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Failed to add to watchlist",
+			Error:   "Failed to fetch watchlists",
 		})
 	}
 
-	// Load with coin data
-	database.DB.Preload("Coin").First(&watchlist, watchlist.ID)
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    groups,
+	})
+}
+
+func GetWatchlistByID(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	group, err := paramWatchlist(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	entries, err := services.WatchlistEntries(group.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch watchlist",
+		})
+	}
+	group.Entries = entries
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    group,
+	})
+}
+
+// watchlistAggregates are the totals returned for a filtered watchlist.
+var watchlistAggregates = map[string]string{
+	"count":              "COUNT(*)",
+	"with_target":        "COUNT(watchlists.target_price)",
+	"average_change_24h": "AVG(coins.price_change_percentage_24h)",
+}
+
+// GetWatchlistItems lists a watchlist's coins in display order, optionally
+// filtered by ?coin_id=, ?symbol=, ?price_min=/?price_max=,
+// ?change_min=/?change_max= and ?has_target=true, with totals over every
+// matching entry. Pages are requested with ?page= or ?cursor=.
+func GetWatchlistItems(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	group, err := paramWatchlist(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	pagination := utils.ParsePagination(c, 50, 200)
+	cursor, err := utils.ParseCursor(c)
+	if err != nil {
+		return serviceError(c, err, "")
+	}
+
+	scope := database.DB.Model(&models.Watchlist{}).
+		Joins("JOIN coins ON coins.id = watchlists.coin_id").
+		Where("watchlists.group_id = ?", group.ID)
+	if scope, err = filterCoins(c, scope, "watchlists.coin_id"); err != nil {
+		return serviceError(c, err, "")
+	}
+	for param, column := range map[string]string{
+		"price":  "coins.current_price",
+		"change": "coins.price_change_percentage_24h",
+	} {
+		if scope, err = utils.FilterFloatRange(c, scope, param, column); err != nil {
+			return serviceError(c, err, "")
+		}
+	}
+	if c.QueryBool("has_target") {
+		scope = scope.Where("watchlists.target_price IS NOT NULL")
+	}
+
+	totals, err := utils.Aggregates(scope, watchlistAggregates)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch watchlist",
+		})
+	}
+
+	var entries []models.Watchlist
+	if err := utils.KeysetPage(scope.Session(&gorm.Session{}).Preload("Coin"), pagination, cursor, "watchlists.position", "watchlists.id", false).
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch watchlist",
+		})
+	}
+
+	entries, more := utils.TrimPage(entries, pagination)
+	var next string
+	if more {
+		last := entries[len(entries)-1]
+		next = utils.NewCursor(last.Position, last.ID)
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"watchlist_id": group.ID,
+			"entries":      entries,
+			"totals":       totals,
+			"pagination":   utils.KeysetMeta(pagination, cursor, int64(totals["count"]), next),
+		},
+	})
+}
+
+func CreateWatchlist(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.WatchlistRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	group, err := services.CreateWatchlist(userID, req.Name)
+	if err != nil {
+		return serviceError(c, err, "Failed to create watchlist")
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
 		Success: true,
-		Message: "Added to watchlist successfully",
-		Data:    watchlist,
+		Message: "Watchlist created successfully",
+		Data:    group,
 	})
 }
 
-func RemoveFromWatchlist(c *fiber.Ctx) error {
+func RenameWatchlist(c *fiber.Ctx) error {
 	userID := middlewares.GetUserIDFromContext(c)
 	if userID == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
@@ -109,25 +296,240 @@ func RemoveFromWatchlist(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if watchlist item exists and belongs to user
-	var watchlist models.Watchlist
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&watchlist).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(models.ApiResponse{
+	var req models.WatchlistRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Watchlist item not found",
+			Error:   "Invalid request body",
 		})
 	}
 
-	// Remove from watchlist
-	if err := database.DB.Delete(&watchlist).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+	group, err := services.RenameWatchlist(userID, uint(id), req.Name)
+	if err != nil {
+		return serviceError(c, err, "Failed to rename watchlist")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Watchlist renamed successfully",
+		Data:    group,
+	})
+}
+
+func DeleteWatchlist(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
 			Success: false,
-			Error:   "Failed to remove from watchlist",
+			Error:   "Unauthorized",
 		})
 	}
 
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid watchlist ID",
+		})
+	}
+
+	if err := services.DeleteWatchlist(userID, uint(id)); err != nil {
+		return serviceError(c, err, "Failed to delete watchlist")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Watchlist deleted successfully",
+	})
+}
+
+func AddWatchlistItem(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	group, err := paramWatchlist(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	var req models.WatchlistEntryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	entry, err := services.AddWatchlistEntry(*group, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to add to watchlist")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Added to watchlist successfully",
+		Data:    entry,
+	})
+}
+
+func UpdateWatchlistItem(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	group, err := paramWatchlist(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	itemID, err := strconv.ParseUint(c.Params("itemId"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid watchlist item ID",
+		})
+	}
+
+	var req models.WatchlistEntryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	entry, err := services.UpdateWatchlistEntry(*group, uint(itemID), req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update watchlist item")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Watchlist item updated successfully",
+		Data:    entry,
+	})
+}
+
+func RemoveWatchlistItem(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	group, err := paramWatchlist(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	itemID, err := strconv.ParseUint(c.Params("itemId"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid watchlist item ID",
+		})
+	}
+
+	if err := services.RemoveWatchlistEntry(userID, group.ID, uint(itemID)); err != nil {
+		return serviceError(c, err, "Failed to remove from watchlist")
+	}
+
 	return c.JSON(models.ApiResponse{
 		Success: true,
 		Message: "Removed from watchlist successfully",
 	})
 }
+
+// BulkUpdateWatchlist adds and removes several coins at once, e.g.
+// {"add": [1, 2], "remove": [3]}.
+func BulkUpdateWatchlist(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	group, err := paramWatchlist(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	var req models.WatchlistBulkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	added, removed, err := services.BulkUpdateWatchlist(*group, req.Add, req.Remove)
+	if err != nil {
+		return serviceError(c, err, "Failed to update watchlist")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Watchlist updated successfully",
+		Data: fiber.Map{
+			"added":   added,
+			"removed": removed,
+		},
+	})
+}
+
+func ReorderWatchlist(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	group, err := paramWatchlist(c, userID)
+	if err != nil {
+		return serviceError(c, err, "Failed to fetch watchlist")
+	}
+
+	var req models.WatchlistOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	entries, err := services.ReorderWatchlist(*group, req.EntryIDs)
+	if err != nil {
+		return serviceError(c, err, "Failed to reorder watchlist")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Watchlist reordered successfully",
+		Data:    entries,
+	})
+}
+
+// paramWatchlist resolves the :id route parameter to one of the user's
+// watchlists.
+func paramWatchlist(c *fiber.Ctx, userID uint) (*models.WatchlistGroup, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil || id == 0 {
+		return nil, services.ErrWatchlistNotFound
+	}
+	return services.ResolveWatchlist(userID, uint(id))
+}
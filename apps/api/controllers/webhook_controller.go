@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/middlewares"
+	"crypto-app-api/models"
+	"crypto-app-api/services"
+	"crypto-app-api/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetWebhooks(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&endpoints).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch webhooks",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data:    endpoints,
+	})
+}
+
+// CreateWebhook registers an endpoint. The signing secret is only returned
+// here and from RotateWebhookSecret.
+func CreateWebhook(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	var req models.WebhookEndpointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	endpoint, err := services.CreateWebhookEndpoint(userID, req)
+	if err != nil {
+		return serviceError(c, err, "Failed to create webhook")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ApiResponse{
+		Success: true,
+		Message: "Webhook created successfully",
+		Data: fiber.Map{
+			"webhook": endpoint,
+			"secret":  endpoint.Secret,
+		},
+	})
+}
+
+func UpdateWebhook(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid webhook ID",
+		})
+	}
+
+	var req models.WebhookEndpointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+	}
+
+	endpoint, err := services.UpdateWebhookEndpoint(userID, uint(id), req)
+	if err != nil {
+		return serviceError(c, err, "Failed to update webhook")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Webhook updated successfully",
+		Data:    endpoint,
+	})
+}
+
+func RotateWebhookSecret(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid webhook ID",
+		})
+	}
+
+	endpoint, err := services.RotateWebhookSecret(userID, uint(id))
+	if err != nil {
+		return serviceError(c, err, "Failed to rotate webhook secret")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Webhook secret rotated successfully",
+		Data: fiber.Map{
+			"webhook": endpoint,
+			"secret":  endpoint.Secret,
+		},
+	})
+}
+
+func DeleteWebhook(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid webhook ID",
+		})
+	}
+
+	if err := services.DeleteWebhookEndpoint(userID, uint(id)); err != nil {
+		return serviceError(c, err, "Failed to delete webhook")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Webhook deleted successfully",
+	})
+}
+
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid webhook ID",
+		})
+	}
+
+	var endpoint models.WebhookEndpoint
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&endpoint).Error; err != nil {
+		return serviceError(c, services.ErrWebhookNotFound, "")
+	}
+
+	pagination := utils.ParsePagination(c, 20, 100)
+
+	query := database.DB.Model(&models.WebhookDelivery{}).Where("endpoint_id = ?", endpoint.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at desc").
+		Offset(pagination.Offset()).
+		Limit(pagination.Limit).
+		Find(&deliveries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Failed to fetch webhook deliveries",
+		})
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Data: fiber.Map{
+			"deliveries": deliveries,
+			"pagination": pagination.Meta(total),
+		},
+	})
+}
+
+func RedeliverWebhook(c *fiber.Ctx) error {
+	userID := middlewares.GetUserIDFromContext(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid webhook ID",
+		})
+	}
+	deliveryID, err := strconv.ParseUint(c.Params("deliveryId"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ApiResponse{
+			Success: false,
+			Error:   "Invalid delivery ID",
+		})
+	}
+
+	delivery, err := services.RedeliverWebhook(userID, uint(id), uint(deliveryID))
+	if err != nil {
+		return serviceError(c, err, "Failed to redeliver webhook")
+	}
+
+	return c.JSON(models.ApiResponse{
+		Success: true,
+		Message: "Webhook redelivered",
+		Data:    delivery,
+	})
+}
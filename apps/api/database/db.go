@@ -34,16 +34,69 @@ func InitDB() {
 	// Auto migrate the schema
 	err = DB.AutoMigrate(
 		&models.User{},
+		&models.Portfolio{},
 		&models.Coin{},
 		&models.UserCoin{},
 		&models.Trade{},
 		&models.Watchlist{},
+		&models.WatchlistGroup{},
+		&models.FiatBalance{},
+		&models.FxRate{},
+		&models.Transfer{},
+		&models.AccountReset{},
+		&models.RecurringOrder{},
+		&models.RecurringOrderRun{},
+		&models.TargetAllocation{},
+		&models.RebalanceSettings{},
+		&models.RebalanceRun{},
+		&models.PriceHistory{},
+		&models.AlertRule{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.PortfolioSnapshot{},
+		&models.Benchmark{},
+		&models.BenchmarkComponent{},
+		&models.TaxLot{},
+		&models.LotDisposal{},
+		&models.Backtest{},
+		&models.Bot{},
+		&models.BotLog{},
+		&models.Competition{},
+		&models.CompetitionEntry{},
+		&models.CompetitionSnapshot{},
+		&models.Profile{},
+		&models.Follow{},
+		&models.CopyTrading{},
+		&models.MarginAccount{},
+		&models.MarginLeverage{},
+		&models.MarginPosition{},
+		&models.FuturesPosition{},
+		&models.FundingRate{},
+		&models.FundingPayment{},
 	)
 
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	if err := migrateDefaultPortfolios(); err != nil {
+		log.Fatal("Failed to migrate default portfolios:", err)
+	}
+
+	if err := migrateWatchlistGroups(); err != nil {
+		log.Fatal("Failed to migrate watchlists:", err)
+	}
+
+	if err := migrateCoinCategories(); err != nil {
+		log.Fatal("Failed to migrate coin categories:", err)
+	}
+
+	if err := migrateTaxLots(); err != nil {
+		log.Fatal("Failed to migrate tax lots:", err)
+	}
+
 	log.Println("Database migrated successfully")
 }
 
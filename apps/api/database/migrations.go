@@ -0,0 +1,123 @@
+package database
+
+import (
+	"crypto-app-api/models"
+	"fmt"
+)
+
+// portfolioOwnedTables are the tables whose rows belong to a portfolio.
+var portfolioOwnedTables = []string{
+	"user_coins",
+	"trades",
+	"fiat_balances",
+	"transfers",
+	"account_resets",
+}
+
+// migrateDefaultPortfolios gives every user a default portfolio holding the
+// cash that used to live on users.balance, and attaches existing holdings,
+// trades and other portfolio-owned rows to it. It is safe to run repeatedly.
+func migrateDefaultPortfolios() error {
+	balanceExpr := fmt.Sprintf("%f", models.DefaultStartingBalance)
+	if DB.Migrator().HasColumn("users", "balance") {
+		balanceExpr = fmt.Sprintf("COALESCE(u.balance, %f)", models.DefaultStartingBalance)
+	}
+
+	if err := DB.Exec(`
+		INSERT INTO portfolios (user_id, name, is_default, balance, created_at, updated_at)
+		SELECT u.id, 'Main', true, ` + balanceExpr + `, NOW(), NOW()
+		FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM portfolios p WHERE p.user_id = u.id AND p.is_default)`).Error; err != nil {
+		return err
+	}
+
+	for _, table := range portfolioOwnedTables {
+		if err := DB.Exec(`
+			UPDATE ` + table + ` t SET portfolio_id = p.id
+			FROM portfolios p
+			WHERE p.user_id = t.user_id AND p.is_default AND (t.portfolio_id IS NULL OR t.portfolio_id = 0)`).Error; err != nil {
+			return err
+		}
+	}
+
+	// Per-user uniqueness from infra/db/init.sql and earlier schemas would
+	// stop the same coin being held in two portfolios
+	for _, stmt := range []string{
+		"ALTER TABLE user_coins DROP CONSTRAINT IF EXISTS user_coins_user_id_coin_id_key",
+		"ALTER TABLE watchlists DROP CONSTRAINT IF EXISTS watchlists_user_id_coin_id_key",
+		"DROP INDEX IF EXISTS idx_fiat_balances_user_currency",
+	} {
+		if err := DB.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateWatchlistGroups moves the single per-user watchlist onto a default
+// named list. Entries for the same coin that portfolio-scoped watchlists
+// allowed are collapsed into one, keeping the oldest. It is safe to run
+// repeatedly.
+func migrateWatchlistGroups() error {
+	for _, stmt := range []string{
+		`INSERT INTO watchlist_groups (user_id, name, is_default, created_at, updated_at)
+		SELECT u.id, 'Watchlist', true, NOW(), NOW()
+		FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM watchlist_groups g WHERE g.user_id = u.id AND g.is_default)`,
+
+		`DELETE FROM watchlists w
+		USING watchlists older
+		WHERE (w.group_id IS NULL OR w.group_id = 0)
+			AND older.user_id = w.user_id AND older.coin_id = w.coin_id AND older.id < w.id`,
+
+		`UPDATE watchlists w SET group_id = g.id, position = r.position
+		FROM watchlist_groups g, (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at, id) - 1 AS position
+			FROM watchlists
+			WHERE group_id IS NULL OR group_id = 0
+		) r
+		WHERE r.id = w.id AND g.user_id = w.user_id AND g.is_default`,
+
+		// At most one default list per user
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_watchlist_groups_default ON watchlist_groups (user_id) WHERE is_default`,
+	} {
+		if err := DB.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCoinCategories fills in categories for the sample coins seeded by
+// infra/db/init.sql before coins had one. Categories set since are kept.
+func migrateCoinCategories() error {
+	return DB.Exec(`
+		UPDATE coins SET category = CASE symbol
+			WHEN 'BTC' THEN 'currency'
+			WHEN 'LTC' THEN 'currency'
+			WHEN 'ETH' THEN 'layer-1'
+			WHEN 'ADA' THEN 'layer-1'
+			WHEN 'DOT' THEN 'layer-1'
+			WHEN 'SOL' THEN 'layer-1'
+			WHEN 'MATIC' THEN 'layer-2'
+			WHEN 'BNB' THEN 'exchange'
+			WHEN 'XRP' THEN 'payments'
+			WHEN 'LINK' THEN 'oracle'
+		END
+		WHERE (category IS NULL OR category = '')
+			AND symbol IN ('BTC', 'LTC', 'ETH', 'ADA', 'DOT', 'SOL', 'MATIC', 'BNB', 'XRP', 'LINK')`).Error
+}
+
+// migrateTaxLots opens a lot for each holding that predates tax lot
+// tracking, at the holding's average price. Holdings that already have lots
+// are left alone, so it is safe to run repeatedly.
+func migrateTaxLots() error {
+	return DB.Exec(`
+		INSERT INTO tax_lots (user_id, portfolio_id, coin_id, source, quantity, remaining, cost_basis, acquired_at, created_at, updated_at)
+		SELECT uc.user_id, uc.portfolio_id, uc.coin_id, 'opening', uc.quantity, uc.quantity, uc.average_price,
+			COALESCE(uc.created_at, NOW()), NOW(), NOW()
+		FROM user_coins uc
+		WHERE uc.quantity > 0
+			AND NOT EXISTS (SELECT 1 FROM tax_lots l WHERE l.portfolio_id = uc.portfolio_id AND l.coin_id = uc.coin_id)`).Error
+}
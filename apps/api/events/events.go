@@ -0,0 +1,106 @@
+// Package events is the in-process publisher subsystems use to announce
+// things that happened to a user, such as a filled trade or a triggered
+// alert. Consumers like the notification inbox subscribe to the types they
+// care about instead of being called directly.
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	TradeExecuted    = "trade.executed"
+	AlertTriggered   = "alert.triggered"
+	BalanceChanged   = "balance.changed"
+	MarginCall       = "margin.call"
+	MarginLiquidated = "margin.liquidated"
+)
+
+// PricesUpdated is published with the updated []models.Coin after each price
+// update. It concerns no user, so it is not one of Types and cannot be
+// subscribed to through notifications or webhooks.
+const PricesUpdated = "prices.updated"
+
+// Types lists every user event type that can be published.
+var Types = []string{TradeExecuted, AlertTriggered, BalanceChanged, MarginCall, MarginLiquidated}
+
+// Event is something that happened to a user. ReferenceID is the ID of the
+// record the event is about (a trade, alert rule or transfer) and Data holds
+// that record for consumers that forward it on.
+type Event struct {
+	Type        string      `json:"type"`
+	UserID      uint        `json:"user_id"`
+	Title       string      `json:"title"`
+	Message     string      `json:"message"`
+	ReferenceID uint        `json:"reference_id,omitempty"`
+	Data        interface{} `json:"data,omitempty"`
+	OccurredAt  time.Time   `json:"occurred_at"`
+}
+
+// Handler consumes published events.
+type Handler func(Event)
+
+type subscription struct {
+	types   map[string]bool
+	handler Handler
+}
+
+var (
+	mu            sync.RWMutex
+	subscriptions []subscription
+)
+
+// IsValidType reports whether t is a known event type.
+func IsValidType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe registers handler for the given event types, or for every type
+// when none are given.
+func Subscribe(handler Handler, types ...string) {
+	sub := subscription{handler: handler}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	subscriptions = append(subscriptions, sub)
+}
+
+// Publish hands event to every matching subscriber. Handlers run in their own
+// goroutines so publishers are never slowed down or broken by a consumer;
+// publish only after the change being announced has been committed.
+func Publish(event Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, sub := range subscriptions {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		go dispatch(sub.handler, event)
+	}
+}
+
+func dispatch(handler Handler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Handler for %s event panicked: %v", event.Type, r)
+		}
+	}()
+	handler(event)
+}
@@ -0,0 +1,221 @@
+// Package indicators computes technical indicators over price series.
+//
+// Every function takes a series ordered oldest first and returns one value
+// per input point from the first point with enough data onwards, so the
+// result lines up with the tail of the input: result[i] belongs to
+// input[len(input)-len(result)+i].
+package indicators
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	ErrInvalidPeriod    = errors.New("Invalid indicator period")
+	ErrInsufficientData = errors.New("Not enough price history for this indicator")
+)
+
+// SMA is the simple moving average over period points.
+func SMA(values []float64, period int) ([]float64, error) {
+	if err := check(len(values), period, period); err != nil {
+		return nil, err
+	}
+
+	result := make([]float64, 0, len(values)-period+1)
+	sum := 0.0
+	for i, value := range values {
+		sum += value
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			result = append(result, sum/float64(period))
+		}
+	}
+	return result, nil
+}
+
+// EMA is the exponential moving average with smoothing 2/(period+1), seeded
+// with the SMA of the first period points.
+func EMA(values []float64, period int) ([]float64, error) {
+	if err := check(len(values), period, period); err != nil {
+		return nil, err
+	}
+
+	k := 2 / float64(period+1)
+	ema := 0.0
+	for _, value := range values[:period] {
+		ema += value
+	}
+	ema /= float64(period)
+
+	result := make([]float64, 0, len(values)-period+1)
+	result = append(result, ema)
+	for _, value := range values[period:] {
+		ema = value*k + ema*(1-k)
+		result = append(result, ema)
+	}
+	return result, nil
+}
+
+// RSI is Wilder's relative strength index, from 0 to 100.
+func RSI(values []float64, period int) ([]float64, error) {
+	if err := check(len(values), period, period+1); err != nil {
+		return nil, err
+	}
+
+	var avgGain, avgLoss float64
+	for i := 1; i <= period; i++ {
+		gain, loss := change(values[i-1], values[i])
+		avgGain += gain
+		avgLoss += loss
+	}
+	avgGain /= float64(period)
+	avgLoss /= float64(period)
+
+	result := make([]float64, 0, len(values)-period)
+	result = append(result, rsi(avgGain, avgLoss))
+	for i := period + 1; i < len(values); i++ {
+		gain, loss := change(values[i-1], values[i])
+		avgGain = (avgGain*float64(period-1) + gain) / float64(period)
+		avgLoss = (avgLoss*float64(period-1) + loss) / float64(period)
+		result = append(result, rsi(avgGain, avgLoss))
+	}
+	return result, nil
+}
+
+func change(previous, current float64) (gain, loss float64) {
+	if current > previous {
+		return current - previous, 0
+	}
+	return 0, previous - current
+}
+
+func rsi(avgGain, avgLoss float64) float64 {
+	if avgLoss == 0 {
+		if avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+avgGain/avgLoss)
+}
+
+// MACDResult holds the MACD line, its signal line and their difference,
+// all the same length.
+type MACDResult struct {
+	MACD      []float64
+	Signal    []float64
+	Histogram []float64
+}
+
+// MACD is the difference between the fast and slow EMAs, with an EMA of
+// that difference as the signal line.
+func MACD(values []float64, fast, slow, signal int) (*MACDResult, error) {
+	if fast < 1 || signal < 1 || slow <= fast {
+		return nil, ErrInvalidPeriod
+	}
+
+	fastEMA, err := EMA(values, fast)
+	if err != nil {
+		return nil, err
+	}
+	slowEMA, err := EMA(values, slow)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := len(fastEMA) - len(slowEMA)
+	line := make([]float64, len(slowEMA))
+	for i := range slowEMA {
+		line[i] = fastEMA[offset+i] - slowEMA[i]
+	}
+
+	signalLine, err := EMA(line, signal)
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[len(line)-len(signalLine):]
+	histogram := make([]float64, len(signalLine))
+	for i := range signalLine {
+		histogram[i] = line[i] - signalLine[i]
+	}
+	return &MACDResult{MACD: line, Signal: signalLine, Histogram: histogram}, nil
+}
+
+// BandsResult holds Bollinger Bands, all the same length.
+type BandsResult struct {
+	Middle []float64
+	Upper  []float64
+	Lower  []float64
+}
+
+// Bollinger is the period SMA with bands width population standard
+// deviations above and below it.
+func Bollinger(values []float64, period int, width float64) (*BandsResult, error) {
+	middle, err := SMA(values, period)
+	if err != nil {
+		return nil, err
+	}
+
+	bands := &BandsResult{
+		Middle: middle,
+		Upper:  make([]float64, len(middle)),
+		Lower:  make([]float64, len(middle)),
+	}
+	for i, mean := range middle {
+		variance := 0.0
+		for _, value := range values[i : i+period] {
+			variance += (value - mean) * (value - mean)
+		}
+		deviation := math.Sqrt(variance / float64(period))
+		bands.Upper[i] = mean + width*deviation
+		bands.Lower[i] = mean - width*deviation
+	}
+	return bands, nil
+}
+
+// VWAP is the volume weighted average price over a rolling window of period
+// points. Windows with no volume fall back to the plain average price.
+func VWAP(prices, volumes []float64, period int) ([]float64, error) {
+	if len(prices) != len(volumes) {
+		return nil, errors.New("Prices and volumes must be the same length")
+	}
+	if err := check(len(prices), period, period); err != nil {
+		return nil, err
+	}
+
+	result := make([]float64, 0, len(prices)-period+1)
+	var weighted, volume, sum float64
+	for i := range prices {
+		weighted += prices[i] * volumes[i]
+		volume += volumes[i]
+		sum += prices[i]
+		if i >= period {
+			weighted -= prices[i-period] * volumes[i-period]
+			volume -= volumes[i-period]
+			sum -= prices[i-period]
+		}
+		if i < period-1 {
+			continue
+		}
+		if volume > 0 {
+			result = append(result, weighted/volume)
+		} else {
+			result = append(result, sum/float64(period))
+		}
+	}
+	return result, nil
+}
+
+func check(length, period, required int) error {
+	if period < 1 {
+		return ErrInvalidPeriod
+	}
+	if length < required {
+		return ErrInsufficientData
+	}
+	return nil
+}
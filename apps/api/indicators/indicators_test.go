@@ -0,0 +1,214 @@
+package indicators
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// Closing prices and 10-day averages from the StockCharts moving average
+// worked example, rounded to two decimals.
+var (
+	stockChartsCloses = []float64{
+		22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+		22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+		23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+	}
+	stockChartsSMA10 = []float64{
+		22.22, 22.21, 22.23, 22.26, 22.30, 22.42, 22.61, 22.77, 22.91, 23.08, 23.21,
+		23.38, 23.53, 23.65, 23.71, 23.68, 23.61, 23.51, 23.43, 23.28, 23.13,
+	}
+	stockChartsEMA10 = []float64{
+		22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28, 23.34,
+		23.43, 23.51, 23.53, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08, 22.92,
+	}
+)
+
+// Closing prices and 14-day RSI from Wilder's worked example as published by
+// StockCharts. The published closes carry four decimals; rounding them to two
+// here moves the RSI by less than 0.1.
+var (
+	wilderCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+		46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+		43.42, 42.66, 43.13,
+	}
+	wilderRSI14 = []float64{
+		70.53, 66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38,
+		54.71, 50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77,
+	}
+)
+
+func assertSeries(t *testing.T, name string, got, want []float64, tolerance float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s returned %d points, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > tolerance {
+			t.Errorf("%s[%d] = %.4f, want %.4f", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestMovingAverages(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        func([]float64, int) ([]float64, error)
+		values    []float64
+		period    int
+		want      []float64
+		tolerance float64
+	}{
+		{"SMA", SMA, []float64{1, 2, 3, 4, 5, 6}, 3, []float64{2, 3, 4, 5}, 1e-9},
+		{"SMA period 1", SMA, []float64{4, 8, 15}, 1, []float64{4, 8, 15}, 1e-9},
+		{"SMA StockCharts", SMA, stockChartsCloses, 10, stockChartsSMA10, 0.006},
+		{"EMA", EMA, []float64{2, 4, 6, 8, 10}, 3, []float64{4, 6, 8}, 1e-9},
+		{"EMA constant", EMA, []float64{5, 5, 5, 5, 5}, 2, []float64{5, 5, 5, 5}, 1e-9},
+		{"EMA StockCharts", EMA, stockChartsCloses, 10, stockChartsEMA10, 0.006},
+		{"RSI Wilder", RSI, wilderCloses, 14, wilderRSI14, 0.1},
+		{"RSI rising", RSI, []float64{1, 2, 3, 4}, 3, []float64{100}, 1e-9},
+		{"RSI falling", RSI, []float64{4, 3, 2, 1, 0}, 3, []float64{0, 0}, 1e-9},
+		{"RSI flat", RSI, []float64{7, 7, 7}, 2, []float64{50}, 1e-9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fn(tt.values, tt.period)
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			assertSeries(t, tt.name, got, tt.want, tt.tolerance)
+		})
+	}
+}
+
+func TestIndicatorErrors(t *testing.T) {
+	short := []float64{1, 2, 3}
+	tests := []struct {
+		name string
+		fn   func() error
+		want error
+	}{
+		{"SMA short history", func() error { _, err := SMA(short, 4); return err }, ErrInsufficientData},
+		{"SMA zero period", func() error { _, err := SMA(short, 0); return err }, ErrInvalidPeriod},
+		{"EMA short history", func() error { _, err := EMA(nil, 2); return err }, ErrInsufficientData},
+		{"EMA negative period", func() error { _, err := EMA(short, -1); return err }, ErrInvalidPeriod},
+		// RSI needs one more point than its period for the first change
+		{"RSI short history", func() error { _, err := RSI(short, 3); return err }, ErrInsufficientData},
+		{"RSI zero period", func() error { _, err := RSI(short, 0); return err }, ErrInvalidPeriod},
+		{"MACD slow not above fast", func() error { _, err := MACD(short, 3, 3, 2); return err }, ErrInvalidPeriod},
+		{"MACD zero signal", func() error { _, err := MACD(short, 1, 2, 0); return err }, ErrInvalidPeriod},
+		{"MACD short history", func() error { _, err := MACD(stockChartsCloses, 12, 26, 9); return err }, ErrInsufficientData},
+		{"Bollinger short history", func() error { _, err := Bollinger(short, 4, 2); return err }, ErrInsufficientData},
+		{"VWAP short history", func() error { _, err := VWAP(short, []float64{1, 1, 1}, 4); return err }, ErrInsufficientData},
+		{"VWAP zero period", func() error { _, err := VWAP(short, []float64{1, 1, 1}, 0); return err }, ErrInvalidPeriod},
+	}
+	for _, tt := range tests {
+		if err := tt.fn(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := VWAP(short, []float64{1, 1}, 2); err == nil {
+		t.Error("VWAP with mismatched volumes: error = nil")
+	}
+}
+
+func TestMACD(t *testing.T) {
+	values := append(append([]float64{}, stockChartsCloses...), wilderCloses...)
+	result, err := MACD(values, 12, 26, 9)
+	if err != nil {
+		t.Fatalf("MACD() error = %v", err)
+	}
+
+	// The signal line needs signal points of the MACD line, which starts at
+	// the slow EMA's first point.
+	wantLength := len(values) - 26 - 9 + 2
+	if len(result.MACD) != wantLength || len(result.Signal) != wantLength || len(result.Histogram) != wantLength {
+		t.Fatalf("MACD() lengths = %d/%d/%d, want %d", len(result.MACD), len(result.Signal), len(result.Histogram), wantLength)
+	}
+
+	fast, _ := EMA(values, 12)
+	slow, _ := EMA(values, 26)
+	line := make([]float64, len(slow))
+	for i := range slow {
+		line[i] = fast[len(fast)-len(slow)+i] - slow[i]
+	}
+	signal, _ := EMA(line, 9)
+	assertSeries(t, "MACD", result.MACD, line[len(line)-len(signal):], 1e-9)
+	assertSeries(t, "Signal", result.Signal, signal, 1e-9)
+	for i := range result.Histogram {
+		if want := result.MACD[i] - result.Signal[i]; math.Abs(result.Histogram[i]-want) > 1e-9 {
+			t.Errorf("Histogram[%d] = %.6f, want %.6f", i, result.Histogram[i], want)
+		}
+	}
+
+	// A flat series has no momentum at all
+	flat := make([]float64, 40)
+	for i := range flat {
+		flat[i] = 100
+	}
+	result, err = MACD(flat, 12, 26, 9)
+	if err != nil {
+		t.Fatalf("MACD(flat) error = %v", err)
+	}
+	for i := range result.MACD {
+		if result.MACD[i] != 0 || result.Signal[i] != 0 || result.Histogram[i] != 0 {
+			t.Fatalf("MACD(flat)[%d] = %v/%v/%v, want zeros", i, result.MACD[i], result.Signal[i], result.Histogram[i])
+		}
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		period int
+		width  float64
+		middle []float64
+		upper  []float64
+		lower  []float64
+	}{
+		// Mean 5 and population standard deviation 2
+		{"textbook", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 8, 2, []float64{5}, []float64{9}, []float64{1}},
+		{"flat", []float64{3, 3, 3, 3}, 2, 2, []float64{3, 3, 3}, []float64{3, 3, 3}, []float64{3, 3, 3}},
+		{"rolling", []float64{1, 3, 3, 7}, 2, 1, []float64{2, 3, 5}, []float64{3, 3, 7}, []float64{1, 3, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bands, err := Bollinger(tt.values, tt.period, tt.width)
+			if err != nil {
+				t.Fatalf("Bollinger() error = %v", err)
+			}
+			assertSeries(t, "Middle", bands.Middle, tt.middle, 1e-9)
+			assertSeries(t, "Upper", bands.Upper, tt.upper, 1e-9)
+			assertSeries(t, "Lower", bands.Lower, tt.lower, 1e-9)
+		})
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	tests := []struct {
+		name    string
+		prices  []float64
+		volumes []float64
+		period  int
+		want    []float64
+	}{
+		{"weighted", []float64{10, 20, 30}, []float64{1, 3, 0}, 2, []float64{17.5, 20}},
+		{"full window", []float64{10, 11, 12, 13}, []float64{100, 200, 300, 400}, 4, []float64{12}},
+		{"zero volume", []float64{10, 20, 30}, []float64{0, 0, 0}, 2, []float64{15, 25}},
+		// The window falls back to the plain average only while it has no volume
+		{"volume leaves the window", []float64{10, 20, 30, 40}, []float64{5, 0, 0, 2}, 2, []float64{10, 25, 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VWAP(tt.prices, tt.volumes, tt.period)
+			if err != nil {
+				t.Fatalf("VWAP() error = %v", err)
+			}
+			assertSeries(t, "VWAP", got, tt.want, 1e-9)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	AlertPriceAbove    = "price_above"
+	AlertPriceBelow    = "price_below"
+	AlertPercentChange = "percent_change"
+	AlertVolumeSpike   = "volume_spike"
+
+	AlertModeOnce   = "once"
+	AlertModeRepeat = "repeat"
+
+	AlertStatusActive    = "active"
+	AlertStatusTriggered = "triggered"
+	AlertStatusDisabled  = "disabled"
+
+	ChannelInbox   = "inbox"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// AlertRule watches a coin and notifies its owner when Condition is met.
+// Threshold is a price for price_above/price_below, a signed percentage over
+// WindowMinutes for percent_change, and a multiple of the window's average
+// volume for volume_spike. Channels is a comma-separated list of delivery
+// channels.
+type AlertRule struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	CoinID          uint       `json:"coin_id" gorm:"not null;index"`
+	Condition       string     `json:"condition" gorm:"not null"`
+	Threshold       float64    `json:"threshold" gorm:"not null"`
+	WindowMinutes   int        `json:"window_minutes" gorm:"default:60"`
+	Mode            string     `json:"mode" gorm:"not null;default:'once'"`
+	CooldownMinutes int        `json:"cooldown_minutes" gorm:"default:60"`
+	Channels        string     `json:"channels" gorm:"not null;default:'inbox'"`
+	WebhookURL      string     `json:"webhook_url,omitempty"`
+	Status          string     `json:"status" gorm:"not null;default:'active';index"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+	TriggerCount    int        `json:"trigger_count" gorm:"default:0"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Relations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+// ChannelList returns the rule's delivery channels.
+func (r AlertRule) ChannelList() []string {
+	var channels []string
+	for _, channel := range strings.Split(r.Channels, ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+func (AlertRule) TableName() string {
+	return "alert_rules"
+}
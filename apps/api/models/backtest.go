@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	BacktestPending   = "pending"
+	BacktestRunning   = "running"
+	BacktestCompleted = "completed"
+	BacktestFailed    = "failed"
+)
+
+// Backtest replays a strategy over a coin's stored price history. It is run
+// asynchronously by a background job; Params and Result are stored as JSON.
+// FeeRate and Slippage are percentages of each fill.
+type Backtest struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	CoinID      uint       `json:"coin_id" gorm:"not null"`
+	Strategy    string     `json:"strategy" gorm:"not null"`
+	Params      string     `json:"-" gorm:"type:text"`
+	Interval    string     `json:"interval" gorm:"not null"`
+	StartAt     time.Time  `json:"start_at" gorm:"not null"`
+	EndAt       time.Time  `json:"end_at" gorm:"not null"`
+	InitialCash float64    `json:"initial_cash" gorm:"not null"`
+	FeeRate     float64    `json:"fee_rate"`
+	Slippage    float64    `json:"slippage"`
+	Status      string     `json:"status" gorm:"not null;default:'pending';index"`
+	Error       string     `json:"error,omitempty"`
+	Result      string     `json:"-" gorm:"type:text"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+func (Backtest) TableName() string {
+	return "backtests"
+}
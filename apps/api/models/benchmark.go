@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	BenchmarkCoin        = "coin"
+	BenchmarkMarketCap   = "market_cap"
+	BenchmarkEqualWeight = "equal_weight"
+	BenchmarkBasket      = "basket"
+)
+
+// Benchmark is a user-defined basket of coins with fixed percentage weights
+// that portfolio returns can be compared against. Single-coin and index
+// benchmarks are built in and not stored.
+type Benchmark struct {
+	ID         uint                 `json:"id" gorm:"primaryKey"`
+	UserID     uint                 `json:"user_id" gorm:"not null;index"`
+	Name       string               `json:"name" gorm:"not null"`
+	Components []BenchmarkComponent `json:"components" gorm:"foreignKey:BenchmarkID"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+// BenchmarkComponent is one coin's weight in a benchmark basket, in percent.
+type BenchmarkComponent struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	BenchmarkID uint    `json:"benchmark_id" gorm:"not null;uniqueIndex:idx_benchmark_components_benchmark_coin"`
+	CoinID      uint    `json:"coin_id" gorm:"not null;uniqueIndex:idx_benchmark_components_benchmark_coin"`
+	Weight      float64 `json:"weight" gorm:"not null"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+func (Benchmark) TableName() string {
+	return "benchmarks"
+}
+
+func (BenchmarkComponent) TableName() string {
+	return "benchmark_components"
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	BotRunning = "running"
+	BotStopped = "stopped"
+
+	BotLogInfo    = "info"
+	BotLogTrade   = "trade"
+	BotLogWarning = "warning"
+	BotLogError   = "error"
+)
+
+// Bot runs a strategy against a paper portfolio. It keeps its own book:
+// Cash starts at Budget and, with Quantity and AveragePrice, tracks only
+// what the bot itself bought and sold. MaxPosition caps the value of its
+// position and MaxDailyLoss pauses it until the next UTC day once its
+// equity has fallen that far since the day started; zero disables a limit.
+// Params are stored as JSON.
+type Bot struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	PortfolioID    uint       `json:"portfolio_id" gorm:"not null"`
+	CoinID         uint       `json:"coin_id" gorm:"not null"`
+	Name           string     `json:"name" gorm:"not null"`
+	Strategy       string     `json:"strategy" gorm:"not null"`
+	Params         string     `json:"-" gorm:"type:text"`
+	Interval       string     `json:"interval" gorm:"not null"`
+	Status         string     `json:"status" gorm:"not null;default:'stopped';index"`
+	Budget         float64    `json:"budget" gorm:"not null"`
+	MaxPosition    float64    `json:"max_position"`
+	MaxDailyLoss   float64    `json:"max_daily_loss"`
+	Cash           float64    `json:"cash"`
+	Quantity       float64    `json:"quantity"`
+	AveragePrice   float64    `json:"average_price"`
+	DayStartEquity float64    `json:"day_start_equity"`
+	DayStartedAt   *time.Time `json:"day_started_at,omitempty"`
+	PausedUntil    *time.Time `json:"paused_until,omitempty"`
+	LastBarAt      *time.Time `json:"last_bar_at,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+// BotLog is one entry of a bot's activity log.
+type BotLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BotID     uint      `json:"bot_id" gorm:"not null;index"`
+	Level     string    `json:"level" gorm:"not null"`
+	Message   string    `json:"message" gorm:"type:text;not null"`
+	TradeID   *uint     `json:"trade_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Bot) TableName() string {
+	return "bots"
+}
+
+func (BotLog) TableName() string {
+	return "bot_logs"
+}
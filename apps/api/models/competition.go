@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	CompetitionMetricReturn = "return"
+	CompetitionMetricSharpe = "sharpe"
+
+	CompetitionUpcoming = "upcoming"
+	CompetitionActive   = "active"
+	CompetitionClosing  = "closing"
+	CompetitionFinished = "finished"
+)
+
+// Competition is a paper-trading contest. Each entrant trades an isolated
+// contest portfolio funded with StartingBalance, limited to AllowedCoins
+// (stored as a JSON list of coin IDs; empty allows every coin) between
+// StartAt and EndAt. Entrants are ranked by Metric; standings are frozen
+// into the entries once the competition is finalized after it closes.
+type Competition struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	CreatedBy       uint       `json:"created_by" gorm:"not null;index"`
+	Name            string     `json:"name" gorm:"not null"`
+	Description     string     `json:"description" gorm:"type:text"`
+	StartAt         time.Time  `json:"start_at" gorm:"not null;index"`
+	EndAt           time.Time  `json:"end_at" gorm:"not null;index"`
+	StartingBalance float64    `json:"starting_balance" gorm:"not null"`
+	AllowedCoins    string     `json:"-" gorm:"type:text"`
+	Metric          string     `json:"metric" gorm:"not null;default:'return'"`
+	SnapshotAt      *time.Time `json:"-"`
+	FinalizedAt     *time.Time `json:"finalized_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (Competition) TableName() string {
+	return "competitions"
+}
+
+// Status reports where the competition is in its lifecycle at now. A
+// competition is closing between EndAt and its standings being frozen.
+func (c Competition) Status(now time.Time) string {
+	switch {
+	case c.FinalizedAt != nil:
+		return CompetitionFinished
+	case now.Before(c.StartAt):
+		return CompetitionUpcoming
+	case now.Before(c.EndAt):
+		return CompetitionActive
+	default:
+		return CompetitionClosing
+	}
+}
+
+// CompetitionEntry enrolls a user in a competition with their contest
+// portfolio. The Final fields are set when the competition is finalized.
+type CompetitionEntry struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	CompetitionID uint      `json:"competition_id" gorm:"not null;uniqueIndex:idx_competition_entries_user"`
+	UserID        uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_competition_entries_user;index"`
+	PortfolioID   uint      `json:"portfolio_id" gorm:"not null"`
+	FinalRank     *int      `json:"final_rank,omitempty"`
+	FinalValue    float64   `json:"final_value"`
+	FinalReturn   float64   `json:"final_return"`
+	FinalSharpe   float64   `json:"final_sharpe"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Relations
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+func (CompetitionEntry) TableName() string {
+	return "competition_entries"
+}
+
+// CompetitionSnapshot is an entry's portfolio value at a point in time,
+// used to measure its Sharpe ratio.
+type CompetitionSnapshot struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	EntryID    uint      `json:"-" gorm:"not null;index"`
+	Value      float64   `json:"value"`
+	RecordedAt time.Time `json:"recorded_at" gorm:"not null"`
+}
+
+func (CompetitionSnapshot) TableName() string {
+	return "competition_snapshots"
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// BaseCurrency is the currency coin prices are quoted in and that
+// Portfolio.Balance is held in. FX rates are stored relative to it.
+const BaseCurrency = "USD"
+
+// FiatBalance holds a portfolio's cash in a currency other than BaseCurrency.
+type FiatBalance struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null"`
+	PortfolioID uint      `json:"portfolio_id" gorm:"uniqueIndex:idx_fiat_balances_portfolio_currency"`
+	Currency    string    `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_fiat_balances_portfolio_currency"`
+	Amount      float64   `json:"amount" gorm:"default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Relations
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// FxRate is the number of units of Currency that one BaseCurrency buys.
+type FxRate struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Currency    string    `json:"currency" gorm:"size:3;unique;not null"`
+	Rate        float64   `json:"rate" gorm:"not null"`
+	LastUpdated time.Time `json:"last_updated"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (FiatBalance) TableName() string {
+	return "fiat_balances"
+}
+
+func (FxRate) TableName() string {
+	return "fx_rates"
+}
@@ -1,5 +1,9 @@
 package models
 
+import (
+	"time"
+)
+
 // Request/Response DTOs
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
@@ -13,10 +17,39 @@ type RegisterRequest struct {
 }
 
 type TradeRequest struct {
-	CoinID   uint    `json:"coin_id" validate:"required"`
-	Type     string  `json:"type" validate:"required,oneof=buy sell"`
+	PortfolioID uint    `json:"portfolio_id"`
+	CoinID      uint    `json:"coin_id" validate:"required"`
+	Type        string  `json:"type" validate:"required,oneof=buy sell"`
+	Quantity    float64 `json:"quantity" validate:"required,gt=0"`
+	Price       float64 `json:"price" validate:"required,gt=0"`
+
+	// Lots picks the tax lots a sell consumes (specific identification);
+	// otherwise the user's lot method decides
+	Lots []LotSelection `json:"lots,omitempty"`
+
+	// CopiedFrom is set by copy trading, never by clients
+	CopiedFrom *uint `json:"-"`
+}
+
+// TradeImportMapping names the CSV columns holding each trade field. A name
+// may list alternatives separated by "|"; matching ignores case. Either Price
+// or Total is enough.
+type TradeImportMapping struct {
+	Time           string `json:"time"`
+	Symbol         string `json:"symbol"`
+	Side           string `json:"side"`
+	Quantity       string `json:"quantity"`
+	Price          string `json:"price"`
+	Total          string `json:"total"`
+	Fee            string `json:"fee"`
+	ExternalID     string `json:"external_id"`
+	TimeFormat     string `json:"time_format"`      // Go layout; common formats are tried when empty
+	SkipOtherTypes bool   `json:"skip_other_types"` // Ignore rows that are neither buys nor sells
+}
+
+type LotSelection struct {
+	LotID    uint    `json:"lot_id" validate:"required"`
 	Quantity float64 `json:"quantity" validate:"required,gt=0"`
-	Price    float64 `json:"price" validate:"required,gt=0"`
 }
 
 type AuthResponse struct {
@@ -40,9 +73,227 @@ type PaginationQuery struct {
 
 type CoinPriceUpdate struct {
 	Symbol                   string  `json:"symbol"`
+	Category                 string  `json:"category"` // Optional; left unchanged when empty
 	CurrentPrice             float64 `json:"current_price"`
 	MarketCap                int64   `json:"market_cap"`
 	Volume24h                int64   `json:"volume_24h"`
 	PriceChange24h           float64 `json:"price_change_24h"`
 	PriceChangePercentage24h float64 `json:"price_change_percentage_24h"`
 }
+
+type FxRateUpdate struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+type UpdateProfileRequest struct {
+	PreferredCurrency string `json:"preferred_currency"`
+	TaxLotMethod      string `json:"tax_lot_method"`
+}
+
+type CurrencyConversionRequest struct {
+	From   string  `json:"from" validate:"required,len=3"`
+	To     string  `json:"to" validate:"required,len=3"`
+	Amount float64 `json:"amount" validate:"required,gt=0"`
+}
+
+type TransferRequest struct {
+	Asset        string  `json:"asset" validate:"required,oneof=fiat coin"`
+	Currency     string  `json:"currency"`
+	CoinID       uint    `json:"coin_id"`
+	Amount       float64 `json:"amount" validate:"required,gt=0"`
+	DelaySeconds *int    `json:"delay_seconds"`
+}
+
+type ResetAccountRequest struct {
+	StartingBalance float64 `json:"starting_balance" validate:"required,gt=0"`
+}
+
+type PortfolioRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type PortfolioTransferRequest struct {
+	FromPortfolioID uint    `json:"from_portfolio_id" validate:"required"`
+	ToPortfolioID   uint    `json:"to_portfolio_id" validate:"required"`
+	Asset           string  `json:"asset" validate:"required,oneof=fiat coin"`
+	Currency        string  `json:"currency"`
+	CoinID          uint    `json:"coin_id"`
+	Amount          float64 `json:"amount" validate:"required,gt=0"`
+}
+
+type RecurringOrderRequest struct {
+	PortfolioID uint    `json:"portfolio_id"`
+	CoinID      uint    `json:"coin_id" validate:"required"`
+	Type        string  `json:"type" validate:"omitempty,oneof=buy sell"`
+	Amount      float64 `json:"amount" validate:"required,gt=0"`
+	Schedule    string  `json:"schedule" validate:"required,oneof=daily weekly monthly cron"`
+	Cron        string  `json:"cron"`
+	Hour        int     `json:"hour" validate:"min=0,max=23"`
+	Minute      int     `json:"minute" validate:"min=0,max=59"`
+	Weekday     int     `json:"weekday" validate:"min=0,max=6"`
+	DayOfMonth  int     `json:"day_of_month" validate:"min=0,max=28"`
+}
+
+type TargetWeight struct {
+	CoinID uint    `json:"coin_id" validate:"required"`
+	Weight float64 `json:"weight" validate:"gt=0,lte=100"`
+}
+
+type TargetAllocationRequest struct {
+	Targets        []TargetWeight `json:"targets"`
+	DriftThreshold *float64       `json:"drift_threshold"`
+	AutoRebalance  *bool          `json:"auto_rebalance"`
+	Cron           string         `json:"cron"`
+}
+
+type RebalanceRequest struct {
+	DryRun         *bool    `json:"dry_run"`
+	DriftThreshold *float64 `json:"drift_threshold"`
+}
+
+type AlertRuleRequest struct {
+	CoinID          uint     `json:"coin_id" validate:"required"`
+	Condition       string   `json:"condition" validate:"required,oneof=price_above price_below percent_change volume_spike"`
+	Threshold       float64  `json:"threshold" validate:"required"`
+	WindowMinutes   int      `json:"window_minutes" validate:"min=0"`
+	Mode            string   `json:"mode" validate:"omitempty,oneof=once repeat"`
+	CooldownMinutes *int     `json:"cooldown_minutes"`
+	Channels        []string `json:"channels"`
+	WebhookURL      string   `json:"webhook_url"`
+	Enabled         *bool    `json:"enabled"`
+}
+
+type WebhookEndpointRequest struct {
+	URL         string   `json:"url" validate:"required,url"`
+	Description string   `json:"description"`
+	EventTypes  []string `json:"event_types"`
+	Active      *bool    `json:"active"`
+}
+
+type WatchlistRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type WatchlistEntryRequest struct {
+	CoinID      uint     `json:"coin_id" validate:"required"`
+	Notes       string   `json:"notes"`
+	TargetPrice *float64 `json:"target_price" validate:"omitempty,gt=0"`
+}
+
+type WatchlistBulkRequest struct {
+	Add    []uint `json:"add"`
+	Remove []uint `json:"remove"`
+}
+
+type WatchlistOrderRequest struct {
+	EntryIDs []uint `json:"entry_ids" validate:"required"`
+}
+
+type BenchmarkRequest struct {
+	Name       string         `json:"name" validate:"required,max=100"`
+	Components []TargetWeight `json:"components" validate:"required"`
+}
+
+// BacktestRequest configures a backtest. Zero values take the defaults:
+// the 1h interval, the last 30 days, DefaultStartingBalance of starting cash,
+// no fee (as with paper trades) and 0.05% slippage.
+type BacktestRequest struct {
+	CoinID      uint               `json:"coin_id"`
+	Strategy    string             `json:"strategy"`
+	Params      map[string]float64 `json:"params"`
+	Interval    string             `json:"interval"`
+	StartAt     *time.Time         `json:"start_at"`
+	EndAt       *time.Time         `json:"end_at"`
+	InitialCash float64            `json:"initial_cash"`
+	FeeRate     *float64           `json:"fee_rate"`
+	Slippage    *float64           `json:"slippage"`
+}
+
+// BotRequest configures a bot. The interval defaults to 1h.
+type BotRequest struct {
+	PortfolioID  uint               `json:"portfolio_id"`
+	CoinID       uint               `json:"coin_id"`
+	Name         string             `json:"name"`
+	Strategy     string             `json:"strategy"`
+	Params       map[string]float64 `json:"params"`
+	Interval     string             `json:"interval"`
+	Budget       float64            `json:"budget"`
+	MaxPosition  float64            `json:"max_position"`
+	MaxDailyLoss float64            `json:"max_daily_loss"`
+}
+
+// CompetitionRequest configures a competition. The starting balance
+// defaults to DefaultStartingBalance and the metric to return; no allowed
+// coins means every coin can be traded.
+type CompetitionRequest struct {
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	StartAt         time.Time `json:"start_at"`
+	EndAt           time.Time `json:"end_at"`
+	StartingBalance float64   `json:"starting_balance"`
+	AllowedCoins    []uint    `json:"allowed_coins"`
+	Metric          string    `json:"metric"`
+}
+
+// ProfileRequest updates profile settings; fields left out are unchanged.
+type ProfileRequest struct {
+	Public          *bool   `json:"public"`
+	Bio             *string `json:"bio"`
+	ShowPerformance *bool   `json:"show_performance"`
+	ShowTrades      *bool   `json:"show_trades"`
+	ShowAmounts     *bool   `json:"show_amounts"`
+	AllowCopying    *bool   `json:"allow_copying"`
+}
+
+// CopyTradingRequest starts copying the leader, named by username, or
+// updates an existing copy. Active defaults to true.
+type CopyTradingRequest struct {
+	Leader         string  `json:"leader"`
+	PortfolioID    uint    `json:"portfolio_id"`
+	Allocation     float64 `json:"allocation"`
+	MaxTradeAmount float64 `json:"max_trade_amount"`
+	Active         *bool   `json:"active"`
+}
+
+// MarginTransferRequest moves BaseCurrency cash between a portfolio and its
+// margin account.
+type MarginTransferRequest struct {
+	PortfolioID uint    `json:"portfolio_id"`
+	Amount      float64 `json:"amount"`
+}
+
+// MarginLeverageRequest sets the leverage new positions in a coin open with.
+type MarginLeverageRequest struct {
+	PortfolioID uint    `json:"portfolio_id"`
+	CoinID      uint    `json:"coin_id"`
+	Leverage    float64 `json:"leverage"`
+}
+
+// MarginPositionRequest opens a position worth Amount of BaseCurrency at the
+// coin's current price. Side is "long" (the default) or "short".
+type MarginPositionRequest struct {
+	PortfolioID uint    `json:"portfolio_id"`
+	CoinID      uint    `json:"coin_id"`
+	Side        string  `json:"side"`
+	Amount      float64 `json:"amount"`
+}
+
+// MarginCloseRequest closes Quantity of a position, or all of it when zero.
+// Closing a short buys the coin back to cover it.
+type MarginCloseRequest struct {
+	Quantity float64 `json:"quantity"`
+}
+
+// FuturesPositionRequest opens a perpetual futures position worth Amount of
+// BaseCurrency at the coin's mark price. Side is "long" (the default) or
+// "short" and MarginMode "cross" (the default) or "isolated". Leverage
+// defaults to the margin account's leverage for the coin.
+type FuturesPositionRequest struct {
+	PortfolioID uint    `json:"portfolio_id"`
+	CoinID      uint    `json:"coin_id"`
+	Side        string  `json:"side"`
+	MarginMode  string  `json:"margin_mode"`
+	Amount      float64 `json:"amount"`
+	Leverage    float64 `json:"leverage"`
+}
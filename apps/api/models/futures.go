@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	FuturesIsolated = "isolated"
+	FuturesCross    = "cross"
+)
+
+// FuturesPosition is a perpetual futures position held in a margin account.
+// It has no expiry and holds no coins: its P&L is Quantity times the move
+// of the mark price, the coin's current price, from EntryPrice, so
+// Quantity is negative for shorts. Margin is the collateral posted from
+// the account's cash; funding payments are settled against it and
+// FundingPaid totals them, negative when the position has received more
+// than it paid. Isolated positions can only lose their own margin, while
+// cross positions share the account's equity and are liquidated with it.
+// Status takes the MarginPosition statuses.
+type FuturesPosition struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	AccountID   uint       `json:"account_id" gorm:"not null;index"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	CoinID      uint       `json:"coin_id" gorm:"not null;index"`
+	Side        string     `json:"side" gorm:"not null"`
+	MarginMode  string     `json:"margin_mode" gorm:"not null"`
+	Quantity    float64    `json:"quantity" gorm:"not null"`
+	EntryPrice  float64    `json:"entry_price" gorm:"not null"`
+	Leverage    float64    `json:"leverage" gorm:"not null"`
+	Margin      float64    `json:"margin" gorm:"not null"`
+	FundingPaid float64    `json:"funding_paid"`
+	Status      string     `json:"status" gorm:"not null;default:'open';index"`
+	ClosePrice  float64    `json:"close_price,omitempty"`
+	RealizedPnL float64    `json:"realized_pnl"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+func (FuturesPosition) TableName() string {
+	return "futures_positions"
+}
+
+// FundingRate is the rate a coin's perpetual paid for one funding
+// interval, set at FundedAt from the imbalance between long and short open
+// interest. Longs pay shorts when it is positive and shorts pay longs when
+// it is negative.
+type FundingRate struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	CoinID        uint      `json:"coin_id" gorm:"not null;uniqueIndex:idx_funding_rates_coin_time"`
+	Rate          float64   `json:"rate"`
+	MarkPrice     float64   `json:"mark_price"`
+	LongInterest  float64   `json:"long_interest"`
+	ShortInterest float64   `json:"short_interest"`
+	FundedAt      time.Time `json:"funded_at" gorm:"not null;uniqueIndex:idx_funding_rates_coin_time"`
+}
+
+func (FundingRate) TableName() string {
+	return "funding_rates"
+}
+
+// FundingPayment is one position's share of a funding interval. Amount is
+// what the position paid, negative when it received funding.
+type FundingPayment struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	PositionID uint      `json:"position_id" gorm:"not null;index"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	CoinID     uint      `json:"coin_id" gorm:"not null"`
+	Rate       float64   `json:"rate"`
+	MarkPrice  float64   `json:"mark_price"`
+	Quantity   float64   `json:"quantity"`
+	Amount     float64   `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (FundingPayment) TableName() string {
+	return "funding_payments"
+}
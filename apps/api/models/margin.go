@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	MarginLong  = "long"
+	MarginShort = "short"
+
+	MarginPositionOpen       = "open"
+	MarginPositionClosed     = "closed"
+	MarginPositionLiquidated = "liquidated"
+)
+
+// MarginAccount holds the collateral a portfolio has set aside for
+// leveraged trading, in BaseCurrency. It is kept apart from the
+// portfolio's cash and spot holdings: Cash only moves in and out through
+// margin deposits and withdrawals. MarginCalledAt is set while the account
+// is below its margin call level.
+type MarginAccount struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	PortfolioID    uint       `json:"portfolio_id" gorm:"not null;uniqueIndex"`
+	Cash           float64    `json:"cash" gorm:"not null;default:0"`
+	LastAccruedAt  time.Time  `json:"last_accrued_at"`
+	MarginCalledAt *time.Time `json:"margin_called_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (MarginAccount) TableName() string {
+	return "margin_accounts"
+}
+
+// MarginLeverage is the leverage an account opens new positions in a coin
+// with.
+type MarginLeverage struct {
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	AccountID uint    `json:"account_id" gorm:"not null;uniqueIndex:idx_margin_leverages_account_coin"`
+	CoinID    uint    `json:"coin_id" gorm:"not null;uniqueIndex:idx_margin_leverages_account_coin"`
+	Leverage  float64 `json:"leverage" gorm:"not null"`
+}
+
+func (MarginLeverage) TableName() string {
+	return "margin_leverages"
+}
+
+// MarginPosition is a leveraged position. Margin is the collateral posted
+// for it and Loan the cash owed against it, which grows as interest or
+// borrow fees accrue; Interest is the total accrued so far. A long borrows
+// cash to buy the rest of the position. A short borrows the coin and sells
+// it, so its Quantity is negative and Collateral holds its margin plus the
+// sale proceeds until it is bought back. Closing or liquidating the
+// position repays its loan from the proceeds.
+type MarginPosition struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	AccountID   uint       `json:"account_id" gorm:"not null;index"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	CoinID      uint       `json:"coin_id" gorm:"not null"`
+	Side        string     `json:"side" gorm:"not null"`
+	Quantity    float64    `json:"quantity" gorm:"not null"`
+	EntryPrice  float64    `json:"entry_price" gorm:"not null"`
+	Leverage    float64    `json:"leverage" gorm:"not null"`
+	Margin      float64    `json:"margin" gorm:"not null"`
+	Loan        float64    `json:"loan" gorm:"not null"`
+	Collateral  float64    `json:"collateral" gorm:"not null;default:0"`
+	Interest    float64    `json:"interest"`
+	Status      string     `json:"status" gorm:"not null;default:'open';index"`
+	ClosePrice  float64    `json:"close_price,omitempty"`
+	RealizedPnL float64    `json:"realized_pnl"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+func (MarginPosition) TableName() string {
+	return "margin_positions"
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification is a message in a user's in-app inbox. Type is the event type
+// that produced it and ReferenceID the record it is about.
+type Notification struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index:idx_notifications_user_read"`
+	Type        string     `json:"type" gorm:"not null"`
+	Title       string     `json:"title" gorm:"not null"`
+	Message     string     `json:"message"`
+	ReferenceID *uint      `json:"reference_id,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty" gorm:"index:idx_notifications_user_read"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NotificationPreference turns inbox notifications of one event type on or
+// off. Types without a row are enabled.
+type NotificationPreference struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_notification_preferences_user_type"`
+	Type      string    `json:"type" gorm:"not null;uniqueIndex:idx_notification_preferences_user_type"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// PortfolioSnapshot is a user's total value across their portfolios, other
+// than contest portfolios, at a point in time, in BaseCurrency. Cash
+// includes withdrawals still being held.
+// NetFlow is the value deposited minus the value withdrawn (including
+// account resets) since the user's previous snapshot, so returns can be
+// separated from money moving in and out.
+type PortfolioSnapshot struct {
+	ID            uint      `json:"-" gorm:"primaryKey"`
+	UserID        uint      `json:"-" gorm:"not null;uniqueIndex:idx_portfolio_snapshots_user_time"`
+	Cash          float64   `json:"cash"`
+	HoldingsValue float64   `json:"holdings_value"`
+	TotalValue    float64   `json:"total_value"`
+	NetFlow       float64   `json:"net_flow"`
+	RecordedAt    time.Time `json:"recorded_at" gorm:"not null;uniqueIndex:idx_portfolio_snapshots_user_time"`
+}
+
+func (PortfolioSnapshot) TableName() string {
+	return "portfolio_snapshots"
+}
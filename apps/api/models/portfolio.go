@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// Portfolio owns a BaseCurrency cash balance, fiat balances, holdings, trades
+// and watchlists. Every user has exactly one default portfolio, which is used
+// whenever a request does not name one. Contest portfolios belong to a
+// competition entry and are isolated from the rest of the account.
+type Portfolio struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"not null;index"`
+	Name          string     `json:"name" gorm:"not null"`
+	IsDefault     bool       `json:"is_default" gorm:"default:false"`
+	Balance       float64    `json:"balance" gorm:"default:0"`
+	CompetitionID *uint      `json:"competition_id,omitempty" gorm:"index"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relations
+	User         User          `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	UserCoins    []UserCoin    `json:"user_coins,omitempty" gorm:"foreignKey:PortfolioID"`
+	FiatBalances []FiatBalance `json:"fiat_balances,omitempty" gorm:"foreignKey:PortfolioID"`
+}
+
+func (Portfolio) TableName() string {
+	return "portfolios"
+}
+
+// IsArchived reports whether the portfolio is read-only.
+func (p Portfolio) IsArchived() bool {
+	return p.ArchivedAt != nil
+}
+
+// IsContest reports whether the portfolio is a competition entry's.
+func (p Portfolio) IsContest() bool {
+	return p.CompetitionID != nil
+}
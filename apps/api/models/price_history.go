@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// PriceHistory is a snapshot of a coin's market data, recorded every time
+// prices are pushed to UpdateCoinPrices.
+type PriceHistory struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CoinID     uint      `json:"coin_id" gorm:"not null;index:idx_price_history_coin_time"`
+	Price      float64   `json:"price" gorm:"not null"`
+	MarketCap  int64     `json:"market_cap"`
+	Volume24h  int64     `json:"volume_24h" gorm:"column:volume_24h"`
+	RecordedAt time.Time `json:"recorded_at" gorm:"not null;index:idx_price_history_coin_time"`
+}
+
+func (PriceHistory) TableName() string {
+	return "price_history"
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	RebalanceTriggerManual    = "manual"
+	RebalanceTriggerScheduled = "scheduled"
+
+	RebalanceRunSkipped  = "skipped"
+	RebalanceRunPlanned  = "planned"
+	RebalanceRunExecuted = "executed"
+	RebalanceRunFailed   = "failed"
+)
+
+// TargetAllocation is the desired share of a portfolio's value held in a
+// coin, in percent. Whatever the targets leave over is held as BaseCurrency
+// cash.
+type TargetAllocation struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null"`
+	PortfolioID uint      `json:"portfolio_id" gorm:"not null;uniqueIndex:idx_target_allocations_portfolio_coin"`
+	CoinID      uint      `json:"coin_id" gorm:"not null;uniqueIndex:idx_target_allocations_portfolio_coin"`
+	Weight      float64   `json:"weight" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+// RebalanceSettings controls when a portfolio is rebalanced. DriftThreshold is
+// in percentage points: nothing is traded until some position is at least
+// that far from its target weight.
+type RebalanceSettings struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null"`
+	PortfolioID    uint       `json:"portfolio_id" gorm:"not null;unique"`
+	DriftThreshold float64    `json:"drift_threshold" gorm:"default:5"`
+	AutoRebalance  bool       `json:"auto_rebalance" gorm:"default:false"`
+	CronExpr       string     `json:"cron_expr" gorm:"default:'0 0 * * *'"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty" gorm:"index"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// RebalanceRun records a manual or scheduled rebalance and its outcome.
+type RebalanceRun struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	PortfolioID uint      `json:"portfolio_id" gorm:"not null;index"`
+	Trigger     string    `json:"trigger" gorm:"not null"`
+	DryRun      bool      `json:"dry_run"`
+	Status      string    `json:"status" gorm:"not null"`
+	MaxDrift    float64   `json:"max_drift"`
+	TradeCount  int       `json:"trade_count"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (TargetAllocation) TableName() string {
+	return "target_allocations"
+}
+
+func (RebalanceSettings) TableName() string {
+	return "rebalance_settings"
+}
+
+func (RebalanceRun) TableName() string {
+	return "rebalance_runs"
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ScheduleDaily   = "daily"
+	ScheduleWeekly  = "weekly"
+	ScheduleMonthly = "monthly"
+	ScheduleCron    = "cron"
+
+	RecurringStatusActive    = "active"
+	RecurringStatusPaused    = "paused"
+	RecurringStatusCancelled = "cancelled"
+
+	RecurringRunSucceeded = "succeeded"
+	RecurringRunFailed    = "failed"
+)
+
+// RecurringOrder buys (or sells) a fixed BaseCurrency amount of a coin on a
+// schedule, e.g. "$100 of BTC every Monday". Daily, weekly and monthly
+// schedules run at Hour:Minute UTC; all of them are stored as a cron
+// expression in CronExpr.
+type RecurringOrder struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	PortfolioID  uint       `json:"portfolio_id" gorm:"not null;index"`
+	CoinID       uint       `json:"coin_id" gorm:"not null"`
+	Type         string     `json:"type" gorm:"not null;default:'buy';check:type IN ('buy', 'sell')"`
+	Amount       float64    `json:"amount" gorm:"not null"`
+	Schedule     string     `json:"schedule" gorm:"not null"`
+	CronExpr     string     `json:"cron_expr" gorm:"not null"`
+	Status       string     `json:"status" gorm:"not null;default:'active'"`
+	NextRunAt    time.Time  `json:"next_run_at" gorm:"index"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	FailureCount int        `json:"failure_count" gorm:"default:0"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Relations
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+// RecurringOrderRun records one execution attempt of a RecurringOrder.
+type RecurringOrderRun struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	RecurringOrderID uint      `json:"recurring_order_id" gorm:"not null;index"`
+	TradeID          *uint     `json:"trade_id,omitempty"`
+	Status           string    `json:"status" gorm:"not null"`
+	Error            string    `json:"error,omitempty"`
+	ScheduledAt      time.Time `json:"scheduled_at"`
+	CreatedAt        time.Time `json:"created_at"`
+
+	// Relations
+	Trade *Trade `json:"trade,omitempty" gorm:"foreignKey:TradeID"`
+}
+
+func (RecurringOrder) TableName() string {
+	return "recurring_orders"
+}
+
+func (RecurringOrderRun) TableName() string {
+	return "recurring_order_runs"
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// Profile holds a user's public profile and privacy settings. Profiles are
+// private until Public is set; ShowPerformance and ShowTrades choose what
+// a public profile and the feed reveal, ShowAmounts whether trades show
+// their quantities and totals, and AllowCopying whether other users can
+// copy the user's trades. Users without a row have the defaults from
+// DefaultProfile.
+type Profile struct {
+	UserID          uint      `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Public          bool      `json:"public"`
+	Bio             string    `json:"bio" gorm:"type:text"`
+	ShowPerformance bool      `json:"show_performance"`
+	ShowTrades      bool      `json:"show_trades"`
+	ShowAmounts     bool      `json:"show_amounts"`
+	AllowCopying    bool      `json:"allow_copying"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (Profile) TableName() string {
+	return "profiles"
+}
+
+// DefaultProfile is the private profile every user starts with.
+func DefaultProfile(userID uint) Profile {
+	return Profile{UserID: userID, ShowPerformance: true, ShowTrades: true}
+}
+
+// Follow records that FollowerID follows LeaderID's trades.
+type Follow struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	FollowerID uint      `json:"follower_id" gorm:"not null;uniqueIndex:idx_follows_pair"`
+	LeaderID   uint      `json:"leader_id" gorm:"not null;uniqueIndex:idx_follows_pair;index"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relations
+	Follower User `json:"-" gorm:"foreignKey:FollowerID"`
+	Leader   User `json:"-" gorm:"foreignKey:LeaderID"`
+}
+
+func (Follow) TableName() string {
+	return "follows"
+}
+
+// CopyTrading mirrors LeaderID's trades into the follower's portfolio.
+// Each trade is scaled by Allocation over the value of the leader's
+// portfolio it was made in; MaxTradeAmount caps each copied buy (zero
+// disables the cap).
+type CopyTrading struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	FollowerID     uint       `json:"follower_id" gorm:"not null;uniqueIndex:idx_copy_tradings_pair"`
+	LeaderID       uint       `json:"leader_id" gorm:"not null;uniqueIndex:idx_copy_tradings_pair;index"`
+	PortfolioID    uint       `json:"portfolio_id" gorm:"not null"`
+	Allocation     float64    `json:"allocation" gorm:"not null"`
+	MaxTradeAmount float64    `json:"max_trade_amount"`
+	Active         bool       `json:"active"`
+	LastCopiedAt   *time.Time `json:"last_copied_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relations
+	Leader User `json:"-" gorm:"foreignKey:LeaderID"`
+}
+
+func (CopyTrading) TableName() string {
+	return "copy_tradings"
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	LotMethodFIFO       = "fifo"
+	LotMethodLIFO       = "lifo"
+	LotMethodHIFO       = "hifo"
+	LotMethodSpecificID = "specific_id"
+
+	LotSourceOpening  = "opening"
+	LotSourceBuy      = "buy"
+	LotSourceDeposit  = "deposit"
+	LotSourceTransfer = "transfer"
+
+	GainShortTerm = "short"
+	GainLongTerm  = "long"
+)
+
+// TaxLot is a quantity of a coin acquired in one go at one cost basis per
+// unit. Sells, withdrawals and moves to other portfolios consume Remaining;
+// UserCoin keeps the blended position alongside. Opening lots stand in for
+// holdings that existed before lots were tracked.
+type TaxLot struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	PortfolioID uint      `json:"portfolio_id" gorm:"not null;index:idx_tax_lots_portfolio_coin"`
+	CoinID      uint      `json:"coin_id" gorm:"not null;index:idx_tax_lots_portfolio_coin"`
+	Source      string    `json:"source" gorm:"not null"`
+	TradeID     *uint     `json:"trade_id,omitempty"`
+	Quantity    float64   `json:"quantity" gorm:"not null"`
+	Remaining   float64   `json:"remaining" gorm:"not null"`
+	CostBasis   float64   `json:"cost_basis" gorm:"not null"`
+	AcquiredAt  time.Time `json:"acquired_at" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+// LotDisposal is the part of a lot sold by one trade, with the realized gain
+// in BaseCurrency. Unlike TaxLot.CostBasis, CostBasis and Proceeds here are
+// totals for Quantity.
+type LotDisposal struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;index:idx_lot_disposals_user_time"`
+	PortfolioID uint      `json:"portfolio_id" gorm:"not null"`
+	LotID       uint      `json:"lot_id" gorm:"not null;index"`
+	TradeID     uint      `json:"trade_id" gorm:"not null;index"`
+	CoinID      uint      `json:"coin_id" gorm:"not null"`
+	Quantity    float64   `json:"quantity" gorm:"not null"`
+	CostBasis   float64   `json:"cost_basis" gorm:"not null"`
+	Proceeds    float64   `json:"proceeds" gorm:"not null"`
+	Gain        float64   `json:"gain"`
+	Term        string    `json:"term" gorm:"not null"`
+	AcquiredAt  time.Time `json:"acquired_at" gorm:"not null"`
+	DisposedAt  time.Time `json:"disposed_at" gorm:"not null;index:idx_lot_disposals_user_time"`
+
+	// Relations
+	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+func (TaxLot) TableName() string {
+	return "tax_lots"
+}
+
+func (LotDisposal) TableName() string {
+	return "lot_disposals"
+}
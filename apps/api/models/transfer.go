@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultStartingBalance is the BaseCurrency cash a new paper account gets.
+const DefaultStartingBalance = 10000.0
+
+const (
+	TransferDeposit    = "deposit"
+	TransferWithdrawal = "withdrawal"
+
+	TransferAssetFiat = "fiat"
+	TransferAssetCoin = "coin"
+
+	TransferStatusPending   = "pending"
+	TransferStatusConfirmed = "confirmed"
+	TransferStatusCancelled = "cancelled"
+)
+
+// Transfer is a simulated movement of cash or coins into or out of a paper
+// account. Withdrawals are held as soon as they are requested; deposits are
+// only credited once confirmed.
+type Transfer struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	PortfolioID uint       `json:"portfolio_id" gorm:"index"`
+	Direction   string     `json:"direction" gorm:"not null;check:direction IN ('deposit', 'withdrawal')"`
+	Asset       string     `json:"asset" gorm:"not null;check:asset IN ('fiat', 'coin')"`
+	Currency    string     `json:"currency,omitempty" gorm:"size:3"`
+	CoinID      *uint      `json:"coin_id,omitempty"`
+	Amount      float64    `json:"amount" gorm:"not null"`
+	CostBasis   float64    `json:"cost_basis" gorm:"default:0"`
+	Status      string     `json:"status" gorm:"not null;default:'pending';index"`
+	AvailableAt time.Time  `json:"available_at" gorm:"index"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relations
+	User User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Coin *Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
+}
+
+// AccountReset records a paper account reset. Trades made before the reset
+// are archived under its ID rather than deleted.
+type AccountReset struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	UserID          uint      `json:"user_id" gorm:"not null;index"`
+	PortfolioID     uint      `json:"portfolio_id" gorm:"index"`
+	StartingBalance float64   `json:"starting_balance" gorm:"not null"`
+	PreviousBalance float64   `json:"previous_balance"`
+	PreviousValue   float64   `json:"previous_value"`
+	ArchivedTrades  int64     `json:"archived_trades"`
+	CreatedAt       time.Time `json:"created_at"`
+
+	// Relations
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+func (Transfer) TableName() string {
+	return "transfers"
+}
+
+func (AccountReset) TableName() string {
+	return "account_resets"
+}
@@ -7,29 +7,34 @@ import (
 )
 
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Username  string    `json:"username" gorm:"unique;not null"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"`
-	Balance   float64   `json:"balance" gorm:"default:10000.00"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	Username          string    `json:"username" gorm:"unique;not null"`
+	Email             string    `json:"email" gorm:"unique;not null"`
+	Password          string    `json:"-" gorm:"not null"`
+	Balance           float64   `json:"balance" gorm:"-"` // Default portfolio cash, filled in by handlers
+	PreferredCurrency string    `json:"preferred_currency" gorm:"size:3;default:'USD'"`
+	TaxLotMethod      string    `json:"tax_lot_method" gorm:"default:'fifo'"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
 
 	// Relations
-	UserCoins []UserCoin  `json:"user_coins,omitempty" gorm:"foreignKey:UserID"`
-	Trades    []Trade     `json:"trades,omitempty" gorm:"foreignKey:UserID"`
-	Watchlist []Watchlist `json:"watchlist,omitempty" gorm:"foreignKey:UserID"`
+	UserCoins    []UserCoin    `json:"user_coins,omitempty" gorm:"foreignKey:UserID"`
+	Trades       []Trade       `json:"trades,omitempty" gorm:"foreignKey:UserID"`
+	Watchlist    []Watchlist   `json:"watchlist,omitempty" gorm:"foreignKey:UserID"`
+	FiatBalances []FiatBalance `json:"fiat_balances,omitempty" gorm:"foreignKey:UserID"`
+	Portfolios   []Portfolio   `json:"portfolios,omitempty" gorm:"foreignKey:UserID"`
 }
 
 type Coin struct {
 	ID                       uint      `json:"id" gorm:"primaryKey"`
 	Symbol                   string    `json:"symbol" gorm:"unique;not null"`
 	Name                     string    `json:"name" gorm:"not null"`
+	Category                 string    `json:"category" gorm:"index"`
 	CurrentPrice             float64   `json:"current_price" gorm:"not null"`
 	MarketCap                int64     `json:"market_cap"`
-	Volume24h                int64     `json:"volume_24h"`
-	PriceChange24h           float64   `json:"price_change_24h"`
-	PriceChangePercentage24h float64   `json:"price_change_percentage_24h"`
+	Volume24h                int64     `json:"volume_24h" gorm:"column:volume_24h"`
+	PriceChange24h           float64   `json:"price_change_24h" gorm:"column:price_change_24h"`
+	PriceChangePercentage24h float64   `json:"price_change_percentage_24h" gorm:"column:price_change_percentage_24h"`
 	LastUpdated              time.Time `json:"last_updated"`
 	CreatedAt                time.Time `json:"created_at"`
 
@@ -42,7 +47,8 @@ type Coin struct {
 type UserCoin struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	UserID       uint      `json:"user_id" gorm:"not null"`
-	CoinID       uint      `json:"coin_id" gorm:"not null"`
+	PortfolioID  uint      `json:"portfolio_id" gorm:"uniqueIndex:idx_user_coins_portfolio_coin"`
+	CoinID       uint      `json:"coin_id" gorm:"not null;uniqueIndex:idx_user_coins_portfolio_coin"`
 	Quantity     float64   `json:"quantity" gorm:"default:0"`
 	AveragePrice float64   `json:"average_price" gorm:"default:0"`
 	CreatedAt    time.Time `json:"created_at"`
@@ -56,11 +62,16 @@ type UserCoin struct {
 type Trade struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	UserID      uint      `json:"user_id" gorm:"not null"`
+	PortfolioID uint      `json:"portfolio_id" gorm:"index"`
 	CoinID      uint      `json:"coin_id" gorm:"not null"`
 	Type        string    `json:"type" gorm:"not null;check:type IN ('buy', 'sell')"`
 	Quantity    float64   `json:"quantity" gorm:"not null"`
 	Price       float64   `json:"price" gorm:"not null"`
 	TotalAmount float64   `json:"total_amount" gorm:"not null"`
+	Fee         float64   `json:"fee" gorm:"default:0"`
+	ExternalID  string    `json:"external_id,omitempty" gorm:"index"` // ID on the exchange an imported trade came from
+	ResetID     *uint     `json:"reset_id,omitempty" gorm:"index"`
+	CopiedFrom  *uint     `json:"copied_from,omitempty"` // Leader's trade a copy-trading trade mirrors
 	CreatedAt   time.Time `json:"created_at"`
 
 	// Relations
@@ -68,11 +79,17 @@ type Trade struct {
 	Coin Coin `json:"coin,omitempty" gorm:"foreignKey:CoinID"`
 }
 
+// Watchlist is one coin on one of a user's watchlists.
 type Watchlist struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	UserID    uint      `json:"user_id" gorm:"not null"`
-	CoinID    uint      `json:"coin_id" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null"`
+	GroupID     uint      `json:"watchlist_id" gorm:"uniqueIndex:idx_watchlists_group_coin"`
+	CoinID      uint      `json:"coin_id" gorm:"not null;uniqueIndex:idx_watchlists_group_coin"`
+	Position    int       `json:"position" gorm:"default:0"`
+	Notes       string    `json:"notes" gorm:"type:text"`
+	TargetPrice *float64  `json:"target_price"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 
 	// Relations
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
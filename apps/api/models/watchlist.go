@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// WatchlistGroup is a named watchlist. Every user has one default list, which
+// the original /api/watchlist endpoints operate on.
+type WatchlistGroup struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"not null"`
+	IsDefault bool      `json:"is_default" gorm:"default:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relations
+	Entries []Watchlist `json:"entries,omitempty" gorm:"foreignKey:GroupID"`
+}
+
+func (WatchlistGroup) TableName() string {
+	return "watchlist_groups"
+}
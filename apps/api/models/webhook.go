@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is a URL a user wants events POSTed to. EventTypes is a
+// comma-separated filter; empty means every event. Secret signs payloads and
+// is only shown to the user when it is generated.
+type WebhookEndpoint struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	URL         string    `json:"url" gorm:"not null"`
+	Description string    `json:"description"`
+	EventTypes  string    `json:"event_types"`
+	Secret      string    `json:"-" gorm:"not null"`
+	Active      bool      `json:"active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Accepts reports whether the endpoint subscribes to eventType.
+func (e WebhookEndpoint) Accepts(eventType string) bool {
+	if e.EventTypes == "" {
+		return true
+	}
+	for _, t := range strings.Split(e.EventTypes, ",") {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent to one endpoint, with the outcome of its
+// latest attempt. Pending deliveries are retried at NextAttemptAt.
+type WebhookDelivery struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	EndpointID    uint       `json:"endpoint_id" gorm:"not null;index"`
+	UserID        uint       `json:"user_id" gorm:"not null"`
+	EventType     string     `json:"event_type" gorm:"not null"`
+	Payload       string     `json:"payload" gorm:"type:text;not null"`
+	Status        string     `json:"status" gorm:"not null;default:'pending'"`
+	Attempts      int        `json:"attempts" gorm:"default:0"`
+	ResponseCode  int        `json:"response_code,omitempty"`
+	ResponseBody  string     `json:"response_body,omitempty" gorm:"type:text"`
+	Error         string     `json:"error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" gorm:"index"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	RedeliveryOf  *uint      `json:"redelivery_of,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func (WebhookEndpoint) TableName() string {
+	return "webhook_endpoints"
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
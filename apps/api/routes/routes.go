@@ -19,10 +19,18 @@ func SetupRoutes(app *fiber.App) {
 	// Coins routes (public)
 	coins := api.Group("/coins")
 	coins.Get("/", controllers.GetCoins)
+	coins.Get("/categories", controllers.GetCoinCategories)
 	coins.Get("/:id", controllers.GetCoin)
+	coins.Get("/:id/indicators", controllers.GetCoinIndicators)
 	coins.Get("/symbol/:symbol", controllers.GetCoinBySymbol)
 	coins.Post("/prices", controllers.UpdateCoinPrices) // For external price updates
 	coins.Get("/market/data", controllers.GetMarketData)
+	coins.Get("/market/movers", controllers.GetMarketMovers)
+
+	// FX rates routes (public)
+	fx := api.Group("/fx")
+	fx.Get("/rates", controllers.GetFxRates)
+	fx.Post("/rates", controllers.UpdateFxRates) // For external rate updates
 
 	// Protected routes
 	protected := api.Group("/", middlewares.JWTMiddleware())
@@ -33,18 +41,165 @@ func SetupRoutes(app *fiber.App) {
 	// User routes
 	user := protected.Group("/user")
 	user.Get("/profile", controllers.GetUserProfile)
+	user.Put("/profile", controllers.UpdateUserProfile)
 	user.Get("/balance", controllers.GetUserBalance)
+	user.Post("/balance/convert", controllers.ConvertCurrency)
 	user.Get("/holdings", controllers.GetUserHoldings)
 	user.Get("/stats", controllers.GetUserStats)
+	user.Get("/performance", controllers.GetUserPerformance)
+	user.Get("/performance/benchmark", controllers.CompareToBenchmark)
+	user.Get("/allocation", controllers.GetUserAllocation)
+	user.Get("/lots", controllers.GetTaxLots)
+	user.Get("/reports/tax", controllers.GetTaxReport)
+	user.Post("/reset", controllers.ResetAccount)
+	user.Get("/resets", controllers.GetAccountResets)
+	user.Get("/targets", controllers.GetTargetAllocations)
+	user.Put("/targets", controllers.SetTargetAllocations)
+	user.Post("/rebalance", controllers.RebalancePortfolio)
+	user.Get("/rebalance/runs", controllers.GetRebalanceRuns)
+
+	// Benchmark routes
+	benchmarks := protected.Group("/benchmarks")
+	benchmarks.Get("/", controllers.GetBenchmarks)
+	benchmarks.Post("/", controllers.CreateBenchmark)
+	benchmarks.Put("/:id", controllers.UpdateBenchmark)
+	benchmarks.Delete("/:id", controllers.DeleteBenchmark)
+
+	// Portfolio routes
+	portfolios := protected.Group("/portfolios")
+	portfolios.Get("/", controllers.GetPortfolios)
+	portfolios.Post("/", controllers.CreatePortfolio)
+	portfolios.Post("/transfer", controllers.TransferBetweenPortfolios)
+	portfolios.Put("/:id", controllers.RenamePortfolio)
+	portfolios.Post("/:id/archive", controllers.ArchivePortfolio)
+
+	// Simulated transfer routes
+	transfers := protected.Group("/transfers")
+	transfers.Get("/", controllers.GetTransfers)
+	transfers.Post("/deposit", controllers.Deposit)
+	transfers.Post("/withdraw", controllers.Withdraw)
+	transfers.Post("/:id/cancel", controllers.CancelTransfer)
 
 	// Trading routes
 	trades := protected.Group("/trades")
 	trades.Post("/", controllers.CreateTrade)
 	trades.Get("/", controllers.GetTrades)
+	trades.Get("/export", controllers.ExportTrades)
+	trades.Post("/import", controllers.ImportTrades)
+
+	// Backtest routes
+	backtests := protected.Group("/backtests")
+	backtests.Get("/", controllers.GetBacktests)
+	backtests.Post("/", controllers.CreateBacktest)
+	backtests.Get("/:id", controllers.GetBacktest)
+	backtests.Delete("/:id", controllers.DeleteBacktest)
+
+	// Bot routes
+	bots := protected.Group("/bots")
+	bots.Get("/", controllers.GetBots)
+	bots.Post("/", controllers.CreateBot)
+	bots.Get("/:id", controllers.GetBot)
+	bots.Post("/:id/start", controllers.StartBot)
+	bots.Post("/:id/stop", controllers.StopBot)
+	bots.Get("/:id/logs", controllers.GetBotLogs)
+	bots.Delete("/:id", controllers.DeleteBot)
+
+	// Competition routes
+	competitions := protected.Group("/competitions")
+	competitions.Get("/", controllers.GetCompetitions)
+	competitions.Post("/", controllers.CreateCompetition)
+	competitions.Get("/:id", controllers.GetCompetition)
+	competitions.Post("/:id/join", controllers.JoinCompetition)
+	competitions.Get("/:id/leaderboard", controllers.GetLeaderboard)
+
+	// Social routes
+	social := protected.Group("/social")
+	social.Get("/profile", controllers.GetPublicProfile)
+	social.Put("/profile", controllers.UpdatePublicProfile)
+	social.Get("/feed", controllers.GetFeed)
+	social.Get("/following", controllers.GetFollowing)
+	social.Get("/followers", controllers.GetFollowers)
+	social.Get("/traders/:username", controllers.GetTraderProfile)
+	social.Post("/traders/:username/follow", controllers.FollowTrader)
+	social.Delete("/traders/:username/follow", controllers.UnfollowTrader)
+	social.Get("/copy-trading", controllers.GetCopyTradings)
+	social.Post("/copy-trading", controllers.CreateCopyTrading)
+	social.Put("/copy-trading/:id", controllers.UpdateCopyTrading)
+	social.Delete("/copy-trading/:id", controllers.DeleteCopyTrading)
+
+	// Margin routes
+	margin := protected.Group("/margin")
+	margin.Get("/", controllers.GetMarginAccount)
+	margin.Post("/deposit", controllers.DepositMargin)
+	margin.Post("/withdraw", controllers.WithdrawMargin)
+	margin.Put("/leverage", controllers.SetMarginLeverage)
+	margin.Get("/pnl", controllers.GetMarginPnL)
+	margin.Get("/positions", controllers.GetMarginPositions)
+	margin.Post("/positions", controllers.OpenMarginPosition)
+	margin.Post("/positions/:id/close", controllers.CloseMarginPosition)
+
+	// Futures routes
+	futures := protected.Group("/futures")
+	futures.Get("/positions", controllers.GetFuturesPositions)
+	futures.Post("/positions", controllers.OpenFuturesPosition)
+	futures.Get("/positions/:id", controllers.GetFuturesPosition)
+	futures.Post("/positions/:id/close", controllers.CloseFuturesPosition)
+	futures.Get("/funding", controllers.GetFundingPayments)
+	futures.Get("/funding-rates", controllers.GetFundingRates)
+
+	// Recurring order routes
+	recurring := protected.Group("/recurring-orders")
+	recurring.Get("/", controllers.GetRecurringOrders)
+	recurring.Post("/", controllers.CreateRecurringOrder)
+	recurring.Get("/:id/runs", controllers.GetRecurringOrderRuns)
+	recurring.Post("/:id/pause", controllers.PauseRecurringOrder)
+	recurring.Post("/:id/resume", controllers.ResumeRecurringOrder)
+	recurring.Post("/:id/cancel", controllers.CancelRecurringOrder)
+
+	// Price alert routes
+	alerts := protected.Group("/alerts")
+	alerts.Get("/", controllers.GetAlertRules)
+	alerts.Post("/", controllers.CreateAlertRule)
+	alerts.Get("/:id", controllers.GetAlertRule)
+	alerts.Put("/:id", controllers.UpdateAlertRule)
+	alerts.Delete("/:id", controllers.DeleteAlertRule)
+
+	// Notification inbox routes
+	notifications := protected.Group("/notifications")
+	notifications.Get("/", controllers.GetNotifications)
+	notifications.Get("/unread-count", controllers.GetUnreadNotificationCount)
+	notifications.Post("/read-all", controllers.MarkAllNotificationsRead)
+	notifications.Get("/preferences", controllers.GetNotificationPreferences)
+	notifications.Put("/preferences", controllers.UpdateNotificationPreferences)
+	notifications.Post("/:id/read", controllers.MarkNotificationRead)
+
+	// Outbound webhook routes
+	webhooks := protected.Group("/webhooks")
+	webhooks.Get("/", controllers.GetWebhooks)
+	webhooks.Post("/", controllers.CreateWebhook)
+	webhooks.Put("/:id", controllers.UpdateWebhook)
+	webhooks.Delete("/:id", controllers.DeleteWebhook)
+	webhooks.Post("/:id/rotate-secret", controllers.RotateWebhookSecret)
+	webhooks.Get("/:id/deliveries", controllers.GetWebhookDeliveries)
+	webhooks.Post("/:id/deliveries/:deliveryId/redeliver", controllers.RedeliverWebhook)
 
 	// Watchlist routes
 	watchlist := protected.Group("/watchlist")
 	watchlist.Get("/", controllers.GetWatchlist)
 	watchlist.Post("/", controllers.AddToWatchlist)
 	watchlist.Delete("/:id", controllers.RemoveFromWatchlist)
+
+	// Named watchlist routes
+	watchlists := protected.Group("/watchlists")
+	watchlists.Get("/", controllers.GetWatchlists)
+	watchlists.Post("/", controllers.CreateWatchlist)
+	watchlists.Get("/:id", controllers.GetWatchlistByID)
+	watchlists.Put("/:id", controllers.RenameWatchlist)
+	watchlists.Delete("/:id", controllers.DeleteWatchlist)
+	watchlists.Put("/:id/order", controllers.ReorderWatchlist)
+	watchlists.Get("/:id/items", controllers.GetWatchlistItems)
+	watchlists.Post("/:id/items", controllers.AddWatchlistItem)
+	watchlists.Post("/:id/items/bulk", controllers.BulkUpdateWatchlist)
+	watchlists.Put("/:id/items/:itemId", controllers.UpdateWatchlistItem)
+	watchlists.Delete("/:id/items/:itemId", controllers.RemoveWatchlistItem)
 }
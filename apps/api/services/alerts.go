@@ -0,0 +1,304 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAlertWindow   = 60
+	defaultAlertCooldown = 60
+	maxAlertWindow       = 7 * 24 * 60
+)
+
+var (
+	ErrAlertRuleNotFound     = errors.New("Alert rule not found")
+	ErrInvalidAlertCondition = errors.New("Invalid alert condition")
+	ErrInvalidAlertThreshold = errors.New("Invalid alert threshold")
+	ErrInvalidAlertWindow    = errors.New("Alert window must be between 1 minute and 7 days")
+	ErrInvalidAlertMode      = errors.New("Alert mode must be once or repeat")
+	ErrInvalidAlertCooldown  = errors.New("Alert cooldown cannot be negative")
+	ErrInvalidAlertChannel   = errors.New("Invalid alert channel")
+	ErrInvalidWebhookURL     = errors.New("A valid http(s) webhook URL is required for the webhook channel")
+)
+
+func CreateAlertRule(userID uint, req models.AlertRuleRequest) (*models.AlertRule, error) {
+	rule := models.AlertRule{UserID: userID}
+	if err := applyAlertRule(&rule, req); err != nil {
+		return nil, err
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateAlertRule replaces a rule's settings. Saving a rule re-arms it, so a
+// triggered one-shot rule fires again unless it is disabled.
+func UpdateAlertRule(userID, id uint, req models.AlertRuleRequest) (*models.AlertRule, error) {
+	var rule models.AlertRule
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&rule).Error; err != nil {
+		return nil, ErrAlertRuleNotFound
+	}
+	if err := applyAlertRule(&rule, req); err != nil {
+		return nil, err
+	}
+	if err := database.DB.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// applyAlertRule validates req and copies it onto rule, filling in defaults.
+func applyAlertRule(rule *models.AlertRule, req models.AlertRuleRequest) error {
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return ErrCoinNotFound
+	}
+
+	switch req.Condition {
+	case models.AlertPriceAbove, models.AlertPriceBelow, models.AlertVolumeSpike:
+		if req.Threshold <= 0 {
+			return ErrInvalidAlertThreshold
+		}
+	case models.AlertPercentChange:
+		if req.Threshold == 0 {
+			return ErrInvalidAlertThreshold
+		}
+	default:
+		return ErrInvalidAlertCondition
+	}
+
+	if req.WindowMinutes == 0 {
+		req.WindowMinutes = defaultAlertWindow
+	}
+	if req.WindowMinutes < 1 || req.WindowMinutes > maxAlertWindow {
+		return ErrInvalidAlertWindow
+	}
+
+	if req.Mode == "" {
+		req.Mode = models.AlertModeOnce
+	}
+	if req.Mode != models.AlertModeOnce && req.Mode != models.AlertModeRepeat {
+		return ErrInvalidAlertMode
+	}
+
+	cooldown := defaultAlertCooldown
+	if req.CooldownMinutes != nil {
+		cooldown = *req.CooldownMinutes
+	}
+	if cooldown < 0 {
+		return ErrInvalidAlertCooldown
+	}
+
+	if len(req.Channels) == 0 {
+		req.Channels = []string{models.ChannelInbox}
+	}
+	seen := make(map[string]bool)
+	var channels []string
+	for _, channel := range req.Channels {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if _, ok := notifiers[channel]; !ok {
+			return ErrInvalidAlertChannel
+		}
+		if !seen[channel] {
+			seen[channel] = true
+			channels = append(channels, channel)
+		}
+	}
+	if seen[models.ChannelWebhook] {
+		u, err := url.Parse(req.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidWebhookURL
+		}
+	}
+
+	rule.CoinID = coin.ID
+	rule.Condition = req.Condition
+	rule.Threshold = req.Threshold
+	rule.WindowMinutes = req.WindowMinutes
+	rule.Mode = req.Mode
+	rule.CooldownMinutes = cooldown
+	rule.Channels = strings.Join(channels, ",")
+	rule.WebhookURL = req.WebhookURL
+	rule.Status = models.AlertStatusActive
+	if req.Enabled != nil && !*req.Enabled {
+		rule.Status = models.AlertStatusDisabled
+	}
+	rule.Coin = coin
+	return nil
+}
+
+// EvaluateAlerts checks every active rule on the given coins against their
+// latest market data and delivers a notice for each rule that fires.
+// Deliveries happen in the background so a slow email server or webhook
+// does not hold up the price update.
+func EvaluateAlerts(coins []models.Coin) error {
+	if len(coins) == 0 {
+		return nil
+	}
+
+	byID := make(map[uint]models.Coin, len(coins))
+	ids := make([]uint, 0, len(coins))
+	for _, coin := range coins {
+		byID[coin.ID] = coin
+		ids = append(ids, coin.ID)
+	}
+
+	var rules []models.AlertRule
+	if err := database.DB.Where("status = ? AND coin_id IN ?", models.AlertStatusActive, ids).Find(&rules).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		coin := byID[rule.CoinID]
+		if rule.LastTriggeredAt != nil && now.Sub(*rule.LastTriggeredAt) < time.Duration(rule.CooldownMinutes)*time.Minute {
+			continue
+		}
+
+		message, fired, err := checkAlertRule(rule, coin, now)
+		if err != nil {
+			log.Printf("Failed to evaluate alert rule %d: %v", rule.ID, err)
+			continue
+		}
+		if !fired {
+			continue
+		}
+
+		claimed, err := claimAlertRule(rule, now)
+		if err != nil {
+			log.Printf("Failed to trigger alert rule %d: %v", rule.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		rule.Coin = coin
+		go deliverAlert(rule, events.Event{
+			Type:        events.AlertTriggered,
+			UserID:      rule.UserID,
+			Title:       fmt.Sprintf("%s alert", coin.Symbol),
+			Message:     message,
+			ReferenceID: rule.ID,
+			Data:        rule,
+			OccurredAt:  now,
+		})
+	}
+	return nil
+}
+
+// checkAlertRule reports whether rule's condition holds for coin, with a
+// human-readable description of why.
+func checkAlertRule(rule models.AlertRule, coin models.Coin, now time.Time) (string, bool, error) {
+	switch rule.Condition {
+	case models.AlertPriceAbove:
+		return fmt.Sprintf("%s is above %.2f (now %.2f)", coin.Symbol, rule.Threshold, coin.CurrentPrice),
+			coin.CurrentPrice >= rule.Threshold, nil
+
+	case models.AlertPriceBelow:
+		return fmt.Sprintf("%s is below %.2f (now %.2f)", coin.Symbol, rule.Threshold, coin.CurrentPrice),
+			coin.CurrentPrice <= rule.Threshold, nil
+
+	case models.AlertPercentChange:
+		// Compare against the last price recorded before the window, or the
+		// oldest one inside it if history does not go back that far.
+		since := now.Add(-time.Duration(rule.WindowMinutes) * time.Minute)
+		var base models.PriceHistory
+		err := database.DB.Where("coin_id = ? AND recorded_at <= ?", coin.ID, since).
+			Order("recorded_at desc").
+			Limit(1).
+			Find(&base).Error
+		if err == nil && base.ID == 0 {
+			err = database.DB.Where("coin_id = ? AND recorded_at > ?", coin.ID, since).
+				Order("recorded_at asc").
+				Limit(1).
+				Find(&base).Error
+		}
+		if err != nil || base.Price <= 0 {
+			return "", false, err
+		}
+
+		change := (coin.CurrentPrice - base.Price) / base.Price * 100
+		fired := change >= rule.Threshold
+		if rule.Threshold < 0 {
+			fired = change <= rule.Threshold
+		}
+		return fmt.Sprintf("%s moved %+.2f%% in the last %d minutes (now %.2f)", coin.Symbol, change, rule.WindowMinutes, coin.CurrentPrice),
+			fired, nil
+
+	case models.AlertVolumeSpike:
+		since := now.Add(-time.Duration(rule.WindowMinutes) * time.Minute)
+		var average float64
+		if err := database.DB.Model(&models.PriceHistory{}).
+			Select("COALESCE(AVG(volume_24h), 0)").
+			Where("coin_id = ? AND recorded_at >= ? AND recorded_at < ?", coin.ID, since, coin.LastUpdated).
+			Scan(&average).Error; err != nil || average <= 0 {
+			return "", false, err
+		}
+
+		ratio := float64(coin.Volume24h) / average
+		return fmt.Sprintf("%s volume is %.1fx its %d minute average", coin.Symbol, ratio, rule.WindowMinutes),
+			ratio >= rule.Threshold, nil
+	}
+	return "", false, nil
+}
+
+// claimAlertRule marks the rule as triggered. The update is conditional on
+// the trigger count it was read with, so concurrent price updates cannot fire
+// the same rule twice.
+func claimAlertRule(rule models.AlertRule, now time.Time) (bool, error) {
+	status := models.AlertStatusActive
+	if rule.Mode == models.AlertModeOnce {
+		status = models.AlertStatusTriggered
+	}
+
+	result := database.DB.Model(&models.AlertRule{}).
+		Where("id = ? AND status = ? AND trigger_count = ?", rule.ID, models.AlertStatusActive, rule.TriggerCount).
+		Updates(map[string]interface{}{
+			"status":            status,
+			"last_triggered_at": now,
+			"trigger_count":     rule.TriggerCount + 1,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// deliverAlert sends a triggered alert over the rule's own channels and
+// publishes it for other subscribers.
+func deliverAlert(rule models.AlertRule, event events.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Delivering alert rule %d panicked: %v", rule.ID, r)
+		}
+	}()
+
+	var user models.User
+	if err := database.DB.First(&user, rule.UserID).Error; err != nil {
+		log.Printf("Failed to load owner of alert rule %d: %v", rule.ID, err)
+		return
+	}
+
+	to := Recipient{User: user, WebhookURL: rule.WebhookURL}
+	for _, channel := range rule.ChannelList() {
+		notifier, ok := notifiers[channel]
+		if !ok {
+			continue
+		}
+		if err := notifier.Notify(to, event); err != nil {
+			log.Printf("Failed to deliver alert rule %d via %s: %v", rule.ID, channel, err)
+		}
+	}
+
+	events.Publish(event)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// maxCorrelationCoins caps the correlation matrix to the largest positions.
+const maxCorrelationCoins = 15
+
+var ErrInvalidCorrelationWindow = errors.New("Window must be one of 7d, 30d or 90d")
+
+var correlationWindows = map[string]time.Duration{
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+// Market cap buckets, largest first, with their lower bounds.
+var marketCapBuckets = []struct {
+	Name string
+	Min  int64
+}{
+	{"large", 10_000_000_000},
+	{"mid", 1_000_000_000},
+	{"small", 100_000_000},
+	{"micro", 0},
+}
+
+// AllocationSlice is the part of the portfolio's holdings in one coin,
+// category or market cap bucket. Weight is a percentage of holdings value,
+// not counting cash.
+type AllocationSlice struct {
+	Key    string  `json:"key"`
+	Value  float64 `json:"value"`
+	Weight float64 `json:"weight"`
+}
+
+// CorrelationMatrix holds the Pearson correlation of daily returns between
+// each pair of held coins. Pairs without at least three overlapping returns
+// are null.
+type CorrelationMatrix struct {
+	Window  string       `json:"window"`
+	Symbols []string     `json:"symbols"`
+	Matrix  [][]*float64 `json:"matrix"`
+}
+
+// Allocation breaks a portfolio's holdings down by coin, category and
+// market cap. The Herfindahl index is the sum of squared coin weights as
+// fractions, from near 0 (spread out) to 1 (a single coin).
+type Allocation struct {
+	PortfolioID          uint              `json:"portfolio_id"`
+	Currency             string            `json:"currency"`
+	TotalValue           float64           `json:"total_value"`
+	HoldingsValue        float64           `json:"holdings_value"`
+	Cash                 float64           `json:"cash"`
+	CashWeight           float64           `json:"cash_weight"`
+	ByCoin               []AllocationSlice `json:"by_coin"`
+	ByCategory           []AllocationSlice `json:"by_category"`
+	ByMarketCap          []AllocationSlice `json:"by_market_cap"`
+	HerfindahlIndex      float64           `json:"herfindahl_index"`
+	EffectivePositions   float64           `json:"effective_positions"`
+	LargestPosition      string            `json:"largest_position,omitempty"`
+	LargestPositionShare float64           `json:"largest_position_share"`
+	Correlation          CorrelationMatrix `json:"correlation"`
+}
+
+// PortfolioAllocation analyses the portfolio's current holdings, with
+// correlations measured over the window (7d, 30d or 90d).
+func PortfolioAllocation(portfolio models.Portfolio, window string) (*Allocation, error) {
+	length, ok := correlationWindows[window]
+	if !ok {
+		return nil, ErrInvalidCorrelationWindow
+	}
+
+	holdings, err := Holdings(database.DB, portfolio.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Largest position first
+	sort.SliceStable(holdings, func(i, j int) bool {
+		return holdings[i].Quantity*holdings[i].Coin.CurrentPrice > holdings[j].Quantity*holdings[j].Coin.CurrentPrice
+	})
+
+	balances, err := CashBalances(portfolio)
+	if err != nil {
+		return nil, err
+	}
+	cash, err := TotalCash(balances, models.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	allocation := &Allocation{
+		PortfolioID: portfolio.ID,
+		Currency:    models.BaseCurrency,
+		Cash:        cash,
+		ByCoin:      []AllocationSlice{},
+		Correlation: CorrelationMatrix{Window: window, Symbols: []string{}, Matrix: [][]*float64{}},
+	}
+
+	byCategory := make(map[string]float64)
+	byMarketCap := make(map[string]float64)
+	for _, holding := range holdings {
+		value := holding.Quantity * holding.Coin.CurrentPrice
+		allocation.HoldingsValue += value
+		allocation.ByCoin = append(allocation.ByCoin, AllocationSlice{Key: holding.Coin.Symbol, Value: value})
+
+		category := holding.Coin.Category
+		if category == "" {
+			category = "uncategorized"
+		}
+		byCategory[category] += value
+		byMarketCap[marketCapBucket(holding.Coin.MarketCap)] += value
+	}
+	allocation.TotalValue = allocation.HoldingsValue + cash
+	if allocation.TotalValue > 0 {
+		allocation.CashWeight = cash / allocation.TotalValue * 100
+	}
+
+	allocation.ByCategory = allocationSlices(byCategory)
+	allocation.ByMarketCap = allocationSlices(byMarketCap)
+
+	if allocation.HoldingsValue > 0 {
+		for i := range allocation.ByCoin {
+			weight := allocation.ByCoin[i].Value / allocation.HoldingsValue
+			allocation.ByCoin[i].Weight = weight * 100
+			allocation.HerfindahlIndex += weight * weight
+		}
+		for _, slices := range [][]AllocationSlice{allocation.ByCategory, allocation.ByMarketCap} {
+			for i := range slices {
+				slices[i].Weight = slices[i].Value / allocation.HoldingsValue * 100
+			}
+		}
+		allocation.EffectivePositions = 1 / allocation.HerfindahlIndex
+		allocation.LargestPosition = allocation.ByCoin[0].Key
+		allocation.LargestPositionShare = allocation.ByCoin[0].Weight
+	}
+
+	if len(holdings) > maxCorrelationCoins {
+		holdings = holdings[:maxCorrelationCoins]
+	}
+	if err := fillCorrelations(&allocation.Correlation, holdings, length); err != nil {
+		return nil, err
+	}
+	return allocation, nil
+}
+
+func marketCapBucket(marketCap int64) string {
+	for _, bucket := range marketCapBuckets {
+		if marketCap >= bucket.Min {
+			return bucket.Name
+		}
+	}
+	return marketCapBuckets[len(marketCapBuckets)-1].Name
+}
+
+// allocationSlices turns totals by key into slices, largest first.
+func allocationSlices(values map[string]float64) []AllocationSlice {
+	slices := make([]AllocationSlice, 0, len(values))
+	for key, value := range values {
+		slices = append(slices, AllocationSlice{Key: key, Value: value})
+	}
+	sort.Slice(slices, func(i, j int) bool {
+		if slices[i].Value != slices[j].Value {
+			return slices[i].Value > slices[j].Value
+		}
+		return slices[i].Key < slices[j].Key
+	})
+	return slices
+}
+
+// fillCorrelations correlates the daily close-to-close returns of the
+// holdings' coins over the window, matching returns by day.
+func fillCorrelations(matrix *CorrelationMatrix, holdings []models.UserCoin, length time.Duration) error {
+	since := time.Now().Add(-length).Truncate(24 * time.Hour)
+
+	returns := make([]map[int64]float64, len(holdings))
+	for i, holding := range holdings {
+		candles, err := Candles(holding.CoinID, 24*time.Hour, since)
+		if err != nil {
+			return err
+		}
+		returns[i] = make(map[int64]float64)
+		for j := 1; j < len(candles); j++ {
+			if previous := candles[j-1].Close; previous > 0 {
+				returns[i][candles[j].Time.Unix()] = candles[j].Close/previous - 1
+			}
+		}
+		matrix.Symbols = append(matrix.Symbols, holding.Coin.Symbol)
+	}
+
+	matrix.Matrix = make([][]*float64, len(holdings))
+	for i := range holdings {
+		matrix.Matrix[i] = make([]*float64, len(holdings))
+	}
+	for i := range holdings {
+		for j := i; j < len(holdings); j++ {
+			if correlation, ok := correlate(returns[i], returns[j]); ok {
+				matrix.Matrix[i][j] = &correlation
+				matrix.Matrix[j][i] = &correlation
+			}
+		}
+	}
+	return nil
+}
+
+// correlate is the Pearson correlation of two return series over the days
+// they share.
+func correlate(a, b map[int64]float64) (float64, bool) {
+	var xs, ys []float64
+	for day, x := range a {
+		if y, ok := b[day]; ok {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	if len(xs) < 3 {
+		return 0, false
+	}
+
+	meanX, deviationX := meanAndDeviation(xs)
+	meanY, deviationY := meanAndDeviation(ys)
+	if deviationX == 0 || deviationY == 0 {
+		return 0, false
+	}
+
+	var covariance float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	covariance /= float64(len(xs) - 1)
+	return math.Max(-1, math.Min(1, covariance/(deviationX*deviationY))), true
+}
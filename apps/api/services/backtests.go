@@ -0,0 +1,438 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"crypto-app-api/strategies"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxBacktestBars caps how many candles one backtest replays.
+	MaxBacktestBars = 10000
+	// maxActiveBacktests caps each user's queued and running backtests.
+	maxActiveBacktests = 3
+	// backtestLease is how long a claimed backtest may run before another
+	// replica assumes it was lost and runs it again.
+	backtestLease = 10 * time.Minute
+)
+
+var (
+	ErrBacktestNotFound     = errors.New("Backtest not found")
+	ErrInvalidBacktestRange = errors.New("Backtest range must end after it starts, not in the future, and span at most 10000 candles")
+	ErrInvalidBacktestCosts = errors.New("Starting cash must be positive, and fee rate and slippage between 0 and 10 percent")
+	ErrTooManyBacktests     = errors.New("You already have 3 backtests queued or running")
+	errNotEnoughHistory     = errors.New("Not enough price history in this range for the strategy")
+)
+
+// BacktestTrade is one simulated fill. RealizedPnL is set on sells, net of
+// fees: the sell's own and, through the position's average price, those of
+// the buys it closes.
+type BacktestTrade struct {
+	Time        time.Time `json:"time"`
+	Side        string    `json:"side"`
+	Quantity    float64   `json:"quantity"`
+	Price       float64   `json:"price"`
+	TotalAmount float64   `json:"total_amount"`
+	Fee         float64   `json:"fee"`
+	RealizedPnL float64   `json:"realized_pnl,omitempty"`
+}
+
+// BacktestStats summarises a run. Returns, drawdown, volatility and win rate
+// are in percent; BuyAndHoldReturn is what holding the coin over the same
+// bars would have returned.
+type BacktestStats struct {
+	StartValue       float64 `json:"start_value"`
+	EndValue         float64 `json:"end_value"`
+	TotalReturn      float64 `json:"total_return"`
+	BuyAndHoldReturn float64 `json:"buy_and_hold_return"`
+	MaxDrawdown      float64 `json:"max_drawdown"`
+	Volatility       float64 `json:"volatility"`
+	SharpeRatio      float64 `json:"sharpe_ratio"`
+	Trades           int     `json:"trades"`
+	WinRate          float64 `json:"win_rate"`
+	FeesPaid         float64 `json:"fees_paid"`
+}
+
+// BacktestResult is what a completed backtest produced. The equity curve
+// has one point per bar, valued at its close.
+type BacktestResult struct {
+	Stats  BacktestStats      `json:"stats"`
+	Trades []BacktestTrade    `json:"trades"`
+	Equity []PerformancePoint `json:"equity"`
+}
+
+// BacktestReport is a backtest with its params and, once completed, its
+// result decoded.
+type BacktestReport struct {
+	models.Backtest
+	Params strategies.Params `json:"params"`
+	Result *BacktestResult   `json:"result,omitempty"`
+}
+
+// CreateBacktest validates the request and queues the backtest for the
+// backtests job. The fee rate is an explicit request parameter that defaults
+// to 0, matching ExecuteTrade, which charges no fee on paper trades.
+func CreateBacktest(userID uint, req models.BacktestRequest) (*BacktestReport, error) {
+	_, params, err := strategies.New(req.Strategy, req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Interval == "" {
+		req.Interval = "1h"
+	}
+	interval, ok := CandleIntervals[req.Interval]
+	if !ok {
+		return nil, ErrInvalidInterval
+	}
+
+	end := time.Now()
+	if req.EndAt != nil {
+		end = *req.EndAt
+	}
+	start := end.Add(-30 * 24 * time.Hour)
+	if req.StartAt != nil {
+		start = *req.StartAt
+	}
+	if !start.Before(end) || end.After(time.Now().Add(time.Minute)) || end.Sub(start)/interval > MaxBacktestBars {
+		return nil, ErrInvalidBacktestRange
+	}
+
+	if req.InitialCash == 0 {
+		req.InitialCash = models.DefaultStartingBalance
+	}
+	feeRate, slippage := 0.0, 0.05
+	if req.FeeRate != nil {
+		feeRate = *req.FeeRate
+	}
+	if req.Slippage != nil {
+		slippage = *req.Slippage
+	}
+	if req.InitialCash <= 0 || feeRate < 0 || feeRate > 10 || slippage < 0 || slippage > 10 {
+		return nil, ErrInvalidBacktestCosts
+	}
+
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	backtest := models.Backtest{
+		UserID:      userID,
+		CoinID:      coin.ID,
+		Strategy:    req.Strategy,
+		Params:      string(encoded),
+		Interval:    req.Interval,
+		StartAt:     start,
+		EndAt:       end,
+		InitialCash: req.InitialCash,
+		FeeRate:     feeRate,
+		Slippage:    slippage,
+		Status:      models.BacktestPending,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialise creation per user so the cap cannot be raced past
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error; err != nil {
+			return err
+		}
+		var active int64
+		if err := tx.Model(&models.Backtest{}).
+			Where("user_id = ? AND status IN ?", userID, []string{models.BacktestPending, models.BacktestRunning}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active >= maxActiveBacktests {
+			return ErrTooManyBacktests
+		}
+		return tx.Create(&backtest).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	backtest.Coin = coin
+	return &BacktestReport{Backtest: backtest, Params: params}, nil
+}
+
+// GetBacktest returns one of the user's backtests with its result.
+func GetBacktest(userID, id uint) (*BacktestReport, error) {
+	var backtest models.Backtest
+	if err := database.DB.Preload("Coin").Where("id = ? AND user_id = ?", id, userID).First(&backtest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBacktestNotFound
+		}
+		return nil, err
+	}
+	return backtestReport(backtest, true)
+}
+
+func backtestReport(backtest models.Backtest, withResult bool) (*BacktestReport, error) {
+	report := &BacktestReport{Backtest: backtest}
+	if err := json.Unmarshal([]byte(backtest.Params), &report.Params); err != nil {
+		return nil, err
+	}
+	if withResult && backtest.Result != "" {
+		report.Result = &BacktestResult{}
+		if err := json.Unmarshal([]byte(backtest.Result), report.Result); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// ListBacktests returns the user's backtests, newest first, without their
+// results.
+func ListBacktests(userID uint, limit int) ([]BacktestReport, error) {
+	var backtests []models.Backtest
+	if err := database.DB.Preload("Coin").
+		Omit("result").
+		Where("user_id = ?", userID).
+		Order("created_at desc").
+		Limit(limit).
+		Find(&backtests).Error; err != nil {
+		return nil, err
+	}
+
+	reports := make([]BacktestReport, 0, len(backtests))
+	for _, backtest := range backtests {
+		report, err := backtestReport(backtest, false)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+func DeleteBacktest(userID, id uint) error {
+	result := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Backtest{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBacktestNotFound
+	}
+	return nil
+}
+
+// RunPendingBacktests claims queued backtests, and running ones whose lease
+// expired, under a SKIP LOCKED row lock so each is run by one replica, then
+// runs them.
+func RunPendingBacktests() error {
+	var claimed []models.Backtest
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND started_at < ?)",
+				models.BacktestPending, models.BacktestRunning, now.Add(-backtestLease)).
+			Order("created_at asc").
+			Limit(2).
+			Find(&claimed).Error; err != nil {
+			return err
+		}
+
+		if len(claimed) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(claimed))
+		for i, backtest := range claimed {
+			ids[i] = backtest.ID
+		}
+		return tx.Model(&models.Backtest{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": models.BacktestRunning, "started_at": now}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, backtest := range claimed {
+		updates := map[string]interface{}{"completed_at": time.Now()}
+		result, err := runBacktest(backtest)
+		if err == nil {
+			var encoded []byte
+			encoded, err = json.Marshal(result)
+			updates["result"] = string(encoded)
+		}
+		if err != nil {
+			log.Printf("Backtest %d failed: %v", backtest.ID, err)
+			updates["status"] = models.BacktestFailed
+			updates["error"] = err.Error()
+			if !errors.Is(err, errNotEnoughHistory) {
+				updates["error"] = "Backtest failed"
+			}
+		} else {
+			updates["status"] = models.BacktestCompleted
+		}
+
+		if err := database.DB.Model(&models.Backtest{}).
+			Where("id = ? AND status = ?", backtest.ID, models.BacktestRunning).
+			Updates(updates).Error; err != nil {
+			log.Printf("Failed to record backtest %d: %v", backtest.ID, err)
+		}
+	}
+	return nil
+}
+
+func runBacktest(backtest models.Backtest) (*BacktestResult, error) {
+	var params strategies.Params
+	if err := json.Unmarshal([]byte(backtest.Params), &params); err != nil {
+		return nil, err
+	}
+	strategy, _, err := strategies.New(backtest.Strategy, params)
+	if err != nil {
+		return nil, err
+	}
+
+	candles, err := CandleRange(backtest.CoinID, CandleIntervals[backtest.Interval], backtest.StartAt, backtest.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	// One more bar than the warmup so there is somewhere to fill an order
+	if len(candles) <= strategy.Warmup() {
+		return nil, errNotEnoughHistory
+	}
+
+	bars := make([]strategies.Bar, len(candles))
+	for i, candle := range candles {
+		bars[i] = strategies.Bar{
+			Index:  i,
+			Time:   candle.Time,
+			Open:   candle.Open,
+			High:   candle.High,
+			Low:    candle.Low,
+			Close:  candle.Close,
+			Volume: candle.Volume,
+		}
+	}
+	return simulate(strategy, bars, backtest.InitialCash, backtest.FeeRate/100, backtest.Slippage/100), nil
+}
+
+// simulate replays bars through the strategy. Orders are filled at the open
+// of the bar after the one they were decided on, moved against the trade by
+// slippage, and pay fees on top, so a buy of all cash buys slightly less
+// than cash/price. Fills use the same math as ExecuteTrade: the total is
+// quantity times price and buys blend into the average price, here with
+// their fee added to the cost.
+func simulate(strategy strategies.Strategy, bars []strategies.Bar, cash, feeRate, slippage float64) *BacktestResult {
+	position := strategies.Position{Cash: cash}
+	result := &BacktestResult{Trades: []BacktestTrade{}}
+	snapshots := make([]models.PortfolioSnapshot, 0, len(bars))
+
+	var pending *strategies.Order
+	var wins int
+	for i, bar := range bars {
+		if pending != nil {
+			if trade := fill(&position, *pending, bar, feeRate, slippage); trade != nil {
+				result.Trades = append(result.Trades, *trade)
+				result.Stats.FeesPaid += trade.Fee
+				if trade.Side == strategies.Sell && trade.RealizedPnL > 0 {
+					wins++
+				}
+			}
+			pending = nil
+		}
+
+		holdingsValue := position.Quantity * bar.Close
+		snapshots = append(snapshots, models.PortfolioSnapshot{
+			Cash:          position.Cash,
+			HoldingsValue: holdingsValue,
+			TotalValue:    position.Cash + holdingsValue,
+			RecordedAt:    bar.Time,
+		})
+
+		if i+1 >= strategy.Warmup() && i < len(bars)-1 {
+			pending = strategy.Next(bars[:i+1], position)
+		}
+	}
+
+	performance := measurePerformance("backtest", snapshots, 0)
+	result.Equity = performance.Points
+	result.Stats.StartValue = performance.StartValue
+	result.Stats.EndValue = performance.EndValue
+	result.Stats.TotalReturn = performance.TimeWeightedReturn
+	result.Stats.MaxDrawdown = performance.MaxDrawdown
+	result.Stats.Volatility = performance.Volatility
+	result.Stats.SharpeRatio = performance.SharpeRatio
+	result.Stats.Trades = len(result.Trades)
+	if first := bars[0].Open; first > 0 {
+		result.Stats.BuyAndHoldReturn = (bars[len(bars)-1].Close/first - 1) * 100
+	}
+
+	var sells int
+	for _, trade := range result.Trades {
+		if trade.Side == strategies.Sell {
+			sells++
+		}
+	}
+	if sells > 0 {
+		result.Stats.WinRate = float64(wins) / float64(sells) * 100
+	}
+	return result
+}
+
+// fill executes an order at the bar's open, returning nil when there is
+// nothing to trade.
+func fill(position *strategies.Position, order strategies.Order, bar strategies.Bar, feeRate, slippage float64) *BacktestTrade {
+	trade := &BacktestTrade{Time: bar.Time, Side: order.Side}
+
+	switch order.Side {
+	case strategies.Buy:
+		spend := position.Cash
+		if order.Amount > 0 {
+			spend = math.Min(order.Amount, position.Cash)
+		}
+		trade.Price = bar.Open * (1 + slippage)
+		if spend < 0.01 || trade.Price <= 0 {
+			return nil
+		}
+		trade.Quantity = spend / (trade.Price * (1 + feeRate))
+		trade.TotalAmount = trade.Quantity * trade.Price
+		trade.Fee = trade.TotalAmount * feeRate
+
+		cost := (trade.TotalAmount + trade.Fee) / trade.Quantity
+		position.AveragePrice = blendAveragePrice(position.Quantity, position.AveragePrice, trade.Quantity, cost)
+		position.Quantity += trade.Quantity
+		position.Cash -= trade.TotalAmount + trade.Fee
+	case strategies.Sell:
+		trade.Quantity = position.Quantity
+		if order.Quantity > 0 {
+			trade.Quantity = math.Min(order.Quantity, position.Quantity)
+		}
+		trade.Price = bar.Open * (1 - slippage)
+		if trade.Quantity <= 0 || trade.Price <= 0 {
+			return nil
+		}
+		trade.TotalAmount = trade.Quantity * trade.Price
+		trade.Fee = trade.TotalAmount * feeRate
+		trade.RealizedPnL = (trade.Price-position.AveragePrice)*trade.Quantity - trade.Fee
+
+		position.Quantity -= trade.Quantity
+		position.Cash += trade.TotalAmount - trade.Fee
+		if position.Quantity <= lotEpsilon {
+			position.Quantity, position.AveragePrice = 0, 0
+		}
+	default:
+		return nil
+	}
+
+	if position.Cash < 0 {
+		position.Cash = 0
+	}
+	return trade
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"crypto-app-api/strategies"
+	"math"
+	"testing"
+	"time"
+)
+
+func testBars(opens, closes []float64) []strategies.Bar {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]strategies.Bar, len(opens))
+	for i := range opens {
+		bars[i] = strategies.Bar{Index: i, Time: start.Add(time.Duration(i) * time.Hour), Open: opens[i], Close: closes[i]}
+	}
+	return bars
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFill(t *testing.T) {
+	bar := strategies.Bar{Open: 100}
+	tests := []struct {
+		name     string
+		position strategies.Position
+		order    strategies.Order
+		want     *BacktestTrade
+		after    strategies.Position
+	}{
+		{
+			name:     "buy with all cash pays slippage and fee",
+			position: strategies.Position{Cash: 1030.2},
+			order:    strategies.Order{Side: strategies.Buy},
+			want:     &BacktestTrade{Side: strategies.Buy, Quantity: 10, Price: 102, TotalAmount: 1020, Fee: 10.2},
+			// The fee is part of the cost basis
+			after: strategies.Position{Cash: 0, Quantity: 10, AveragePrice: 103.02},
+		},
+		{
+			name:     "buy amount is capped to cash",
+			position: strategies.Position{Cash: 515.1},
+			order:    strategies.Order{Side: strategies.Buy, Amount: 5000},
+			want:     &BacktestTrade{Side: strategies.Buy, Quantity: 5, Price: 102, TotalAmount: 510, Fee: 5.1},
+			after:    strategies.Position{Cash: 0, Quantity: 5, AveragePrice: 103.02},
+		},
+		{
+			name:     "buy blends into the average price",
+			position: strategies.Position{Cash: 515.1, Quantity: 5, AveragePrice: 90},
+			order:    strategies.Order{Side: strategies.Buy, Amount: 515.1},
+			want:     &BacktestTrade{Side: strategies.Buy, Quantity: 5, Price: 102, TotalAmount: 510, Fee: 5.1},
+			after:    strategies.Position{Cash: 0, Quantity: 10, AveragePrice: 96.51},
+		},
+		{
+			name:     "partial sell is net of its fee",
+			position: strategies.Position{Quantity: 10, AveragePrice: 90},
+			order:    strategies.Order{Side: strategies.Sell, Quantity: 4},
+			want:     &BacktestTrade{Side: strategies.Sell, Quantity: 4, Price: 98, TotalAmount: 392, Fee: 3.92, RealizedPnL: 28.08},
+			after:    strategies.Position{Cash: 388.08, Quantity: 6, AveragePrice: 90},
+		},
+		{
+			name:     "sell everything",
+			position: strategies.Position{Cash: 1, Quantity: 2, AveragePrice: 110},
+			order:    strategies.Order{Side: strategies.Sell},
+			want:     &BacktestTrade{Side: strategies.Sell, Quantity: 2, Price: 98, TotalAmount: 196, Fee: 1.96, RealizedPnL: -25.96},
+			after:    strategies.Position{Cash: 195.04},
+		},
+		{
+			name:     "buy without cash",
+			position: strategies.Position{Cash: 0.001},
+			order:    strategies.Order{Side: strategies.Buy},
+			after:    strategies.Position{Cash: 0.001},
+		},
+		{
+			name:     "sell without a position",
+			position: strategies.Position{Cash: 50},
+			order:    strategies.Order{Side: strategies.Sell},
+			after:    strategies.Position{Cash: 50},
+		},
+		{
+			name:     "unknown side",
+			position: strategies.Position{Cash: 50},
+			order:    strategies.Order{Side: "hold"},
+			after:    strategies.Position{Cash: 50},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position := tt.position
+			trade := fill(&position, tt.order, bar, 0.01, 0.02)
+
+			if (trade == nil) != (tt.want == nil) {
+				t.Fatalf("fill() = %+v, want %+v", trade, tt.want)
+			}
+			if trade != nil && (trade.Side != tt.want.Side || !approx(trade.Quantity, tt.want.Quantity) ||
+				!approx(trade.Price, tt.want.Price) || !approx(trade.TotalAmount, tt.want.TotalAmount) ||
+				!approx(trade.Fee, tt.want.Fee) || !approx(trade.RealizedPnL, tt.want.RealizedPnL)) {
+				t.Errorf("fill() = %+v, want %+v", *trade, *tt.want)
+			}
+			if !approx(position.Cash, tt.after.Cash) || !approx(position.Quantity, tt.after.Quantity) ||
+				!approx(position.AveragePrice, tt.after.AveragePrice) {
+				t.Errorf("position = %+v, want %+v", position, tt.after)
+			}
+		})
+	}
+}
+
+// TestFillRoundTrip checks that the realized P&L of buying twice and selling
+// everything is exactly what the round trip did to cash, all fees included.
+func TestFillRoundTrip(t *testing.T) {
+	position := strategies.Position{Cash: 1000}
+	fill(&position, strategies.Order{Side: strategies.Buy, Amount: 400}, strategies.Bar{Open: 100}, 0.001, 0.0005)
+	fill(&position, strategies.Order{Side: strategies.Buy}, strategies.Bar{Open: 80}, 0.001, 0.0005)
+	sell := fill(&position, strategies.Order{Side: strategies.Sell}, strategies.Bar{Open: 120}, 0.001, 0.0005)
+
+	if sell == nil {
+		t.Fatal("sell did not fill")
+	}
+	if !approx(sell.RealizedPnL, position.Cash-1000) {
+		t.Errorf("RealizedPnL = %v, want the %v the round trip made", sell.RealizedPnL, position.Cash-1000)
+	}
+}
+
+// scripted places the given orders after the bars with those indexes.
+type scripted map[int]*strategies.Order
+
+func (s scripted) Warmup() int {
+	return 1
+}
+
+func (s scripted) Next(history []strategies.Bar, position strategies.Position) *strategies.Order {
+	return s[history[len(history)-1].Index]
+}
+
+func TestSimulate(t *testing.T) {
+	bars := testBars(
+		[]float64{100, 100, 110, 120, 130, 90},
+		[]float64{100, 110, 120, 130, 90, 95},
+	)
+	strategy := scripted{
+		0: {Side: strategies.Buy},
+		2: {Side: strategies.Sell},
+		3: {Side: strategies.Buy},
+		4: {Side: strategies.Sell},
+		// Decided on the last bar, so never filled
+		5: {Side: strategies.Buy},
+	}
+
+	result := simulate(strategy, bars, 1000, 0, 0)
+
+	wantTrades := []struct {
+		side  string
+		price float64
+	}{
+		{strategies.Buy, 100}, {strategies.Sell, 120}, {strategies.Buy, 130}, {strategies.Sell, 90},
+	}
+	if len(result.Trades) != len(wantTrades) {
+		t.Fatalf("got %d trades, want %d", len(result.Trades), len(wantTrades))
+	}
+	for i, want := range wantTrades {
+		trade := result.Trades[i]
+		if trade.Side != want.side || trade.Price != want.price || !trade.Time.Equal(bars[[]int{1, 3, 4, 5}[i]].Time) {
+			t.Errorf("trade %d = %+v, want a %s at the next bar's open %v", i, trade, want.side, want.price)
+		}
+	}
+
+	if len(result.Equity) != len(bars) {
+		t.Fatalf("got %d equity points, want one per bar", len(result.Equity))
+	}
+	// 1000 buys 10 at 100, sold at 120 for 1200, buys 9.23 at 130, sold at 90
+	wantValues := []float64{1000, 1100, 1200, 1200, 1200.0 * 90 / 130, 1200.0 * 90 / 130}
+	for i, want := range wantValues {
+		if !approx(result.Equity[i].Value, want) {
+			t.Errorf("equity[%d] = %v, want %v", i, result.Equity[i].Value, want)
+		}
+	}
+
+	stats := result.Stats
+	if stats.Trades != 4 || stats.WinRate != 50 || stats.FeesPaid != 0 {
+		t.Errorf("stats = %+v, want 4 trades, 50%% win rate and no fees", stats)
+	}
+	if !approx(stats.TotalReturn, (1200*90.0/130/1000-1)*100) || !approx(stats.BuyAndHoldReturn, -5) {
+		t.Errorf("returns = %v, buy and hold %v", stats.TotalReturn, stats.BuyAndHoldReturn)
+	}
+	if !approx(stats.MaxDrawdown, (90.0/130-1)*100) {
+		t.Errorf("MaxDrawdown = %v, want %v", stats.MaxDrawdown, (90.0/130-1)*100)
+	}
+}
+
+func TestSimulateCosts(t *testing.T) {
+	bars := testBars([]float64{100, 100, 100}, []float64{100, 100, 100})
+	strategy := scripted{0: {Side: strategies.Buy}, 1: {Side: strategies.Sell}}
+
+	result := simulate(strategy, bars, 1000, 0.01, 0.01)
+
+	if len(result.Trades) != 2 {
+		t.Fatalf("got %d trades, want 2", len(result.Trades))
+	}
+	buy, sell := result.Trades[0], result.Trades[1]
+	if !approx(result.Stats.FeesPaid, buy.Fee+sell.Fee) {
+		t.Errorf("FeesPaid = %v, want %v", result.Stats.FeesPaid, buy.Fee+sell.Fee)
+	}
+	// A flat market loses exactly the costs, and the sell's P&L says so
+	end := result.Stats.EndValue
+	if !approx(sell.RealizedPnL, end-1000) || sell.RealizedPnL >= 0 {
+		t.Errorf("RealizedPnL = %v, want the %v lost to costs", sell.RealizedPnL, end-1000)
+	}
+	if result.Stats.WinRate != 0 {
+		t.Errorf("WinRate = %v, want 0", result.Stats.WinRate)
+	}
+}
+
+func TestSimulateDCA(t *testing.T) {
+	strategy, _, err := strategies.New("dca", strategies.Params{"amount": 100, "every": 2})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	bars := testBars([]float64{10, 10, 20, 20, 40, 40}, []float64{10, 10, 20, 20, 40, 40})
+
+	result := simulate(strategy, bars, 1000, 0, 0)
+
+	// Decided on bars 0, 2 and 4 and filled on the bar after each
+	if len(result.Trades) != 3 {
+		t.Fatalf("got %d trades, want 3", len(result.Trades))
+	}
+	wantQuantity := 100.0/10 + 100.0/20 + 100.0/40
+	last := result.Equity[len(result.Equity)-1]
+	if !approx(last.Value, 700+wantQuantity*40) {
+		t.Errorf("final value = %v, want %v", last.Value, 700+wantQuantity*40)
+	}
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const maxBenchmarks = 20
+
+var (
+	ErrBenchmarkNotFound       = errors.New("Benchmark not found")
+	ErrInvalidBenchmark        = errors.New("Benchmark must be one of coin, market_cap, equal_weight or basket")
+	ErrInvalidBenchmarkName    = errors.New("Benchmark name is required")
+	ErrInvalidBenchmarkWeights = errors.New("Benchmark weights must be positive, unique per coin and add up to 100")
+	ErrTooManyBenchmarks       = errors.New("Benchmark limit reached")
+)
+
+// BuiltInBenchmark describes a benchmark that is always available.
+type BuiltInBenchmark struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// BuiltInBenchmarks lists the benchmarks every user can compare against.
+var BuiltInBenchmarks = []BuiltInBenchmark{
+	{Type: models.BenchmarkCoin, Name: "Single coin", Description: "Buy and hold one coin, BTC unless another symbol is given"},
+	{Type: models.BenchmarkMarketCap, Name: "Market cap index", Description: "Every listed coin weighted by market cap, reweighted each period"},
+	{Type: models.BenchmarkEqualWeight, Name: "Equal weight index", Description: "Every listed coin in equal weight, rebalanced each period"},
+}
+
+// BenchmarkSpec picks the benchmark to compare against. Symbol is used by
+// coin benchmarks and BasketID by basket benchmarks.
+type BenchmarkSpec struct {
+	Type     string
+	Symbol   string
+	BasketID uint
+}
+
+// BenchmarkPoint pairs the portfolio's and the benchmark's cumulative
+// returns since the start of the range, in percent.
+type BenchmarkPoint struct {
+	Time            time.Time `json:"time"`
+	PortfolioReturn float64   `json:"portfolio_return"`
+	BenchmarkReturn float64   `json:"benchmark_return"`
+}
+
+// BenchmarkComparison sets the user's returns against a benchmark's over the
+// same points. Returns, alpha and tracking error are in percent; alpha and
+// tracking error are annualised.
+type BenchmarkComparison struct {
+	Range           string           `json:"range"`
+	Benchmark       string           `json:"benchmark"`
+	BenchmarkName   string           `json:"benchmark_name"`
+	PortfolioReturn float64          `json:"portfolio_return"`
+	BenchmarkReturn float64          `json:"benchmark_return"`
+	ExcessReturn    float64          `json:"excess_return"`
+	Alpha           float64          `json:"alpha"`
+	Beta            float64          `json:"beta"`
+	Correlation     float64          `json:"correlation"`
+	TrackingError   float64          `json:"tracking_error"`
+	Points          []BenchmarkPoint `json:"points"`
+}
+
+// benchmarkIndex is a resolved benchmark. Fixed weights are used as given;
+// index benchmarks without them weight every coin each period.
+type benchmarkIndex struct {
+	Type    string
+	Name    string
+	CoinIDs []uint
+	Weights map[uint]float64
+}
+
+func CreateBenchmark(userID uint, req models.BenchmarkRequest) (*models.Benchmark, error) {
+	components, err := benchmarkComponents(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	database.DB.Model(&models.Benchmark{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxBenchmarks {
+		return nil, ErrTooManyBenchmarks
+	}
+
+	benchmark := models.Benchmark{
+		UserID:     userID,
+		Name:       strings.TrimSpace(req.Name),
+		Components: components,
+	}
+	if err := database.DB.Create(&benchmark).Error; err != nil {
+		return nil, err
+	}
+	return GetBenchmark(userID, benchmark.ID)
+}
+
+// UpdateBenchmark renames a basket and replaces its components.
+func UpdateBenchmark(userID, id uint, req models.BenchmarkRequest) (*models.Benchmark, error) {
+	components, err := benchmarkComponents(req)
+	if err != nil {
+		return nil, err
+	}
+
+	benchmark, err := GetBenchmark(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(benchmark).Update("name", strings.TrimSpace(req.Name)).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("benchmark_id = ?", benchmark.ID).Delete(&models.BenchmarkComponent{}).Error; err != nil {
+			return err
+		}
+		for i := range components {
+			components[i].BenchmarkID = benchmark.ID
+		}
+		return tx.Create(&components).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetBenchmark(userID, id)
+}
+
+func DeleteBenchmark(userID, id uint) error {
+	benchmark, err := GetBenchmark(userID, id)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("benchmark_id = ?", benchmark.ID).Delete(&models.BenchmarkComponent{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(benchmark).Error
+	})
+}
+
+func GetBenchmark(userID, id uint) (*models.Benchmark, error) {
+	var benchmark models.Benchmark
+	if err := database.DB.Preload("Components.Coin").
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&benchmark).Error; err != nil {
+		return nil, ErrBenchmarkNotFound
+	}
+	return &benchmark, nil
+}
+
+func benchmarkComponents(req models.BenchmarkRequest) ([]models.BenchmarkComponent, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, ErrInvalidBenchmarkName
+	}
+	if len(req.Components) == 0 {
+		return nil, ErrInvalidBenchmarkWeights
+	}
+
+	seen := make(map[uint]bool)
+	var sum float64
+	components := make([]models.BenchmarkComponent, 0, len(req.Components))
+	for _, component := range req.Components {
+		if component.Weight <= 0 || seen[component.CoinID] {
+			return nil, ErrInvalidBenchmarkWeights
+		}
+		seen[component.CoinID] = true
+		sum += component.Weight
+		components = append(components, models.BenchmarkComponent{CoinID: component.CoinID, Weight: component.Weight})
+	}
+	if math.Abs(sum-100) > 1e-6 {
+		return nil, ErrInvalidBenchmarkWeights
+	}
+
+	var count int64
+	database.DB.Model(&models.Coin{}).Where("id IN ?", keys(seen)).Count(&count)
+	if int(count) != len(seen) {
+		return nil, ErrCoinNotFound
+	}
+	return components, nil
+}
+
+func resolveBenchmark(userID uint, spec BenchmarkSpec) (*benchmarkIndex, error) {
+	switch spec.Type {
+	case models.BenchmarkCoin:
+		symbol := strings.ToUpper(spec.Symbol)
+		if symbol == "" {
+			symbol = "BTC"
+		}
+		var coin models.Coin
+		if err := database.DB.Where("symbol = ?", symbol).First(&coin).Error; err != nil {
+			return nil, ErrCoinNotFound
+		}
+		return &benchmarkIndex{
+			Type:    spec.Type,
+			Name:    coin.Symbol,
+			CoinIDs: []uint{coin.ID},
+			Weights: map[uint]float64{coin.ID: 100},
+		}, nil
+	case models.BenchmarkMarketCap, models.BenchmarkEqualWeight:
+		var coinIDs []uint
+		if err := database.DB.Model(&models.Coin{}).Pluck("id", &coinIDs).Error; err != nil {
+			return nil, err
+		}
+		name := "Market cap index"
+		if spec.Type == models.BenchmarkEqualWeight {
+			name = "Equal weight index"
+		}
+		return &benchmarkIndex{Type: spec.Type, Name: name, CoinIDs: coinIDs}, nil
+	case models.BenchmarkBasket:
+		benchmark, err := GetBenchmark(userID, spec.BasketID)
+		if err != nil {
+			return nil, err
+		}
+		index := &benchmarkIndex{Type: spec.Type, Name: benchmark.Name, Weights: make(map[uint]float64)}
+		for _, component := range benchmark.Components {
+			index.CoinIDs = append(index.CoinIDs, component.CoinID)
+			index.Weights[component.CoinID] = component.Weight
+		}
+		return index, nil
+	}
+	return nil, ErrInvalidBenchmark
+}
+
+// CompareToBenchmark lines the user's performance over the range up with the
+// benchmark's return over the same points. riskFree is the annual risk-free
+// rate in percent used for alpha.
+func CompareToBenchmark(userID uint, rangeName string, spec BenchmarkSpec, riskFree float64) (*BenchmarkComparison, error) {
+	index, err := resolveBenchmark(userID, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	performance, err := UserPerformance(userID, rangeName, riskFree)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Time, len(performance.Points))
+	for i, point := range performance.Points {
+		times[i] = point.Time
+	}
+	markets, err := marketsAt(index.CoinIDs, times)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &BenchmarkComparison{
+		Range:           rangeName,
+		Benchmark:       index.Type,
+		BenchmarkName:   index.Name,
+		PortfolioReturn: performance.TimeWeightedReturn,
+		Points:          make([]BenchmarkPoint, 0, len(times)),
+	}
+
+	level := 1.0
+	var portfolioReturns, benchmarkReturns []float64
+	for i, point := range performance.Points {
+		if i > 0 {
+			r, ok := index.periodReturn(markets[i-1], markets[i])
+			if ok {
+				level *= 1 + r
+				// Periods after the portfolio is wiped out are left out of
+				// the statistics, which compare the two period by period
+				if portfolioReturn, ok := pointReturn(performance.Points[i-1], point); ok {
+					portfolioReturns = append(portfolioReturns, portfolioReturn)
+					benchmarkReturns = append(benchmarkReturns, r)
+				}
+			}
+		}
+		comparison.Points = append(comparison.Points, BenchmarkPoint{
+			Time:            point.Time,
+			PortfolioReturn: point.CumulativeReturn,
+			BenchmarkReturn: (level - 1) * 100,
+		})
+	}
+	comparison.BenchmarkReturn = (level - 1) * 100
+	comparison.ExcessReturn = comparison.PortfolioReturn - comparison.BenchmarkReturn
+
+	periods := periodsPerYear(performance.Points)
+	if len(benchmarkReturns) < 2 || periods == 0 {
+		return comparison, nil
+	}
+
+	meanPortfolio, deviationPortfolio := meanAndDeviation(portfolioReturns)
+	meanBenchmark, deviationBenchmark := meanAndDeviation(benchmarkReturns)
+
+	differences := make([]float64, len(portfolioReturns))
+	var covariance float64
+	for i := range portfolioReturns {
+		covariance += (portfolioReturns[i] - meanPortfolio) * (benchmarkReturns[i] - meanBenchmark)
+		differences[i] = portfolioReturns[i] - benchmarkReturns[i]
+	}
+	covariance /= float64(len(portfolioReturns) - 1)
+
+	if deviationBenchmark > 0 {
+		comparison.Beta = covariance / (deviationBenchmark * deviationBenchmark)
+		if deviationPortfolio > 0 {
+			comparison.Correlation = covariance / (deviationPortfolio * deviationBenchmark)
+		}
+	}
+
+	// Jensen's alpha per period, annualised
+	riskFreePerPeriod := riskFree / 100 / periods
+	alpha := (meanPortfolio - riskFreePerPeriod) - comparison.Beta*(meanBenchmark-riskFreePerPeriod)
+	comparison.Alpha = alpha * periods * 100
+
+	_, trackingDeviation := meanAndDeviation(differences)
+	comparison.TrackingError = trackingDeviation * math.Sqrt(periods) * 100
+	return comparison, nil
+}
+
+// coinMarket is a coin's last recorded price and market cap at some time.
+type coinMarket struct {
+	Price     float64
+	MarketCap float64
+}
+
+// periodReturn is the benchmark's return between two points. Coins are only
+// counted when priced at both, with the remaining weights scaled up to make
+// up for missing ones. ok is false when no coin was priced at both.
+func (index *benchmarkIndex) periodReturn(from, to map[uint]coinMarket) (float64, bool) {
+	var weighted, total float64
+	for _, coinID := range index.CoinIDs {
+		start, ok := from[coinID]
+		end, ok2 := to[coinID]
+		if !ok || !ok2 || start.Price <= 0 {
+			continue
+		}
+
+		weight := 1.0
+		switch {
+		case index.Weights != nil:
+			weight = index.Weights[coinID]
+		case index.Type == models.BenchmarkMarketCap:
+			weight = start.MarketCap
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		weighted += weight * (end.Price/start.Price - 1)
+		total += weight
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return weighted / total, true
+}
+
+// marketsAt looks up each coin's last recorded price and market cap at or
+// before each of the times, returning one map per time.
+func marketsAt(coinIDs []uint, times []time.Time) ([]map[uint]coinMarket, error) {
+	markets := make([]map[uint]coinMarket, len(times))
+	for i := range markets {
+		markets[i] = make(map[uint]coinMarket)
+	}
+	if len(coinIDs) == 0 || len(times) == 0 {
+		return markets, nil
+	}
+
+	// Passed as an array literal so GORM does not expand it into a list
+	literals := make([]string, len(times))
+	for i, at := range times {
+		literals[i] = `"` + at.UTC().Format(time.RFC3339Nano) + `"`
+	}
+
+	var rows []struct {
+		Idx       int
+		CoinID    uint
+		Price     float64
+		MarketCap float64
+	}
+	if err := database.DB.Raw(`
+		SELECT t.idx, c.id AS coin_id, p.price, p.market_cap
+		FROM unnest(?::timestamptz[]) WITH ORDINALITY AS t(at, idx)
+		CROSS JOIN coins c
+		CROSS JOIN LATERAL (
+			SELECT h.price, h.market_cap
+			FROM price_history h
+			WHERE h.coin_id = c.id AND h.recorded_at <= t.at
+			ORDER BY h.recorded_at DESC
+			LIMIT 1
+		) p
+		WHERE c.id IN ?`, "{"+strings.Join(literals, ",")+"}", coinIDs).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		markets[row.Idx-1][row.CoinID] = coinMarket{Price: row.Price, MarketCap: row.MarketCap}
+	}
+	return markets, nil
+}
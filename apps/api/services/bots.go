@@ -0,0 +1,458 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"crypto-app-api/strategies"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBotsPerUser caps how many bots each user can have.
+const maxBotsPerUser = 10
+
+var (
+	ErrBotNotFound      = errors.New("Bot not found")
+	ErrInvalidBotName   = errors.New("Bot name must be between 1 and 50 characters")
+	ErrInvalidBotLimits = errors.New("Budget must be positive, and max position and max daily loss cannot be negative")
+	ErrTooManyBots      = errors.New("You can have at most 10 bots")
+	ErrBotRunning       = errors.New("Stop the bot before deleting it")
+)
+
+// BotStatus is a bot with its params decoded and its book valued at the
+// coin's current price. PnL is measured against the budget and DailyPnL
+// against the equity at the start of the UTC day.
+type BotStatus struct {
+	models.Bot
+	Params        strategies.Params `json:"params"`
+	PositionValue float64           `json:"position_value"`
+	Equity        float64           `json:"equity"`
+	PnL           float64           `json:"pnl"`
+	DailyPnL      float64           `json:"daily_pnl"`
+}
+
+func botStatus(bot models.Bot) (*BotStatus, error) {
+	status := &BotStatus{Bot: bot}
+	if err := json.Unmarshal([]byte(bot.Params), &status.Params); err != nil {
+		return nil, err
+	}
+	status.PositionValue = bot.Quantity * bot.Coin.CurrentPrice
+	status.Equity = bot.Cash + status.PositionValue
+	status.PnL = status.Equity - bot.Budget
+	if bot.DayStartedAt != nil {
+		status.DailyPnL = status.Equity - bot.DayStartEquity
+	}
+	return status, nil
+}
+
+// CreateBot sets up a stopped bot trading in the portfolio.
+func CreateBot(portfolio models.Portfolio, req models.BotRequest) (*BotStatus, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 50 {
+		return nil, ErrInvalidBotName
+	}
+	_, params, err := strategies.New(req.Strategy, req.Params)
+	if err != nil {
+		return nil, err
+	}
+	if req.Interval == "" {
+		req.Interval = "1h"
+	}
+	if _, ok := CandleIntervals[req.Interval]; !ok {
+		return nil, ErrInvalidInterval
+	}
+	if req.Budget <= 0 || req.MaxPosition < 0 || req.MaxDailyLoss < 0 {
+		return nil, ErrInvalidBotLimits
+	}
+	if portfolio.IsArchived() {
+		return nil, ErrPortfolioArchived
+	}
+
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	bot := models.Bot{
+		UserID:       portfolio.UserID,
+		PortfolioID:  portfolio.ID,
+		CoinID:       coin.ID,
+		Name:         name,
+		Strategy:     req.Strategy,
+		Params:       string(encoded),
+		Interval:     req.Interval,
+		Status:       models.BotStopped,
+		Budget:       req.Budget,
+		MaxPosition:  req.MaxPosition,
+		MaxDailyLoss: req.MaxDailyLoss,
+		Cash:         req.Budget,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, portfolio.UserID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.Bot{}).Where("user_id = ?", portfolio.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxBotsPerUser {
+			return ErrTooManyBots
+		}
+		return tx.Create(&bot).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bot.Coin = coin
+	return botStatus(bot)
+}
+
+func ListBots(userID uint) ([]BotStatus, error) {
+	var bots []models.Bot
+	if err := database.DB.Preload("Coin").Where("user_id = ?", userID).Order("created_at asc").Find(&bots).Error; err != nil {
+		return nil, err
+	}
+
+	statuses := make([]BotStatus, 0, len(bots))
+	for _, bot := range bots {
+		status, err := botStatus(bot)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+// ResolveBot returns one of the user's bots.
+func ResolveBot(userID, id uint) (*models.Bot, error) {
+	var bot models.Bot
+	if err := database.DB.Preload("Coin").Where("id = ? AND user_id = ?", id, userID).First(&bot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBotNotFound
+		}
+		return nil, err
+	}
+	return &bot, nil
+}
+
+func GetBot(userID, id uint) (*BotStatus, error) {
+	bot, err := ResolveBot(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return botStatus(*bot)
+}
+
+// StartBot sets the bot running from the next closed candle. Starting a bot
+// paused by its daily loss limit clears the pause.
+func StartBot(userID, id uint) (*BotStatus, error) {
+	bot, err := ResolveBot(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	portfolio, err := ActivePortfolio(userID, bot.PortfolioID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	barClose := now.Truncate(CandleIntervals[bot.Interval])
+	if err := database.DB.Model(bot).Updates(map[string]interface{}{
+		"status":       models.BotRunning,
+		"started_at":   now,
+		"paused_until": nil,
+		"last_bar_at":  barClose,
+	}).Error; err != nil {
+		return nil, err
+	}
+	logBot(bot.ID, models.BotLogInfo, fmt.Sprintf("Started in portfolio %q", portfolio.Name), nil)
+	return GetBot(userID, id)
+}
+
+func StopBot(userID, id uint) (*BotStatus, error) {
+	bot, err := ResolveBot(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(bot).Update("status", models.BotStopped).Error; err != nil {
+		return nil, err
+	}
+	logBot(bot.ID, models.BotLogInfo, "Stopped", nil)
+	return GetBot(userID, id)
+}
+
+// DeleteBot removes a stopped bot and its logs. Its trades stay in the
+// portfolio.
+func DeleteBot(userID, id uint) error {
+	bot, err := ResolveBot(userID, id)
+	if err != nil {
+		return err
+	}
+	if bot.Status == models.BotRunning {
+		return ErrBotRunning
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bot_id = ?", bot.ID).Delete(&models.BotLog{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(bot).Error
+	})
+}
+
+func logBot(botID uint, level, message string, tradeID *uint) {
+	if err := database.DB.Create(&models.BotLog{
+		BotID:   botID,
+		Level:   level,
+		Message: message,
+		TradeID: tradeID,
+	}).Error; err != nil {
+		log.Printf("Failed to log for bot %d: %v", botID, err)
+	}
+}
+
+// SubscribeBots steps the running bots on each coin whose price was updated.
+func SubscribeBots() {
+	events.Subscribe(func(event events.Event) {
+		coins, ok := event.Data.([]models.Coin)
+		if !ok || len(coins) == 0 {
+			return
+		}
+		coinIDs := make([]uint, len(coins))
+		for i, coin := range coins {
+			coinIDs[i] = coin.ID
+		}
+		if err := stepBots(database.DB.Where("coin_id IN ?", coinIDs)); err != nil {
+			log.Printf("Failed to run bots: %v", err)
+		}
+	}, events.PricesUpdated)
+}
+
+// RunBots steps every running bot. Price updates already drive bots; this
+// job catches candles that closed without one, and picks running bots back
+// up after a restart since their state lives in the database.
+func RunBots() error {
+	return stepBots(database.DB)
+}
+
+func stepBots(scope *gorm.DB) error {
+	var botIDs []uint
+	if err := scope.Model(&models.Bot{}).Where("status = ?", models.BotRunning).Pluck("id", &botIDs).Error; err != nil {
+		return err
+	}
+	for _, botID := range botIDs {
+		if err := stepBot(botID); err != nil {
+			log.Printf("Failed to run bot %d: %v", botID, err)
+		}
+	}
+	return nil
+}
+
+// stepBot runs the bot once per closed candle. The candle is claimed under
+// a SKIP LOCKED row lock first, so a bot never acts twice on the same candle
+// however many replicas or price updates race to run it.
+func stepBot(botID uint) error {
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	var bot models.Bot
+	var claimed bool
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("Coin").
+			Where("id = ? AND status = ?", botID, models.BotRunning).
+			Find(&bot).Error; err != nil || bot.ID == 0 {
+			return err
+		}
+
+		barClose := now.Truncate(CandleIntervals[bot.Interval])
+		if bot.LastBarAt != nil && !bot.LastBarAt.Before(barClose) {
+			return nil
+		}
+		updates := map[string]interface{}{"last_bar_at": barClose}
+		if bot.DayStartedAt == nil || bot.DayStartedAt.Before(today) {
+			bot.DayStartEquity = bot.Cash + bot.Quantity*bot.Coin.CurrentPrice
+			bot.DayStartedAt = &today
+			updates["day_start_equity"] = bot.DayStartEquity
+			updates["day_started_at"] = today
+		}
+		claimed = true
+		return tx.Model(&bot).Updates(updates).Error
+	})
+	if err != nil || !claimed {
+		return err
+	}
+
+	if bot.PausedUntil != nil && now.Before(*bot.PausedUntil) {
+		return nil
+	}
+
+	equity := bot.Cash + bot.Quantity*bot.Coin.CurrentPrice
+	if bot.MaxDailyLoss > 0 && bot.DayStartEquity-equity >= bot.MaxDailyLoss {
+		tomorrow := today.AddDate(0, 0, 1)
+		logBot(bot.ID, models.BotLogWarning, fmt.Sprintf("Daily loss of %.2f reached the %.2f limit; paused until %s",
+			bot.DayStartEquity-equity, bot.MaxDailyLoss, tomorrow.Format(time.RFC3339)), nil)
+		return database.DB.Model(&bot).Update("paused_until", tomorrow).Error
+	}
+
+	var params strategies.Params
+	if err := json.Unmarshal([]byte(bot.Params), &params); err != nil {
+		return err
+	}
+	strategy, _, err := strategies.New(bot.Strategy, params)
+	if err != nil {
+		return err
+	}
+
+	bars, err := closedBars(bot, strategy.Warmup(), now)
+	if err != nil || len(bars) < strategy.Warmup() {
+		return err
+	}
+
+	var portfolio models.Portfolio
+	if err := database.DB.First(&portfolio, bot.PortfolioID).Error; err != nil {
+		return err
+	}
+	position, err := botPosition(bot, portfolio)
+	if err != nil {
+		return err
+	}
+
+	order := strategy.Next(bars, position)
+	if order == nil {
+		return nil
+	}
+	return executeBotOrder(bot, portfolio, position, *order)
+}
+
+// closedBars returns the bot's candles that have closed, with enough
+// history for the strategy's warmup. Bars are indexed from the one the bot
+// was started in.
+func closedBars(bot models.Bot, warmup int, now time.Time) ([]strategies.Bar, error) {
+	interval := CandleIntervals[bot.Interval]
+	barClose := now.Truncate(interval)
+	candles, err := CandleRange(bot.CoinID, interval, barClose.Add(-time.Duration(warmup+1)*interval), barClose)
+	if err != nil {
+		return nil, err
+	}
+
+	var startBar time.Time
+	if bot.StartedAt != nil {
+		startBar = bot.StartedAt.Truncate(interval)
+	}
+	bars := make([]strategies.Bar, len(candles))
+	for i, candle := range candles {
+		bars[i] = strategies.Bar{
+			Index:  int(candle.Time.Sub(startBar) / interval),
+			Time:   candle.Time,
+			Open:   candle.Open,
+			High:   candle.High,
+			Low:    candle.Low,
+			Close:  candle.Close,
+			Volume: candle.Volume,
+		}
+	}
+	return bars, nil
+}
+
+// botPosition is the bot's book capped by what the portfolio actually
+// holds, since the user may have spent the cash or sold the coins.
+func botPosition(bot models.Bot, portfolio models.Portfolio) (strategies.Position, error) {
+	var holding models.UserCoin
+	if err := database.DB.Where("portfolio_id = ? AND coin_id = ?", portfolio.ID, bot.CoinID).
+		Limit(1).
+		Find(&holding).Error; err != nil {
+		return strategies.Position{}, err
+	}
+	return strategies.Position{
+		Cash:         math.Max(0, math.Min(bot.Cash, portfolio.Balance)),
+		Quantity:     math.Max(0, math.Min(bot.Quantity, holding.Quantity)),
+		AveragePrice: bot.AveragePrice,
+	}, nil
+}
+
+// executeBotOrder places the order through ExecuteTrade at the current
+// price, within the bot's limits, and updates its book.
+func executeBotOrder(bot models.Bot, portfolio models.Portfolio, position strategies.Position, order strategies.Order) error {
+	price := bot.Coin.CurrentPrice
+	if price <= 0 {
+		return nil
+	}
+
+	req := models.TradeRequest{PortfolioID: portfolio.ID, CoinID: bot.CoinID, Type: order.Side, Price: price}
+	switch order.Side {
+	case strategies.Buy:
+		amount := position.Cash
+		if order.Amount > 0 {
+			amount = math.Min(order.Amount, position.Cash)
+		}
+		if bot.MaxPosition > 0 {
+			amount = math.Min(amount, bot.MaxPosition-position.Quantity*price)
+		}
+		if amount < 0.01 {
+			logBot(bot.ID, models.BotLogWarning, "Buy signal skipped: no budget left within the max position", nil)
+			return nil
+		}
+		req.Quantity = amount / price
+	case strategies.Sell:
+		req.Quantity = position.Quantity
+		if order.Quantity > 0 {
+			req.Quantity = math.Min(order.Quantity, position.Quantity)
+		}
+		if req.Quantity <= 0 {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	trade, err := ExecuteTrade(portfolio, req)
+	if err != nil {
+		logBot(bot.ID, models.BotLogError, fmt.Sprintf("%s signal failed: %v", order.Side, err), nil)
+		// Nothing more can be traded in an archived portfolio
+		if errors.Is(err, ErrPortfolioArchived) {
+			return database.DB.Model(&bot).Update("status", models.BotStopped).Error
+		}
+		return nil
+	}
+
+	updates := map[string]interface{}{}
+	verb := "Bought"
+	if trade.Type == strategies.Buy {
+		updates["cash"] = bot.Cash - trade.TotalAmount
+		updates["average_price"] = blendAveragePrice(position.Quantity, bot.AveragePrice, trade.Quantity, trade.Price)
+		updates["quantity"] = position.Quantity + trade.Quantity
+	} else {
+		verb = "Sold"
+		updates["cash"] = bot.Cash + trade.TotalAmount
+		remaining := position.Quantity - trade.Quantity
+		if remaining <= lotEpsilon {
+			remaining = 0
+			updates["average_price"] = 0
+		}
+		updates["quantity"] = remaining
+	}
+	if err := database.DB.Model(&bot).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	logBot(bot.ID, models.BotLogTrade, fmt.Sprintf("%s %g %s at %.2f (total %.2f)",
+		verb, trade.Quantity, bot.Coin.Symbol, trade.Price, trade.TotalAmount), &trade.ID)
+	return nil
+}
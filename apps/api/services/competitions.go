@@ -0,0 +1,611 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// competitionSnapshotInterval is how often entry values are recorded
+	// for the Sharpe ratio. Contests are short, so it is finer than
+	// SnapshotInterval.
+	competitionSnapshotInterval = 15 * time.Minute
+
+	// leaderboardTTL bounds how stale a cached leaderboard can get when
+	// prices are updated through another replica.
+	leaderboardTTL = time.Minute
+)
+
+var (
+	ErrCompetitionNotFound        = errors.New("Competition not found")
+	ErrInvalidCompetitionName     = errors.New("Competition name must be between 1 and 100 characters")
+	ErrInvalidCompetitionSchedule = errors.New("Competition must end in the future and after it starts")
+	ErrInvalidCompetitionBalance  = errors.New("Starting balance must be positive")
+	ErrInvalidCompetitionMetric   = errors.New("Metric must be return or sharpe")
+	ErrInvalidCompetitionStatus   = errors.New("Status must be one of upcoming, active, closing or finished")
+	ErrCompetitionEnded           = errors.New("Competition has ended")
+	ErrAlreadyEntered             = errors.New("You have already entered this competition")
+	ErrCompetitionNotRunning      = errors.New("Contest portfolios can only trade while the competition is running")
+	ErrCoinNotAllowed             = errors.New("This coin cannot be traded in the competition")
+	ErrContestPortfolio           = errors.New("Contest portfolios cannot move money in or out, convert currency, reset or import trades")
+)
+
+// CompetitionReport is a competition with its allowed coins decoded, its
+// status, how many users entered and the requesting user's entry, if any.
+type CompetitionReport struct {
+	models.Competition
+	Status       string                   `json:"status"`
+	AllowedCoins []uint                   `json:"allowed_coins"`
+	Entrants     int64                    `json:"entrants"`
+	Entry        *models.CompetitionEntry `json:"entry,omitempty"`
+}
+
+// LeaderboardEntry is an entrant's standing. Return and SharpeRatio are
+// measured from the starting balance; Return is in percent.
+type LeaderboardEntry struct {
+	Rank        int     `json:"rank"`
+	UserID      uint    `json:"user_id"`
+	Username    string  `json:"username"`
+	PortfolioID uint    `json:"portfolio_id"`
+	Value       float64 `json:"value"`
+	Return      float64 `json:"return"`
+	SharpeRatio float64 `json:"sharpe_ratio"`
+}
+
+// Leaderboard ranks a competition's entrants by its metric. Final
+// leaderboards are the standings frozen when the competition closed.
+type Leaderboard struct {
+	CompetitionID uint               `json:"competition_id"`
+	Metric        string             `json:"metric"`
+	Status        string             `json:"status"`
+	Final         bool               `json:"final"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+	Entries       []LeaderboardEntry `json:"entries"`
+}
+
+// leaderboardCache holds the live leaderboard of each running competition,
+// refreshed on every price update.
+var leaderboardCache = struct {
+	sync.Mutex
+	byCompetition map[uint]*Leaderboard
+}{byCompetition: make(map[uint]*Leaderboard)}
+
+func CreateCompetition(userID uint, req models.CompetitionRequest) (*CompetitionReport, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidCompetitionName
+	}
+	if !req.EndAt.After(req.StartAt) || !req.EndAt.After(time.Now()) {
+		return nil, ErrInvalidCompetitionSchedule
+	}
+	if req.StartingBalance == 0 {
+		req.StartingBalance = models.DefaultStartingBalance
+	}
+	if req.StartingBalance < 0 {
+		return nil, ErrInvalidCompetitionBalance
+	}
+	if req.Metric == "" {
+		req.Metric = models.CompetitionMetricReturn
+	}
+	if req.Metric != models.CompetitionMetricReturn && req.Metric != models.CompetitionMetricSharpe {
+		return nil, ErrInvalidCompetitionMetric
+	}
+
+	allowed := uniqueIDs(req.AllowedCoins)
+	if len(allowed) > 0 {
+		var count int64
+		if err := database.DB.Model(&models.Coin{}).Where("id IN ?", allowed).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count != int64(len(allowed)) {
+			return nil, ErrCoinNotFound
+		}
+	}
+	encoded, err := json.Marshal(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	competition := models.Competition{
+		CreatedBy:       userID,
+		Name:            name,
+		Description:     strings.TrimSpace(req.Description),
+		StartAt:         req.StartAt,
+		EndAt:           req.EndAt,
+		StartingBalance: req.StartingBalance,
+		AllowedCoins:    string(encoded),
+		Metric:          req.Metric,
+	}
+	if err := database.DB.Create(&competition).Error; err != nil {
+		return nil, err
+	}
+	return competitionReport(competition, userID)
+}
+
+// ListCompetitions lists competitions, soonest ending first, optionally only
+// those with the given status.
+func ListCompetitions(userID uint, status string) ([]CompetitionReport, error) {
+	now := time.Now()
+	query := database.DB.Model(&models.Competition{})
+	switch status {
+	case "":
+	case models.CompetitionUpcoming:
+		query = query.Where("start_at > ?", now)
+	case models.CompetitionActive:
+		query = query.Where("start_at <= ? AND end_at > ?", now, now)
+	case models.CompetitionClosing:
+		query = query.Where("end_at <= ? AND finalized_at IS NULL", now)
+	case models.CompetitionFinished:
+		query = query.Where("finalized_at IS NOT NULL")
+	default:
+		return nil, ErrInvalidCompetitionStatus
+	}
+
+	var competitions []models.Competition
+	if err := query.Order("end_at asc").Limit(100).Find(&competitions).Error; err != nil {
+		return nil, err
+	}
+
+	reports := make([]CompetitionReport, 0, len(competitions))
+	for _, competition := range competitions {
+		report, err := competitionReport(competition, userID)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+func GetCompetition(userID, id uint) (*CompetitionReport, error) {
+	var competition models.Competition
+	if err := database.DB.First(&competition, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCompetitionNotFound
+		}
+		return nil, err
+	}
+	return competitionReport(competition, userID)
+}
+
+func competitionReport(competition models.Competition, userID uint) (*CompetitionReport, error) {
+	report := &CompetitionReport{
+		Competition: competition,
+		Status:      competition.Status(time.Now()),
+	}
+	if err := json.Unmarshal([]byte(competition.AllowedCoins), &report.AllowedCoins); err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(&models.CompetitionEntry{}).
+		Where("competition_id = ?", competition.ID).
+		Count(&report.Entrants).Error; err != nil {
+		return nil, err
+	}
+
+	var entry models.CompetitionEntry
+	if err := database.DB.Where("competition_id = ? AND user_id = ?", competition.ID, userID).
+		Limit(1).
+		Find(&entry).Error; err != nil {
+		return nil, err
+	}
+	if entry.ID != 0 {
+		report.Entry = &entry
+	}
+	return report, nil
+}
+
+// JoinCompetition enrolls the user, creating their contest portfolio funded
+// with the starting balance. Users can join until the competition ends.
+func JoinCompetition(userID, id uint) (*CompetitionReport, error) {
+	var competition models.Competition
+	if err := database.DB.First(&competition, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCompetitionNotFound
+		}
+		return nil, err
+	}
+	if !time.Now().Before(competition.EndAt) {
+		return nil, ErrCompetitionEnded
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.CompetitionEntry{}).
+			Where("competition_id = ? AND user_id = ?", competition.ID, userID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyEntered
+		}
+
+		portfolio := models.Portfolio{
+			UserID:        userID,
+			Name:          "Contest: " + competition.Name,
+			Balance:       competition.StartingBalance,
+			CompetitionID: &competition.ID,
+		}
+		if err := tx.Create(&portfolio).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.CompetitionEntry{
+			CompetitionID: competition.ID,
+			UserID:        userID,
+			PortfolioID:   portfolio.ID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return competitionReport(competition, userID)
+}
+
+// checkContestTrade rejects trades in a contest portfolio outside its
+// competition or in a coin the competition does not allow.
+func checkContestTrade(portfolio models.Portfolio, coinID uint) error {
+	if !portfolio.IsContest() {
+		return nil
+	}
+
+	var competition models.Competition
+	if err := database.DB.First(&competition, *portfolio.CompetitionID).Error; err != nil {
+		return err
+	}
+	if competition.Status(time.Now()) != models.CompetitionActive {
+		return ErrCompetitionNotRunning
+	}
+
+	var allowed []uint
+	if err := json.Unmarshal([]byte(competition.AllowedCoins), &allowed); err != nil {
+		return err
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, id := range allowed {
+		if id == coinID {
+			return nil
+		}
+	}
+	return ErrCoinNotAllowed
+}
+
+// GetLeaderboard returns the competition's frozen standings once it is
+// finalized, and otherwise its live leaderboard at current prices.
+func GetLeaderboard(id uint) (*Leaderboard, error) {
+	var competition models.Competition
+	if err := database.DB.First(&competition, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCompetitionNotFound
+		}
+		return nil, err
+	}
+	if competition.FinalizedAt != nil {
+		return finalLeaderboard(competition)
+	}
+
+	leaderboardCache.Lock()
+	cached := leaderboardCache.byCompetition[id]
+	leaderboardCache.Unlock()
+	if cached != nil && time.Since(cached.UpdatedAt) < leaderboardTTL {
+		return cached, nil
+	}
+	return refreshLeaderboard(competition)
+}
+
+func refreshLeaderboard(competition models.Competition) (*Leaderboard, error) {
+	leaderboard, err := computeLeaderboard(database.DB, competition, false)
+	if err != nil {
+		return nil, err
+	}
+	leaderboardCache.Lock()
+	leaderboardCache.byCompetition[competition.ID] = leaderboard
+	leaderboardCache.Unlock()
+	return leaderboard, nil
+}
+
+// computeLeaderboard values every entry and ranks them by the
+// competition's metric, breaking ties by return and then by who entered
+// first. Live leaderboards use current prices; final ones are measured at
+// EndAt. Contest portfolios only hold BaseCurrency cash and coins.
+func computeLeaderboard(tx *gorm.DB, competition models.Competition, final bool) (*Leaderboard, error) {
+	now := time.Now()
+	var at *time.Time
+	if final {
+		now, at = competition.EndAt, &competition.EndAt
+	}
+
+	var entries []models.CompetitionEntry
+	if err := tx.Preload("User").
+		Where("competition_id = ?", competition.ID).
+		Order("id asc").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	values, err := contestValues(tx, competition.ID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []models.CompetitionSnapshot
+	if err := tx.Where("entry_id IN (?)", tx.Model(&models.CompetitionEntry{}).
+		Select("id").
+		Where("competition_id = ?", competition.ID)).
+		Where("recorded_at <= ?", now).
+		Order("recorded_at asc").
+		Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+	byEntry := make(map[uint][]models.CompetitionSnapshot)
+	for _, snapshot := range snapshots {
+		byEntry[snapshot.EntryID] = append(byEntry[snapshot.EntryID], snapshot)
+	}
+
+	leaderboard := &Leaderboard{
+		CompetitionID: competition.ID,
+		Metric:        competition.Metric,
+		Status:        competition.Status(now),
+		UpdatedAt:     now,
+		Entries:       make([]LeaderboardEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		value := values[entry.PortfolioID]
+		leaderboard.Entries = append(leaderboard.Entries, LeaderboardEntry{
+			UserID:      entry.UserID,
+			Username:    entry.User.Username,
+			PortfolioID: entry.PortfolioID,
+			Value:       value,
+			Return:      (value/competition.StartingBalance - 1) * 100,
+			SharpeRatio: entrySharpe(competition, entry, byEntry[entry.ID], value, now),
+		})
+	}
+
+	sort.SliceStable(leaderboard.Entries, func(i, j int) bool {
+		a, b := leaderboard.Entries[i], leaderboard.Entries[j]
+		if competition.Metric == models.CompetitionMetricSharpe && a.SharpeRatio != b.SharpeRatio {
+			return a.SharpeRatio > b.SharpeRatio
+		}
+		return a.Return > b.Return
+	})
+	for i := range leaderboard.Entries {
+		leaderboard.Entries[i].Rank = i + 1
+	}
+	return leaderboard, nil
+}
+
+// contestValues returns the value of each of the competition's contest
+// portfolios by portfolio ID, at current prices or, when at is set, at each
+// coin's last recorded price at or before it. Coins with no history by then
+// fall back to their current price.
+func contestValues(tx *gorm.DB, competitionID uint, at *time.Time) (map[uint]float64, error) {
+	price, args := "c.current_price", []interface{}{}
+	if at != nil {
+		price = `COALESCE((
+			SELECT h.price FROM price_history h
+			WHERE h.coin_id = c.id AND h.recorded_at <= ?
+			ORDER BY h.recorded_at DESC
+			LIMIT 1
+		), c.current_price)`
+		args = append(args, *at)
+	}
+	args = append(args, competitionID)
+
+	var rows []struct {
+		ID    uint
+		Value float64
+	}
+	if err := tx.Raw(`
+		SELECT p.id, p.balance + COALESCE(SUM(uc.quantity * `+price+`), 0) AS value
+		FROM portfolios p
+		LEFT JOIN user_coins uc ON uc.portfolio_id = p.id AND uc.quantity > 0
+		LEFT JOIN coins c ON c.id = uc.coin_id
+		WHERE p.competition_id = ?
+		GROUP BY p.id`, args...).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	values := make(map[uint]float64, len(rows))
+	for _, row := range rows {
+		values[row.ID] = row.Value
+	}
+	return values, nil
+}
+
+// entrySharpe measures the entry's Sharpe ratio from the starting balance
+// at the time it started competing, through its snapshots, to its current
+// value.
+func entrySharpe(competition models.Competition, entry models.CompetitionEntry, snapshots []models.CompetitionSnapshot, value float64, now time.Time) float64 {
+	start := competition.StartAt
+	if entry.CreatedAt.After(start) {
+		start = entry.CreatedAt
+	}
+
+	series := make([]models.PortfolioSnapshot, 0, len(snapshots)+2)
+	series = append(series, models.PortfolioSnapshot{TotalValue: competition.StartingBalance, RecordedAt: start})
+	for _, snapshot := range snapshots {
+		series = append(series, models.PortfolioSnapshot{TotalValue: snapshot.Value, RecordedAt: snapshot.RecordedAt})
+	}
+	if now.After(series[len(series)-1].RecordedAt) {
+		series = append(series, models.PortfolioSnapshot{TotalValue: value, RecordedAt: now})
+	}
+	return measurePerformance("competition", series, 0).SharpeRatio
+}
+
+func finalLeaderboard(competition models.Competition) (*Leaderboard, error) {
+	var entries []models.CompetitionEntry
+	if err := database.DB.Preload("User").
+		Where("competition_id = ?", competition.ID).
+		Order("final_rank asc, id asc").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	leaderboard := &Leaderboard{
+		CompetitionID: competition.ID,
+		Metric:        competition.Metric,
+		Status:        models.CompetitionFinished,
+		Final:         true,
+		UpdatedAt:     *competition.FinalizedAt,
+		Entries:       make([]LeaderboardEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		var rank int
+		if entry.FinalRank != nil {
+			rank = *entry.FinalRank
+		}
+		leaderboard.Entries = append(leaderboard.Entries, LeaderboardEntry{
+			Rank:        rank,
+			UserID:      entry.UserID,
+			Username:    entry.User.Username,
+			PortfolioID: entry.PortfolioID,
+			Value:       entry.FinalValue,
+			Return:      entry.FinalReturn,
+			SharpeRatio: entry.FinalSharpe,
+		})
+	}
+	return leaderboard, nil
+}
+
+// SubscribeCompetitions refreshes the leaderboards of running competitions
+// on every price update, recording entry snapshots when they are due.
+func SubscribeCompetitions() {
+	events.Subscribe(func(events.Event) {
+		now := time.Now()
+		var competitions []models.Competition
+		if err := database.DB.Where("start_at <= ? AND end_at > ?", now, now).Find(&competitions).Error; err != nil {
+			log.Printf("Failed to load running competitions: %v", err)
+			return
+		}
+		for _, competition := range competitions {
+			if err := recordCompetitionSnapshots(competition.ID, now); err != nil {
+				log.Printf("Failed to snapshot competition %d: %v", competition.ID, err)
+			}
+			if _, err := refreshLeaderboard(competition); err != nil {
+				log.Printf("Failed to refresh leaderboard of competition %d: %v", competition.ID, err)
+			}
+		}
+	}, events.PricesUpdated)
+}
+
+// recordCompetitionSnapshots records every entry's value once per
+// competitionSnapshotInterval. The competition row is claimed with SKIP
+// LOCKED so concurrent price updates record each period once.
+func recordCompetitionSnapshots(competitionID uint, now time.Time) error {
+	period := now.Truncate(competitionSnapshotInterval)
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var competition models.Competition
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ?", competitionID).
+			Find(&competition).Error; err != nil || competition.ID == 0 {
+			return err
+		}
+		if competition.SnapshotAt != nil && !competition.SnapshotAt.Before(period) {
+			return nil
+		}
+
+		values, err := contestValues(tx, competition.ID, nil)
+		if err != nil {
+			return err
+		}
+		var entries []models.CompetitionEntry
+		if err := tx.Where("competition_id = ?", competition.ID).Find(&entries).Error; err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			snapshots := make([]models.CompetitionSnapshot, len(entries))
+			for i, entry := range entries {
+				snapshots[i] = models.CompetitionSnapshot{
+					EntryID:    entry.ID,
+					Value:      values[entry.PortfolioID],
+					RecordedAt: now,
+				}
+			}
+			if err := tx.Create(&snapshots).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&competition).Update("snapshot_at", period).Error
+	})
+}
+
+// FinalizeCompetitions freezes the standings of competitions that have
+// ended. Trading stops at EndAt, so the standings are the entries' holdings
+// valued at the prices recorded by EndAt, however late the job runs; their
+// contest portfolios are archived.
+func FinalizeCompetitions() error {
+	var ids []uint
+	if err := database.DB.Model(&models.Competition{}).
+		Where("end_at <= ? AND finalized_at IS NULL", time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := finalizeCompetition(id); err != nil {
+			log.Printf("Failed to finalize competition %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func finalizeCompetition(id uint) error {
+	var competition models.Competition
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND finalized_at IS NULL", id).
+			Find(&competition).Error; err != nil || competition.ID == 0 {
+			return err
+		}
+
+		leaderboard, err := computeLeaderboard(tx, competition, true)
+		if err != nil {
+			return err
+		}
+		for _, standing := range leaderboard.Entries {
+			if err := tx.Model(&models.CompetitionEntry{}).
+				Where("competition_id = ? AND user_id = ?", competition.ID, standing.UserID).
+				Updates(map[string]interface{}{
+					"final_rank":   standing.Rank,
+					"final_value":  standing.Value,
+					"final_return": standing.Return,
+					"final_sharpe": standing.SharpeRatio,
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Portfolio{}).
+			Where("competition_id = ? AND archived_at IS NULL", competition.ID).
+			Update("archived_at", now).Error; err != nil {
+			return err
+		}
+		competition.FinalizedAt = &now
+		return tx.Model(&competition).Update("finalized_at", now).Error
+	})
+	if err != nil || competition.ID == 0 {
+		return err
+	}
+
+	leaderboardCache.Lock()
+	delete(leaderboardCache.byCompetition, competition.ID)
+	leaderboardCache.Unlock()
+	return nil
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// fundingInterval is how often perpetuals pay funding, aligned to
+	// 00:00, 08:00 and 16:00 UTC.
+	fundingInterval = 8 * time.Hour
+	// fundingBaseRate is the funding rate per interval when long and short
+	// open interest are balanced.
+	fundingBaseRate = 0.0001
+	// fundingImbalanceRate is added to the base rate in proportion to the
+	// share of open interest by which longs outweigh shorts, or subtracted
+	// when shorts outweigh longs.
+	fundingImbalanceRate = 0.005
+	// maxFundingRate caps the funding rate per interval either way.
+	maxFundingRate = 0.0075
+)
+
+var (
+	ErrFuturesPositionNotFound = errors.New("Futures position not found")
+	ErrFuturesPositionClosed   = errors.New("Futures position is already closed")
+	ErrInvalidMarginMode       = errors.New("Margin mode must be isolated or cross")
+)
+
+// FuturesPositionStatus is a futures position marked to the coin's current
+// price. Equity is its margin plus unrealized P&L. LiquidationPrice is the
+// mark price at which an isolated position is liquidated; cross positions
+// depend on the whole account, so it is left zero for them.
+type FuturesPositionStatus struct {
+	models.FuturesPosition
+	MarkPrice         float64 `json:"mark_price"`
+	Notional          float64 `json:"notional"`
+	UnrealizedPnL     float64 `json:"unrealized_pnl"`
+	Equity            float64 `json:"equity"`
+	InitialMargin     float64 `json:"initial_margin"`
+	MaintenanceMargin float64 `json:"maintenance_margin"`
+	LiquidationPrice  float64 `json:"liquidation_price,omitempty"`
+}
+
+// measureFutures marks a position, loaded with its coin, to market.
+func measureFutures(position models.FuturesPosition) FuturesPositionStatus {
+	status := FuturesPositionStatus{FuturesPosition: position, MarkPrice: position.Coin.CurrentPrice}
+	status.Notional = math.Abs(position.Quantity) * status.MarkPrice
+	status.UnrealizedPnL = position.Quantity * (status.MarkPrice - position.EntryPrice)
+	status.Equity = position.Margin + status.UnrealizedPnL
+	status.InitialMargin = status.Notional / position.Leverage
+	status.MaintenanceMargin = status.InitialMargin * maintenanceRatio
+
+	// Solves Margin + Quantity*(p - EntryPrice) = |Quantity|*p*maintenanceRatio/Leverage
+	if position.MarginMode == models.FuturesIsolated && position.Quantity != 0 {
+		divisor := position.Quantity - math.Abs(position.Quantity)*maintenanceRatio/position.Leverage
+		status.LiquidationPrice = math.Max(0, (position.Quantity*position.EntryPrice-position.Margin)/divisor)
+	}
+	return status
+}
+
+func openFuturesPositions(tx *gorm.DB, accountID uint) ([]models.FuturesPosition, error) {
+	var positions []models.FuturesPosition
+	err := tx.Preload("Coin").
+		Where("account_id = ? AND status = ?", accountID, models.MarginPositionOpen).
+		Order("created_at asc").
+		Find(&positions).Error
+	return positions, err
+}
+
+// OpenFuturesPosition opens a perpetual position worth amount at the coin's
+// mark price, posting amount/leverage of the margin account's cash as
+// margin. Leverage defaults to the account's leverage for the coin and the
+// margin mode to cross.
+func OpenFuturesPosition(portfolio models.Portfolio, req models.FuturesPositionRequest) (*FuturesPositionStatus, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidMarginAmount
+	}
+	if req.Side == "" {
+		req.Side = models.MarginLong
+	}
+	if req.Side != models.MarginLong && req.Side != models.MarginShort {
+		return nil, ErrInvalidMarginSide
+	}
+	if req.MarginMode == "" {
+		req.MarginMode = models.FuturesCross
+	}
+	if req.MarginMode != models.FuturesIsolated && req.MarginMode != models.FuturesCross {
+		return nil, ErrInvalidMarginMode
+	}
+	if req.Leverage != 0 && (req.Leverage < 1 || req.Leverage > MaxLeverage) {
+		return nil, ErrInvalidLeverage
+	}
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+	if coin.CurrentPrice <= 0 {
+		return nil, ErrInvalidTradeAmount
+	}
+
+	var position models.FuturesPosition
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		leverage := req.Leverage
+		if leverage == 0 {
+			var err error
+			if leverage, err = marginLeverage(tx, book.Account.ID, coin.ID); err != nil {
+				return err
+			}
+		}
+		margin := req.Amount / leverage
+		report := measureMargin(*book)
+		if margin > book.Account.Cash || margin > report.FreeMargin {
+			return ErrInsufficientMargin
+		}
+
+		position = models.FuturesPosition{
+			AccountID:  book.Account.ID,
+			UserID:     book.Account.UserID,
+			CoinID:     coin.ID,
+			Side:       req.Side,
+			MarginMode: req.MarginMode,
+			Quantity:   req.Amount / coin.CurrentPrice,
+			EntryPrice: coin.CurrentPrice,
+			Leverage:   leverage,
+			Margin:     margin,
+			Status:     models.MarginPositionOpen,
+		}
+		if req.Side == models.MarginShort {
+			position.Quantity = -position.Quantity
+		}
+		if err := tx.Create(&position).Error; err != nil {
+			return err
+		}
+		return tx.Model(book.Account).Update("cash", book.Account.Cash-margin).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	position.Coin = coin
+	status := measureFutures(position)
+	return &status, nil
+}
+
+// GetFuturesPosition returns one of the portfolio's futures positions,
+// marked to market while it is open.
+func GetFuturesPosition(portfolio models.Portfolio, positionID uint) (*FuturesPositionStatus, error) {
+	scope, err := FuturesPositionsScope(portfolio)
+	if err != nil {
+		return nil, err
+	}
+	var position models.FuturesPosition
+	if err := scope.Preload("Coin").Where("id = ?", positionID).First(&position).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFuturesPositionNotFound
+		}
+		return nil, err
+	}
+	if position.Status != models.MarginPositionOpen {
+		return &FuturesPositionStatus{FuturesPosition: position}, nil
+	}
+	status := measureFutures(position)
+	return &status, nil
+}
+
+// CloseFuturesPosition closes quantity of the position, or all of it when
+// zero, at the coin's mark price.
+func CloseFuturesPosition(portfolio models.Portfolio, positionID uint, quantity float64) (*models.FuturesPosition, error) {
+	if quantity < 0 {
+		return nil, ErrInvalidTradeAmount
+	}
+
+	var closed models.FuturesPosition
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		var position *models.FuturesPosition
+		for i := range book.Futures {
+			if book.Futures[i].ID == positionID {
+				position = &book.Futures[i]
+			}
+		}
+		if position == nil {
+			var count int64
+			if err := tx.Model(&models.FuturesPosition{}).
+				Where("id = ? AND account_id = ?", positionID, book.Account.ID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrFuturesPositionClosed
+			}
+			return ErrFuturesPositionNotFound
+		}
+		open := math.Abs(position.Quantity)
+		if quantity > open+lotEpsilon {
+			return ErrInsufficientQuantity
+		}
+		if quantity == 0 || quantity > open-lotEpsilon {
+			quantity = open
+		}
+
+		if err := closeFuturesPosition(tx, book.Account, position, quantity, models.MarginPositionClosed); err != nil {
+			return err
+		}
+		closed = *position
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &closed, nil
+}
+
+// closeFuturesPosition closes quantity of the position at its coin's mark
+// price, releasing the closed share of its margin plus the realized P&L to
+// the account's cash. An isolated position never releases less than
+// nothing; a cross position's loss beyond its margin comes out of the
+// account's cash, and a shortfall beyond that is written off. Closing the
+// whole position gives it the status.
+func closeFuturesPosition(tx *gorm.DB, account *models.MarginAccount, position *models.FuturesPosition, quantity float64, status string) error {
+	price := position.Coin.CurrentPrice
+	share := quantity / math.Abs(position.Quantity)
+	closed := position.Quantity * share
+	margin := position.Margin * share
+	pnl := closed * (price - position.EntryPrice)
+	released := margin + pnl
+	if position.MarginMode == models.FuturesIsolated {
+		released = math.Max(0, released)
+	}
+
+	account.Cash = math.Max(0, account.Cash+released)
+	position.RealizedPnL += pnl
+	position.Quantity -= closed
+	position.Margin -= margin
+	position.ClosePrice = price
+	if math.Abs(position.Quantity) <= lotEpsilon {
+		now := time.Now()
+		position.Quantity = 0
+		position.Margin = 0
+		position.Status = status
+		position.ClosedAt = &now
+	}
+
+	if err := tx.Save(position).Error; err != nil {
+		return err
+	}
+	return tx.Model(account).Update("cash", account.Cash).Error
+}
+
+// FuturesPositionsScope returns a query over the portfolio's futures
+// positions, for handlers to filter and page.
+func FuturesPositionsScope(portfolio models.Portfolio) (*gorm.DB, error) {
+	accountID, err := marginAccountID(portfolio)
+	if err != nil {
+		return nil, err
+	}
+	return database.DB.Model(&models.FuturesPosition{}).Where("account_id = ?", accountID), nil
+}
+
+// FundingPaymentsScope returns a query over the funding payments of the
+// portfolio's futures positions.
+func FundingPaymentsScope(portfolio models.Portfolio) (*gorm.DB, error) {
+	accountID, err := marginAccountID(portfolio)
+	if err != nil {
+		return nil, err
+	}
+	return database.DB.Model(&models.FundingPayment{}).
+		Where("position_id IN (?)", database.DB.Model(&models.FuturesPosition{}).Select("id").Where("account_id = ?", accountID)), nil
+}
+
+// RunFunding settles the funding interval that started most recently for
+// every coin with open positions from before it. Each coin is settled
+// once: its FundingRate row for the interval claims it.
+func RunFunding() error {
+	fundedAt := time.Now().Truncate(fundingInterval)
+
+	var coinIDs []uint
+	if err := database.DB.Model(&models.FuturesPosition{}).
+		Where("status = ? AND created_at < ?", models.MarginPositionOpen, fundedAt).
+		Distinct().
+		Pluck("coin_id", &coinIDs).Error; err != nil {
+		return err
+	}
+	for _, coinID := range coinIDs {
+		if err := fundCoin(coinID, fundedAt); err != nil {
+			log.Printf("Failed to settle funding for coin %d: %v", coinID, err)
+		}
+	}
+	return nil
+}
+
+// fundCoin sets the coin's funding rate for the interval starting at
+// fundedAt and charges it to every position opened before then: each pays
+// its quantity times the mark price times the rate from its margin, so
+// longs pay and shorts receive when the rate is positive.
+func fundCoin(coinID uint, fundedAt time.Time) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var coin models.Coin
+		if err := tx.First(&coin, coinID).Error; err != nil {
+			return err
+		}
+
+		var accountIDs []uint
+		if err := tx.Model(&models.FuturesPosition{}).
+			Where("coin_id = ? AND status = ? AND created_at < ?", coinID, models.MarginPositionOpen, fundedAt).
+			Distinct().
+			Order("account_id").
+			Pluck("account_id", &accountIDs).Error; err != nil {
+			return err
+		}
+		// Lock accounts in ID order so concurrent funding of two coins
+		// cannot deadlock
+		var accounts []models.MarginAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", accountIDs).
+			Order("id").
+			Find(&accounts).Error; err != nil {
+			return err
+		}
+
+		var positions []models.FuturesPosition
+		if err := tx.Where("coin_id = ? AND status = ? AND created_at < ?", coinID, models.MarginPositionOpen, fundedAt).
+			Find(&positions).Error; err != nil {
+			return err
+		}
+
+		rate := models.FundingRate{CoinID: coinID, MarkPrice: coin.CurrentPrice, FundedAt: fundedAt}
+		for _, position := range positions {
+			if position.Quantity > 0 {
+				rate.LongInterest += position.Quantity * coin.CurrentPrice
+			} else {
+				rate.ShortInterest -= position.Quantity * coin.CurrentPrice
+			}
+		}
+		rate.Rate = fundingBaseRate
+		if interest := rate.LongInterest + rate.ShortInterest; interest > 0 {
+			rate.Rate += fundingImbalanceRate * (rate.LongInterest - rate.ShortInterest) / interest
+		}
+		rate.Rate = math.Max(-maxFundingRate, math.Min(maxFundingRate, rate.Rate))
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rate)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		for _, position := range positions {
+			amount := position.Quantity * coin.CurrentPrice * rate.Rate
+			if err := tx.Model(&position).Updates(map[string]interface{}{
+				"margin":       position.Margin - amount,
+				"funding_paid": position.FundingPaid + amount,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.FundingPayment{
+				PositionID: position.ID,
+				UserID:     position.UserID,
+				CoinID:     coinID,
+				Rate:       rate.Rate,
+				MarkPrice:  coin.CurrentPrice,
+				Quantity:   position.Quantity,
+				Amount:     amount,
+				CreatedAt:  fundedAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("Unsupported currency")
+	ErrInsufficientBalance = errors.New("Insufficient balance")
+)
+
+// NormalizeCurrency upper-cases a currency code, falling back to BaseCurrency
+// when it is empty.
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return models.BaseCurrency
+	}
+	return currency
+}
+
+// GetFxRate returns how many units of currency one BaseCurrency buys.
+func GetFxRate(currency string) (float64, error) {
+	currency = NormalizeCurrency(currency)
+	if currency == models.BaseCurrency {
+		return 1, nil
+	}
+
+	var rate models.FxRate
+	if err := database.DB.Where("currency = ?", currency).First(&rate).Error; err != nil || rate.Rate <= 0 {
+		return 0, ErrUnsupportedCurrency
+	}
+	return rate.Rate, nil
+}
+
+// Convert converts amount between two currencies through BaseCurrency.
+func Convert(amount float64, from, to string) (float64, error) {
+	from, to = NormalizeCurrency(from), NormalizeCurrency(to)
+	if from == to {
+		return amount, nil
+	}
+
+	fromRate, err := GetFxRate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := GetFxRate(to)
+	if err != nil {
+		return 0, err
+	}
+	return amount / fromRate * toRate, nil
+}
+
+// AdjustCashBalance adds delta (which may be negative) to the portfolio's cash
+// in the given currency. BaseCurrency lives on Portfolio.Balance, every other
+// currency in fiat_balances. The balance row is locked for the rest of tx, and
+// it fails with ErrInsufficientBalance rather than letting a balance go
+// negative.
+func AdjustCashBalance(tx *gorm.DB, portfolio models.Portfolio, currency string, delta float64) error {
+	currency = NormalizeCurrency(currency)
+
+	if currency == models.BaseCurrency {
+		var locked models.Portfolio
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "balance").First(&locked, portfolio.ID).Error; err != nil {
+			return err
+		}
+		if locked.Balance+delta < 0 {
+			return ErrInsufficientBalance
+		}
+		return tx.Model(&locked).Update("balance", locked.Balance+delta).Error
+	}
+
+	if _, err := GetFxRate(currency); err != nil {
+		return err
+	}
+
+	var balance models.FiatBalance
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("portfolio_id = ? AND currency = ?", portfolio.ID, currency).
+		First(&balance).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if delta < 0 {
+			return ErrInsufficientBalance
+		}
+		return tx.Create(&models.FiatBalance{
+			UserID:      portfolio.UserID,
+			PortfolioID: portfolio.ID,
+			Currency:    currency,
+			Amount:      delta,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if balance.Amount+delta < 0 {
+		return ErrInsufficientBalance
+	}
+	return tx.Model(&balance).Update("amount", balance.Amount+delta).Error
+}
+
+// CashBalances returns the portfolio's cash per currency, BaseCurrency first.
+func CashBalances(portfolio models.Portfolio) ([]models.FiatBalance, error) {
+	var balances []models.FiatBalance
+	if err := database.DB.Where("portfolio_id = ? AND amount > 0", portfolio.ID).Order("currency asc").Find(&balances).Error; err != nil {
+		return nil, err
+	}
+
+	base := models.FiatBalance{
+		UserID:      portfolio.UserID,
+		PortfolioID: portfolio.ID,
+		Currency:    models.BaseCurrency,
+		Amount:      portfolio.Balance,
+	}
+	return append([]models.FiatBalance{base}, balances...), nil
+}
+
+// TotalCash sums the user's cash balances expressed in currency.
+func TotalCash(balances []models.FiatBalance, currency string) (float64, error) {
+	var total float64
+	for _, balance := range balances {
+		converted, err := Convert(balance.Amount, balance.Currency, currency)
+		if err != nil {
+			return 0, err
+		}
+		total += converted
+	}
+	return total, nil
+}
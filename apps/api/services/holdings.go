@@ -0,0 +1,78 @@
+package services
+
+import (
+	"crypto-app-api/models"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCoinNotFound         = errors.New("Coin not found")
+	ErrCoinNotOwned         = errors.New("You don't own this coin")
+	ErrInsufficientQuantity = errors.New("Insufficient coin quantity")
+)
+
+// AddToHolding adds quantity of a coin acquired at price to the portfolio's
+// holding, blending it into the average price.
+func AddToHolding(tx *gorm.DB, portfolio models.Portfolio, coinID uint, quantity, price float64) error {
+	var userCoin models.UserCoin
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("portfolio_id = ? AND coin_id = ?", portfolio.ID, coinID).
+		First(&userCoin).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&models.UserCoin{
+			UserID:       portfolio.UserID,
+			PortfolioID:  portfolio.ID,
+			CoinID:       coinID,
+			Quantity:     quantity,
+			AveragePrice: price,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&userCoin).Updates(map[string]interface{}{
+		"quantity":      userCoin.Quantity + quantity,
+		"average_price": blendAveragePrice(userCoin.Quantity, userCoin.AveragePrice, quantity, price),
+	}).Error
+}
+
+// blendAveragePrice is the average price of a holding of held coins at
+// averagePrice after adding quantity bought at price.
+func blendAveragePrice(held, averagePrice, quantity, price float64) float64 {
+	return (held*averagePrice + quantity*price) / (held + quantity)
+}
+
+// RemoveFromHolding takes quantity of a coin out of the portfolio's holding and
+// returns the holding's average price. The holding is deleted once empty.
+func RemoveFromHolding(tx *gorm.DB, portfolio models.Portfolio, coinID uint, quantity float64) (float64, error) {
+	var userCoin models.UserCoin
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("portfolio_id = ? AND coin_id = ?", portfolio.ID, coinID).
+		First(&userCoin).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrCoinNotOwned
+		}
+		return 0, err
+	}
+
+	if userCoin.Quantity < quantity {
+		return 0, ErrInsufficientQuantity
+	}
+
+	newQuantity := userCoin.Quantity - quantity
+	if newQuantity > 0 {
+		return userCoin.AveragePrice, tx.Model(&userCoin).Update("quantity", newQuantity).Error
+	}
+	return userCoin.AveragePrice, tx.Delete(&userCoin).Error
+}
+
+// Holdings returns the portfolio's non-empty holdings with their coins loaded.
+func Holdings(tx *gorm.DB, portfolioID uint) ([]models.UserCoin, error) {
+	var holdings []models.UserCoin
+	err := tx.Preload("Coin").Where("portfolio_id = ? AND quantity > 0", portfolioID).Find(&holdings).Error
+	return holdings, err
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/indicators"
+	"crypto-app-api/models"
+	"errors"
+	"time"
+)
+
+const MaxIndicatorPoints = 500
+
+var (
+	ErrUnknownIndicator = errors.New("Indicator must be one of sma, ema, rsi, macd, bollinger or vwap")
+	ErrInvalidInterval  = errors.New("Interval must be one of 5m, 15m, 1h, 4h or 1d")
+)
+
+// defaultIndicatorPeriods is the period used when a query leaves it unset.
+var defaultIndicatorPeriods = map[string]int{
+	"sma":       20,
+	"ema":       20,
+	"rsi":       14,
+	"bollinger": 20,
+	"vwap":      20,
+}
+
+// CandleIntervals are the accepted candle sizes.
+var CandleIntervals = map[string]time.Duration{
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// Candle aggregates the price history recorded in one interval. Volume is
+// the interval's share of the average rolling 24h volume seen in it, since
+// price history only carries 24h volume.
+type Candle struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+// IndicatorQuery selects an indicator and its parameters. Period is used by
+// every indicator except MACD, which uses Fast, Slow and Signal (12, 26 and
+// 9 when unset); StdDev is the Bollinger band width (2 when unset). Zero
+// values fall back to the usual defaults.
+type IndicatorQuery struct {
+	Name     string
+	Interval string
+	Period   int
+	Fast     int
+	Slow     int
+	Signal   int
+	StdDev   float64
+	Limit    int
+}
+
+// IndicatorPoint is an indicator's value(s) at the close of a candle, keyed
+// by line name, e.g. "rsi" or "upper"/"middle"/"lower".
+type IndicatorPoint struct {
+	Time   time.Time          `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+// Candles returns coinID's candles of the given size from since onwards.
+// Intervals without any recorded prices are skipped.
+func Candles(coinID uint, interval time.Duration, since time.Time) ([]Candle, error) {
+	return CandleRange(coinID, interval, since, time.Now().Add(interval))
+}
+
+// CandleRange returns coinID's candles built from prices recorded in
+// [from, to).
+func CandleRange(coinID uint, interval time.Duration, from, to time.Time) ([]Candle, error) {
+	seconds := interval.Seconds()
+
+	var candles []Candle
+	err := database.DB.Raw(`
+		SELECT to_timestamp(floor(extract(epoch FROM recorded_at) / ?) * ?) AS time,
+			(array_agg(price ORDER BY recorded_at))[1] AS open,
+			MAX(price) AS high,
+			MIN(price) AS low,
+			(array_agg(price ORDER BY recorded_at DESC))[1] AS close,
+			AVG(volume_24h) * ? AS volume
+		FROM price_history
+		WHERE coin_id = ? AND recorded_at >= ? AND recorded_at < ?
+		GROUP BY 1
+		ORDER BY 1`, seconds, seconds, interval.Hours()/24, coinID, from, to).
+		Scan(&candles).Error
+	return candles, err
+}
+
+// ComputeIndicator evaluates the query over coinID's price history and
+// returns up to query.Limit of the most recent points.
+func ComputeIndicator(coinID uint, query IndicatorQuery) ([]IndicatorPoint, error) {
+	interval, ok := CandleIntervals[query.Interval]
+	if !ok {
+		return nil, ErrInvalidInterval
+	}
+	if query.Limit < 1 || query.Limit > MaxIndicatorPoints {
+		query.Limit = MaxIndicatorPoints
+	}
+	if query.Period == 0 {
+		query.Period = defaultIndicatorPeriods[query.Name]
+	}
+	if query.Fast == 0 && query.Slow == 0 && query.Signal == 0 {
+		query.Fast, query.Slow, query.Signal = 12, 26, 9
+	}
+	if query.StdDev == 0 {
+		query.StdDev = 2
+	}
+
+	warmup, err := indicatorWarmup(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var coin models.Coin
+	if err := database.DB.First(&coin, coinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+
+	since := time.Now().Truncate(interval).Add(-time.Duration(query.Limit+warmup-1) * interval)
+	candles, err := Candles(coin.ID, interval, since)
+	if err != nil {
+		return nil, err
+	}
+
+	closes := make([]float64, len(candles))
+	for i, candle := range candles {
+		closes[i] = candle.Close
+	}
+
+	lines := make(map[string][]float64)
+	switch query.Name {
+	case "sma":
+		lines["sma"], err = indicators.SMA(closes, query.Period)
+	case "ema":
+		lines["ema"], err = indicators.EMA(closes, query.Period)
+	case "rsi":
+		lines["rsi"], err = indicators.RSI(closes, query.Period)
+	case "macd":
+		var macd *indicators.MACDResult
+		if macd, err = indicators.MACD(closes, query.Fast, query.Slow, query.Signal); err == nil {
+			lines["macd"], lines["signal"], lines["histogram"] = macd.MACD, macd.Signal, macd.Histogram
+		}
+	case "bollinger":
+		var bands *indicators.BandsResult
+		if bands, err = indicators.Bollinger(closes, query.Period, query.StdDev); err == nil {
+			lines["middle"], lines["upper"], lines["lower"] = bands.Middle, bands.Upper, bands.Lower
+		}
+	case "vwap":
+		typical := make([]float64, len(candles))
+		volumes := make([]float64, len(candles))
+		for i, candle := range candles {
+			typical[i] = (candle.High + candle.Low + candle.Close) / 3
+			volumes[i] = candle.Volume
+		}
+		lines["vwap"], err = indicators.VWAP(typical, volumes, query.Period)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// All lines of an indicator have the same length and end at the last candle
+	length := 0
+	for _, line := range lines {
+		length = len(line)
+	}
+	if length > query.Limit {
+		length = query.Limit
+	}
+
+	points := make([]IndicatorPoint, length)
+	for i := range points {
+		candle := candles[len(candles)-length+i]
+		points[i] = IndicatorPoint{Time: candle.Time, Values: make(map[string]float64, len(lines))}
+		for name, line := range lines {
+			points[i].Values[name] = line[len(line)-length+i]
+		}
+	}
+	return points, nil
+}
+
+// indicatorWarmup is how many candles the query needs before its first
+// point. EMA and RSI get extra history so their smoothing seed has decayed.
+func indicatorWarmup(query IndicatorQuery) (int, error) {
+	switch query.Name {
+	case "sma", "bollinger", "vwap":
+		if query.Period < 1 || query.Period > MaxIndicatorPoints {
+			return 0, indicators.ErrInvalidPeriod
+		}
+		return query.Period - 1, nil
+	case "ema", "rsi":
+		if query.Period < 1 || query.Period > MaxIndicatorPoints {
+			return 0, indicators.ErrInvalidPeriod
+		}
+		return query.Period * 3, nil
+	case "macd":
+		if query.Fast < 1 || query.Slow <= query.Fast || query.Slow > MaxIndicatorPoints ||
+			query.Signal < 1 || query.Signal > MaxIndicatorPoints {
+			return 0, indicators.ErrInvalidPeriod
+		}
+		return query.Slow*3 + query.Signal - 1, nil
+	}
+	return 0, ErrUnknownIndicator
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Job is a unit of background work run periodically inside the API process.
+// Jobs must be safe to run concurrently from several API replicas.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func() error
+}
+
+// StartJobs runs each job on its own ticker until the process exits.
+func StartJobs(jobs ...Job) {
+	for _, job := range jobs {
+		go runJob(job)
+	}
+}
+
+func runJob(job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	log.Printf("Background job %s started (every %s)", job.Name, job.Interval)
+	for range ticker.C {
+		if err := runJobOnce(job); err != nil {
+			log.Printf("Background job %s failed: %v", job.Name, err)
+		}
+	}
+}
+
+// runJobOnce keeps a panicking job from taking the whole process down,
+// reporting the panic as the job's error.
+func runJobOnce(job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job %s panicked: %v", job.Name, r)
+		}
+	}()
+	return job.Run()
+}
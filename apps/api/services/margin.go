@@ -0,0 +1,769 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultLeverage is used for coins an account has not set leverage for.
+	DefaultLeverage = 3.0
+	// MaxLeverage caps the leverage of any position.
+	MaxLeverage = 10.0
+
+	// marginInterestRate is the annual interest charged on margin loans.
+	marginInterestRate = 0.10
+	// shortBorrowRate is the annual fee charged on the current value of
+	// coins borrowed for shorts.
+	shortBorrowRate = 0.05
+	// maintenanceRatio is the share of a position's initial margin, at its
+	// current value, that must stay covered by equity.
+	maintenanceRatio = 0.5
+	// marginCallRatio is how far above the maintenance margin equity must
+	// stay to avoid a margin call.
+	marginCallRatio = 1.25
+)
+
+var (
+	ErrMarginAccountNotFound  = errors.New("No margin account; deposit collateral to open one")
+	ErrMarginPositionNotFound = errors.New("Margin position not found")
+	ErrMarginPositionClosed   = errors.New("Margin position is already closed")
+	ErrInvalidLeverage        = errors.New("Leverage must be between 1 and 10")
+	ErrInvalidMarginAmount    = errors.New("Amount must be positive")
+	ErrInsufficientMargin     = errors.New("Not enough free margin")
+	ErrInvalidMarginSide      = errors.New("Side must be long or short")
+)
+
+// MarginPositionStatus is a position valued at the coin's current price.
+// Value is negative for shorts, which owe the coin. Equity is what closing
+// it would return to the account after repaying its loan.
+type MarginPositionStatus struct {
+	models.MarginPosition
+	MarkPrice         float64 `json:"mark_price"`
+	Value             float64 `json:"value"`
+	Equity            float64 `json:"equity"`
+	UnrealizedPnL     float64 `json:"unrealized_pnl"`
+	MaintenanceMargin float64 `json:"maintenance_margin"`
+}
+
+// MarginReport is a margin account with its open positions and margin
+// figures, in BaseCurrency. Equity and the margins cover the margin
+// positions and cross futures positions; isolated futures positions stand
+// alone and their equity is reported separately. FreeMargin is the equity
+// not needed as initial margin for the open positions at current prices;
+// MarginLevel is equity over the maintenance margin, and the account is
+// liquidated when it falls below 1. Leverage maps coin IDs to the
+// account's leverage settings.
+type MarginReport struct {
+	models.MarginAccount
+	Leverage          map[uint]float64        `json:"leverage"`
+	Positions         []MarginPositionStatus  `json:"positions"`
+	Futures           []FuturesPositionStatus `json:"futures"`
+	Equity            float64                 `json:"equity"`
+	IsolatedEquity    float64                 `json:"isolated_equity"`
+	Loans             float64                 `json:"loans"`
+	InitialMargin     float64                 `json:"initial_margin"`
+	MaintenanceMargin float64                 `json:"maintenance_margin"`
+	FreeMargin        float64                 `json:"free_margin"`
+	MarginLevel       float64                 `json:"margin_level"`
+	MarginCall        bool                    `json:"margin_call"`
+}
+
+// marginBook is a margin account with its open margin and futures
+// positions, loaded with their coins.
+type marginBook struct {
+	Account   *models.MarginAccount
+	Positions []models.MarginPosition
+	Futures   []models.FuturesPosition
+}
+
+func loadMarginBook(tx *gorm.DB, account *models.MarginAccount) (*marginBook, error) {
+	positions, err := openMarginPositions(tx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	futures, err := openFuturesPositions(tx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &marginBook{Account: account, Positions: positions, Futures: futures}, nil
+}
+
+// measureMargin values the book's open positions at current prices.
+func measureMargin(book marginBook) *MarginReport {
+	report := &MarginReport{
+		MarginAccount: *book.Account,
+		Positions:     make([]MarginPositionStatus, 0, len(book.Positions)),
+		Futures:       make([]FuturesPositionStatus, 0, len(book.Futures)),
+		Equity:        book.Account.Cash,
+	}
+	for _, position := range book.Positions {
+		status := MarginPositionStatus{MarginPosition: position, MarkPrice: position.Coin.CurrentPrice}
+		status.Value = position.Quantity * status.MarkPrice
+		status.Equity = position.Collateral + status.Value - position.Loan
+		status.UnrealizedPnL = status.Equity - position.Margin
+		initial := math.Abs(status.Value) / position.Leverage
+		status.MaintenanceMargin = initial * maintenanceRatio
+
+		report.Positions = append(report.Positions, status)
+		report.Equity += status.Equity
+		report.Loans += position.Loan
+		report.InitialMargin += initial
+		report.MaintenanceMargin += status.MaintenanceMargin
+	}
+	for _, position := range book.Futures {
+		status := measureFutures(position)
+		report.Futures = append(report.Futures, status)
+		if position.MarginMode == models.FuturesIsolated {
+			report.IsolatedEquity += status.Equity
+			continue
+		}
+		report.Equity += status.Equity
+		report.InitialMargin += status.InitialMargin
+		report.MaintenanceMargin += status.MaintenanceMargin
+	}
+	report.FreeMargin = report.Equity - report.InitialMargin
+	if report.MaintenanceMargin > 0 {
+		report.MarginLevel = report.Equity / report.MaintenanceMargin
+	}
+	report.MarginCall = book.Account.MarginCalledAt != nil
+	return report
+}
+
+func lockMarginAccount(tx *gorm.DB, portfolioID uint) (*models.MarginAccount, error) {
+	var account models.MarginAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("portfolio_id = ?", portfolioID).
+		First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMarginAccountNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+func openMarginPositions(tx *gorm.DB, accountID uint) ([]models.MarginPosition, error) {
+	var positions []models.MarginPosition
+	err := tx.Preload("Coin").
+		Where("account_id = ? AND status = ?", accountID, models.MarginPositionOpen).
+		Order("created_at asc").
+		Find(&positions).Error
+	return positions, err
+}
+
+// accrueInterest grows each open position's loan by the interest due since
+// the account last accrued: interest on the cash borrowed for longs and the
+// borrow fee on the value of the coins borrowed for shorts.
+func accrueInterest(tx *gorm.DB, account *models.MarginAccount, positions []models.MarginPosition, now time.Time) error {
+	years := now.Sub(account.LastAccruedAt).Hours() / (24 * 365)
+	if years <= 0 {
+		return nil
+	}
+	for i := range positions {
+		position := &positions[i]
+		interest := position.Loan * marginInterestRate * years
+		if position.Side == models.MarginShort {
+			interest = -position.Quantity * position.Coin.CurrentPrice * shortBorrowRate * years
+		}
+		if interest <= 0 {
+			continue
+		}
+		position.Loan += interest
+		position.Interest += interest
+		if err := tx.Model(position).Updates(map[string]interface{}{
+			"loan":     position.Loan,
+			"interest": position.Interest,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	account.LastAccruedAt = now
+	return tx.Model(account).Update("last_accrued_at", now).Error
+}
+
+// withMarginAccount runs fn on the book of the portfolio's locked margin
+// account with interest accrued on its open positions.
+func withMarginAccount(portfolio models.Portfolio, fn func(tx *gorm.DB, book *marginBook) error) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		account, err := lockMarginAccount(tx, portfolio.ID)
+		if err != nil {
+			return err
+		}
+		book, err := loadMarginBook(tx, account)
+		if err != nil {
+			return err
+		}
+		if err := accrueInterest(tx, account, book.Positions, time.Now()); err != nil {
+			return err
+		}
+		return fn(tx, book)
+	})
+}
+
+// GetMarginAccount returns the portfolio's margin account with interest
+// accrued up to now.
+func GetMarginAccount(portfolio models.Portfolio) (*MarginReport, error) {
+	var report *MarginReport
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		report = measureMargin(*book)
+
+		var leverages []models.MarginLeverage
+		if err := tx.Where("account_id = ?", book.Account.ID).Find(&leverages).Error; err != nil {
+			return err
+		}
+		report.Leverage = make(map[uint]float64, len(leverages))
+		for _, leverage := range leverages {
+			report.Leverage[leverage.CoinID] = leverage.Leverage
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// DepositMargin moves cash from the portfolio into its margin account,
+// opening the account on the first deposit.
+func DepositMargin(portfolio models.Portfolio, amount float64) (*MarginReport, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidMarginAmount
+	}
+	if portfolio.IsContest() {
+		return nil, ErrContestPortfolio
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := AdjustCashBalance(tx, portfolio, models.BaseCurrency, -amount); err != nil {
+			return err
+		}
+		account := models.MarginAccount{UserID: portfolio.UserID, PortfolioID: portfolio.ID, LastAccruedAt: time.Now()}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+			return err
+		}
+		locked, err := lockMarginAccount(tx, portfolio.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(locked).Update("cash", locked.Cash+amount).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetMarginAccount(portfolio)
+}
+
+// WithdrawMargin moves cash back to the portfolio. Only free margin can be
+// withdrawn.
+func WithdrawMargin(portfolio models.Portfolio, amount float64) (*MarginReport, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidMarginAmount
+	}
+
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		report := measureMargin(*book)
+		if amount > book.Account.Cash || amount > report.FreeMargin {
+			return ErrInsufficientMargin
+		}
+		if err := tx.Model(book.Account).Update("cash", book.Account.Cash-amount).Error; err != nil {
+			return err
+		}
+		return AdjustCashBalance(tx, portfolio, models.BaseCurrency, amount)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetMarginAccount(portfolio)
+}
+
+// SetMarginLeverage sets the leverage new positions in the coin open with.
+// Open positions keep the leverage they were opened with.
+func SetMarginLeverage(portfolio models.Portfolio, coinID uint, leverage float64) (*MarginReport, error) {
+	if leverage < 1 || leverage > MaxLeverage {
+		return nil, ErrInvalidLeverage
+	}
+	var coin models.Coin
+	if err := database.DB.First(&coin, coinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "account_id"}, {Name: "coin_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"leverage"}),
+		}).Create(&models.MarginLeverage{AccountID: book.Account.ID, CoinID: coin.ID, Leverage: leverage}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetMarginAccount(portfolio)
+}
+
+func marginLeverage(tx *gorm.DB, accountID, coinID uint) (float64, error) {
+	var setting models.MarginLeverage
+	if err := tx.Where("account_id = ? AND coin_id = ?", accountID, coinID).Limit(1).Find(&setting).Error; err != nil {
+		return 0, err
+	}
+	if setting.ID == 0 {
+		return DefaultLeverage, nil
+	}
+	return setting.Leverage, nil
+}
+
+// OpenMarginPosition opens amount worth of the coin at its current price
+// with the account's leverage for it, taking amount/leverage from the
+// account's cash as margin. A long borrows the rest of the cash and buys
+// the coin; a short borrows the coin and sells it, keeping the proceeds
+// with the margin as collateral.
+func OpenMarginPosition(portfolio models.Portfolio, req models.MarginPositionRequest) (*models.MarginPosition, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidMarginAmount
+	}
+	if req.Side == "" {
+		req.Side = models.MarginLong
+	}
+	if req.Side != models.MarginLong && req.Side != models.MarginShort {
+		return nil, ErrInvalidMarginSide
+	}
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+	if coin.CurrentPrice <= 0 {
+		return nil, ErrInvalidTradeAmount
+	}
+
+	var position models.MarginPosition
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		leverage, err := marginLeverage(tx, book.Account.ID, coin.ID)
+		if err != nil {
+			return err
+		}
+		margin := req.Amount / leverage
+		report := measureMargin(*book)
+		if margin > book.Account.Cash || margin > report.FreeMargin {
+			return ErrInsufficientMargin
+		}
+
+		position = models.MarginPosition{
+			AccountID:  book.Account.ID,
+			UserID:     book.Account.UserID,
+			CoinID:     coin.ID,
+			Side:       req.Side,
+			Quantity:   req.Amount / coin.CurrentPrice,
+			EntryPrice: coin.CurrentPrice,
+			Leverage:   leverage,
+			Margin:     margin,
+			Loan:       req.Amount - margin,
+			Status:     models.MarginPositionOpen,
+		}
+		if req.Side == models.MarginShort {
+			position.Quantity = -position.Quantity
+			position.Loan = 0
+			position.Collateral = margin + req.Amount
+		}
+		if err := tx.Create(&position).Error; err != nil {
+			return err
+		}
+		return tx.Model(book.Account).Update("cash", book.Account.Cash-margin).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	position.Coin = coin
+	return &position, nil
+}
+
+// CloseMarginPosition closes quantity of the position, or all of it when
+// zero, at the coin's current price: a long sells it and a short buys it
+// back to cover. The matching share of its loan is repaid.
+func CloseMarginPosition(portfolio models.Portfolio, positionID uint, quantity float64) (*models.MarginPosition, error) {
+	if quantity < 0 {
+		return nil, ErrInvalidTradeAmount
+	}
+
+	var closed models.MarginPosition
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		var position *models.MarginPosition
+		for i := range book.Positions {
+			if book.Positions[i].ID == positionID {
+				position = &book.Positions[i]
+			}
+		}
+		if position == nil {
+			var count int64
+			if err := tx.Model(&models.MarginPosition{}).
+				Where("id = ? AND account_id = ?", positionID, book.Account.ID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrMarginPositionClosed
+			}
+			return ErrMarginPositionNotFound
+		}
+		open := math.Abs(position.Quantity)
+		if quantity > open+lotEpsilon {
+			return ErrInsufficientQuantity
+		}
+		if quantity == 0 || quantity > open-lotEpsilon {
+			quantity = open
+		}
+
+		if err := closeMarginPosition(tx, book.Account, position, quantity, models.MarginPositionClosed); err != nil {
+			return err
+		}
+		closed = *position
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &closed, nil
+}
+
+// closeMarginPosition closes quantity of the position at its coin's current
+// price, selling a long or buying back a short. The closed share of its
+// collateral and the sale proceeds, less the cost of covering a short,
+// repay the closed share of the loan and the rest goes to the account's
+// cash; a shortfall beyond the account's cash is written off. Closing the
+// whole position gives it the status.
+func closeMarginPosition(tx *gorm.DB, account *models.MarginAccount, position *models.MarginPosition, quantity float64, status string) error {
+	price := position.Coin.CurrentPrice
+	share := quantity / math.Abs(position.Quantity)
+	closed := position.Quantity * share
+	loan := position.Loan * share
+	margin := position.Margin * share
+	collateral := position.Collateral * share
+	released := collateral + closed*price - loan
+
+	account.Cash = math.Max(0, account.Cash+released)
+	position.RealizedPnL += released - margin
+	position.Quantity -= closed
+	position.Loan -= loan
+	position.Margin -= margin
+	position.Collateral -= collateral
+	position.ClosePrice = price
+	if math.Abs(position.Quantity) <= lotEpsilon {
+		now := time.Now()
+		position.Quantity = 0
+		position.Loan = 0
+		position.Margin = 0
+		position.Collateral = 0
+		position.Status = status
+		position.ClosedAt = &now
+	}
+
+	if err := tx.Save(position).Error; err != nil {
+		return err
+	}
+	return tx.Model(account).Update("cash", account.Cash).Error
+}
+
+// MarginPositionsScope returns a query over the portfolio's margin
+// positions, for handlers to filter and page.
+func MarginPositionsScope(portfolio models.Portfolio) (*gorm.DB, error) {
+	accountID, err := marginAccountID(portfolio)
+	if err != nil {
+		return nil, err
+	}
+	return database.DB.Model(&models.MarginPosition{}).Where("account_id = ?", accountID), nil
+}
+
+func marginAccountID(portfolio models.Portfolio) (uint, error) {
+	var account models.MarginAccount
+	if err := database.DB.Where("portfolio_id = ?", portfolio.ID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrMarginAccountNotFound
+		}
+		return 0, err
+	}
+	return account.ID, nil
+}
+
+// MarginPnL totals the profit and loss of margin positions. RealizedPnL
+// is net of the interest and borrow fees paid on the closed parts and
+// UnrealizedPnL of those accrued on the open parts; Fees is the total of
+// both.
+type MarginPnL struct {
+	Positions     int     `json:"positions"`
+	OpenPositions int     `json:"open_positions"`
+	RealizedPnL   float64 `json:"realized_pnl"`
+	UnrealizedPnL float64 `json:"unrealized_pnl"`
+	Fees          float64 `json:"fees"`
+	TotalPnL      float64 `json:"total_pnl"`
+}
+
+func (p *MarginPnL) add(status MarginPositionStatus) {
+	p.Positions++
+	if status.Status == models.MarginPositionOpen {
+		p.OpenPositions++
+		p.UnrealizedPnL += status.UnrealizedPnL
+	}
+	p.RealizedPnL += status.RealizedPnL
+	p.Fees += status.Interest
+	p.TotalPnL = p.RealizedPnL + p.UnrealizedPnL
+}
+
+// CoinMarginPnL is the P&L of one side of a coin. OpenQuantity is negative
+// for shorts.
+type CoinMarginPnL struct {
+	MarginPnL
+	CoinID       uint    `json:"coin_id"`
+	Symbol       string  `json:"symbol"`
+	Side         string  `json:"side"`
+	OpenQuantity float64 `json:"open_quantity"`
+}
+
+// MarginPnLReport is the P&L of a margin account's positions, open ones
+// valued at current prices, in BaseCurrency.
+type MarginPnLReport struct {
+	Long  MarginPnL       `json:"long"`
+	Short MarginPnL       `json:"short"`
+	Total MarginPnL       `json:"total"`
+	Coins []CoinMarginPnL `json:"coins"`
+}
+
+// GetMarginPnL reports the P&L of every position the portfolio's margin
+// account has held, by side and by coin.
+func GetMarginPnL(portfolio models.Portfolio) (*MarginPnLReport, error) {
+	report := &MarginPnLReport{Coins: []CoinMarginPnL{}}
+	err := withMarginAccount(portfolio, func(tx *gorm.DB, book *marginBook) error {
+		var settled []models.MarginPosition
+		if err := tx.Preload("Coin").
+			Where("account_id = ? AND status <> ?", book.Account.ID, models.MarginPositionOpen).
+			Find(&settled).Error; err != nil {
+			return err
+		}
+
+		statuses := measureMargin(*book).Positions
+		for _, position := range settled {
+			statuses = append(statuses, MarginPositionStatus{MarginPosition: position})
+		}
+
+		coins := make(map[string]int)
+		for _, status := range statuses {
+			report.Total.add(status)
+			if status.Side == models.MarginShort {
+				report.Short.add(status)
+			} else {
+				report.Long.add(status)
+			}
+
+			key := fmt.Sprintf("%d/%s", status.CoinID, status.Side)
+			i, ok := coins[key]
+			if !ok {
+				i = len(report.Coins)
+				coins[key] = i
+				report.Coins = append(report.Coins, CoinMarginPnL{
+					CoinID: status.CoinID,
+					Symbol: status.Coin.Symbol,
+					Side:   status.Side,
+				})
+			}
+			report.Coins[i].add(status)
+			report.Coins[i].OpenQuantity += status.Quantity
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Coins, func(i, j int) bool {
+		if report.Coins[i].Symbol != report.Coins[j].Symbol {
+			return report.Coins[i].Symbol < report.Coins[j].Symbol
+		}
+		return report.Coins[i].Side < report.Coins[j].Side
+	})
+	return report, nil
+}
+
+// SubscribeMargin checks the margin of every account with open margin or
+// futures positions in a coin whose price was updated.
+func SubscribeMargin() {
+	events.Subscribe(func(event events.Event) {
+		coins, ok := event.Data.([]models.Coin)
+		if !ok || len(coins) == 0 {
+			return
+		}
+		coinIDs := make([]uint, len(coins))
+		for i, coin := range coins {
+			coinIDs[i] = coin.ID
+		}
+		if err := checkMarginAccounts(coinIDs); err != nil {
+			log.Printf("Failed to check margin accounts: %v", err)
+		}
+	}, events.PricesUpdated)
+}
+
+// RunMarginChecks accrues interest on and checks every account with open
+// positions, so loans keep growing and are checked without price updates.
+func RunMarginChecks() error {
+	return checkMarginAccounts(nil)
+}
+
+// checkMarginAccounts checks the accounts with open positions in any of
+// the coins, or in any coin when coinIDs is nil.
+func checkMarginAccounts(coinIDs []uint) error {
+	seen := make(map[uint]bool)
+	var accountIDs []uint
+	for _, model := range []interface{}{&models.MarginPosition{}, &models.FuturesPosition{}} {
+		query := database.DB.Model(model).Where("status = ?", models.MarginPositionOpen)
+		if coinIDs != nil {
+			query = query.Where("coin_id IN ?", coinIDs)
+		}
+		var ids []uint
+		if err := query.Distinct().Pluck("account_id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				accountIDs = append(accountIDs, id)
+			}
+		}
+	}
+
+	for _, accountID := range accountIDs {
+		if err := checkMarginAccount(accountID); err != nil {
+			log.Printf("Failed to check margin account %d: %v", accountID, err)
+		}
+	}
+	return nil
+}
+
+// checkMarginAccount liquidates isolated futures positions whose equity
+// has fallen below their maintenance margin, then every other open
+// position of an account whose equity has fallen below its maintenance
+// margin, and issues a margin call when the account gets within
+// marginCallRatio of it. Accounts being changed concurrently are skipped;
+// the next check picks them up.
+func checkMarginAccount(accountID uint) error {
+	var published []events.Event
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var account models.MarginAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ?", accountID).
+			Find(&account).Error; err != nil || account.ID == 0 {
+			return err
+		}
+		book, err := loadMarginBook(tx, &account)
+		if err != nil || len(book.Positions)+len(book.Futures) == 0 {
+			return err
+		}
+		now := time.Now()
+		if err := accrueInterest(tx, &account, book.Positions, now); err != nil {
+			return err
+		}
+
+		var cross []models.FuturesPosition
+		for i := range book.Futures {
+			position := &book.Futures[i]
+			status := measureFutures(*position)
+			if position.MarginMode != models.FuturesIsolated {
+				cross = append(cross, *position)
+				continue
+			}
+			if status.Equity >= status.MaintenanceMargin {
+				continue
+			}
+			if err := closeFuturesPosition(tx, &account, position, math.Abs(position.Quantity), models.MarginPositionLiquidated); err != nil {
+				return err
+			}
+			published = append(published, events.Event{
+				Type:        events.MarginLiquidated,
+				UserID:      account.UserID,
+				Title:       "Futures position liquidated",
+				Message:     fmt.Sprintf("Your isolated %s %s position was liquidated at %.2f", position.Coin.Symbol, position.Side, position.ClosePrice),
+				ReferenceID: position.ID,
+				Data:        status,
+				OccurredAt:  now,
+			})
+		}
+		book.Futures = cross
+		if len(book.Positions)+len(book.Futures) == 0 {
+			return nil
+		}
+
+		report := measureMargin(*book)
+		switch {
+		case report.Equity < report.MaintenanceMargin:
+			for i := range book.Positions {
+				if err := closeMarginPosition(tx, &account, &book.Positions[i], math.Abs(book.Positions[i].Quantity), models.MarginPositionLiquidated); err != nil {
+					return err
+				}
+			}
+			for i := range book.Futures {
+				if err := closeFuturesPosition(tx, &account, &book.Futures[i], math.Abs(book.Futures[i].Quantity), models.MarginPositionLiquidated); err != nil {
+					return err
+				}
+			}
+			published = append(published, events.Event{
+				Type:        events.MarginLiquidated,
+				UserID:      account.UserID,
+				Title:       "Margin positions liquidated",
+				Message:     fmt.Sprintf("Equity of %.2f fell below the maintenance margin of %.2f; %d positions were closed", report.Equity, report.MaintenanceMargin, len(book.Positions)+len(book.Futures)),
+				ReferenceID: account.ID,
+				Data:        report,
+				OccurredAt:  now,
+			})
+			return tx.Model(&account).Update("margin_called_at", nil).Error
+		case report.Equity < report.MaintenanceMargin*marginCallRatio:
+			if account.MarginCalledAt != nil {
+				return nil
+			}
+			published = append(published, events.Event{
+				Type:        events.MarginCall,
+				UserID:      account.UserID,
+				Title:       "Margin call",
+				Message:     fmt.Sprintf("Equity of %.2f is close to the maintenance margin of %.2f; deposit collateral or reduce positions to avoid liquidation", report.Equity, report.MaintenanceMargin),
+				ReferenceID: account.ID,
+				Data:        report,
+				OccurredAt:  now,
+			})
+			return tx.Model(&account).Update("margin_called_at", now).Error
+		case account.MarginCalledAt != nil:
+			return tx.Model(&account).Update("margin_called_at", nil).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range published {
+		events.Publish(event)
+	}
+	return nil
+}
+
+// marginValue sums the cash and open position equity of the user's margin
+// accounts at current prices, without accruing interest.
+func marginValue(tx *gorm.DB, userID uint) (cash, positions float64, err error) {
+	var accounts []models.MarginAccount
+	if err := tx.Where("user_id = ?", userID).Find(&accounts).Error; err != nil {
+		return 0, 0, err
+	}
+	for i := range accounts {
+		book, err := loadMarginBook(tx, &accounts[i])
+		if err != nil {
+			return 0, 0, err
+		}
+		report := measureMargin(*book)
+		cash += accounts[i].Cash
+		positions += report.Equity + report.IsolatedEquity - accounts[i].Cash
+	}
+	return cash, positions, nil
+}
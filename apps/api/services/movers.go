@@ -0,0 +1,240 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxMovers is the longest list GetMovers returns.
+	MaxMovers = 20
+
+	// moversTTL bounds how stale cached movers can get when prices are
+	// updated through another replica or only watchlists and trades changed.
+	moversTTL = time.Minute
+)
+
+var ErrInvalidMoversWindow = errors.New("Window must be one of 1h, 24h or 7d")
+
+// moverWindows are the accepted change windows.
+var moverWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// Mover is a coin with the figure it was ranked by: a price change in
+// percent for gainers and losers, or a count for most watched and traded.
+// Highest volume is ranked by the coin's own volume_24h.
+type Mover struct {
+	Coin             models.Coin `json:"coin"`
+	ChangePercentage float64     `json:"change_percentage,omitempty"`
+	Count            int64       `json:"count,omitempty"`
+}
+
+type Movers struct {
+	Window        string    `json:"window"`
+	Gainers       []Mover   `json:"gainers"`
+	Losers        []Mover   `json:"losers"`
+	HighestVolume []Mover   `json:"highest_volume"`
+	MostWatched   []Mover   `json:"most_watched"`
+	MostTraded    []Mover   `json:"most_traded"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// moversCache holds computed movers per window until the next price update
+// or moversTTL, whichever comes first. The generation changes on every invalidation so a computation that raced a
+// price update is not stored.
+var moversCache = struct {
+	sync.Mutex
+	generation int
+	byWindow   map[string]*Movers
+}{byWindow: make(map[string]*Movers)}
+
+// invalidateMovers drops cached movers after prices change.
+func invalidateMovers() {
+	moversCache.Lock()
+	moversCache.generation++
+	moversCache.byWindow = make(map[string]*Movers)
+	moversCache.Unlock()
+}
+
+// GetMovers returns the top limit coins in each movers list for the window.
+func GetMovers(window string, limit int) (*Movers, error) {
+	if _, ok := moverWindows[window]; !ok {
+		return nil, ErrInvalidMoversWindow
+	}
+	if limit < 1 || limit > MaxMovers {
+		limit = MaxMovers
+	}
+
+	moversCache.Lock()
+	cached := moversCache.byWindow[window]
+	generation := moversCache.generation
+	moversCache.Unlock()
+
+	if cached == nil || time.Since(cached.GeneratedAt) > moversTTL {
+		var err error
+		if cached, err = computeMovers(window); err != nil {
+			return nil, err
+		}
+		moversCache.Lock()
+		if moversCache.generation == generation {
+			moversCache.byWindow[window] = cached
+		}
+		moversCache.Unlock()
+	}
+
+	return &Movers{
+		Window:        cached.Window,
+		Gainers:       truncateMovers(cached.Gainers, limit),
+		Losers:        truncateMovers(cached.Losers, limit),
+		HighestVolume: truncateMovers(cached.HighestVolume, limit),
+		MostWatched:   truncateMovers(cached.MostWatched, limit),
+		MostTraded:    truncateMovers(cached.MostTraded, limit),
+		GeneratedAt:   cached.GeneratedAt,
+	}, nil
+}
+
+func truncateMovers(movers []Mover, limit int) []Mover {
+	if len(movers) > limit {
+		return movers[:limit]
+	}
+	return movers
+}
+
+func computeMovers(window string) (*Movers, error) {
+	var coins []models.Coin
+	if err := database.DB.Find(&coins).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Coin, len(coins))
+	for _, coin := range coins {
+		byID[coin.ID] = coin
+	}
+
+	changes, err := priceChanges(coins, window)
+	if err != nil {
+		return nil, err
+	}
+
+	movers := &Movers{
+		Window:      window,
+		Gainers:     []Mover{},
+		Losers:      []Mover{},
+		GeneratedAt: time.Now(),
+	}
+
+	var ranked []Mover
+	for _, coin := range coins {
+		if change, ok := changes[coin.ID]; ok {
+			ranked = append(ranked, Mover{Coin: coin, ChangePercentage: change})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].ChangePercentage > ranked[j].ChangePercentage })
+	for _, mover := range ranked {
+		if mover.ChangePercentage > 0 && len(movers.Gainers) < MaxMovers {
+			movers.Gainers = append(movers.Gainers, mover)
+		}
+	}
+	for i := len(ranked) - 1; i >= 0; i-- {
+		if ranked[i].ChangePercentage < 0 && len(movers.Losers) < MaxMovers {
+			movers.Losers = append(movers.Losers, ranked[i])
+		}
+	}
+
+	sort.Slice(coins, func(i, j int) bool { return coins[i].Volume24h > coins[j].Volume24h })
+	for _, coin := range truncateCoins(coins, MaxMovers) {
+		movers.HighestVolume = append(movers.HighestVolume, Mover{Coin: coin})
+	}
+
+	// Users watching a coin, however many of their lists it is on
+	watched, err := rankedCounts(database.DB.Model(&models.Watchlist{}).
+		Select("coin_id, COUNT(DISTINCT user_id) AS count"))
+	if err != nil {
+		return nil, err
+	}
+	movers.MostWatched = countMovers(watched, byID)
+
+	traded, err := rankedCounts(database.DB.Model(&models.Trade{}).
+		Select("coin_id, COUNT(*) AS count").
+		Where("created_at >= ?", time.Now().Add(-moverWindows[window])))
+	if err != nil {
+		return nil, err
+	}
+	movers.MostTraded = countMovers(traded, byID)
+
+	return movers, nil
+}
+
+// priceChanges returns each coin's price change over the window in percent.
+// The 24h window uses the change reported with price updates; the others
+// compare against the last price recorded before the window started, so
+// coins without that much history are left out.
+func priceChanges(coins []models.Coin, window string) (map[uint]float64, error) {
+	changes := make(map[uint]float64, len(coins))
+	if window == "24h" {
+		for _, coin := range coins {
+			changes[coin.ID] = coin.PriceChangePercentage24h
+		}
+		return changes, nil
+	}
+
+	var base []struct {
+		CoinID uint
+		Price  float64
+	}
+	if err := database.DB.Raw(`
+		SELECT DISTINCT ON (coin_id) coin_id, price
+		FROM price_history
+		WHERE recorded_at <= ?
+		ORDER BY coin_id, recorded_at DESC`, time.Now().Add(-moverWindows[window])).
+		Scan(&base).Error; err != nil {
+		return nil, err
+	}
+
+	current := make(map[uint]float64, len(coins))
+	for _, coin := range coins {
+		current[coin.ID] = coin.CurrentPrice
+	}
+	for _, row := range base {
+		if price, ok := current[row.CoinID]; ok && row.Price > 0 {
+			changes[row.CoinID] = (price - row.Price) / row.Price * 100
+		}
+	}
+	return changes, nil
+}
+
+type coinCount struct {
+	CoinID uint
+	Count  int64
+}
+
+func rankedCounts(query *gorm.DB) ([]coinCount, error) {
+	var counts []coinCount
+	err := query.Group("coin_id").Order("count DESC").Limit(MaxMovers).Scan(&counts).Error
+	return counts, err
+}
+
+func countMovers(counts []coinCount, coins map[uint]models.Coin) []Mover {
+	movers := make([]Mover, 0, len(counts))
+	for _, count := range counts {
+		if coin, ok := coins[count.CoinID]; ok {
+			movers = append(movers, Mover{Coin: coin, Count: count.Count})
+		}
+	}
+	return movers
+}
+
+func truncateCoins(coins []models.Coin, limit int) []models.Coin {
+	if len(coins) > limit {
+		return coins[:limit]
+	}
+	return coins
+}
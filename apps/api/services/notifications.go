@@ -0,0 +1,121 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotificationNotFound    = errors.New("Notification not found")
+	ErrUnknownNotificationType = errors.New("Unknown notification type")
+)
+
+// SubscribeNotifications puts published events into the owner's inbox.
+// Triggered alerts are left out here because they reach the inbox through
+// their rule's own channels.
+func SubscribeNotifications() {
+	events.Subscribe(func(event events.Event) {
+		if err := createNotification(event); err != nil {
+			log.Printf("Failed to store %s notification for user %d: %v", event.Type, event.UserID, err)
+		}
+	}, events.TradeExecuted, events.BalanceChanged, events.MarginCall, events.MarginLiquidated)
+}
+
+// createNotification stores event in the user's inbox unless they have turned
+// its type off.
+func createNotification(event events.Event) error {
+	var pref models.NotificationPreference
+	err := database.DB.Where("user_id = ? AND type = ?", event.UserID, event.Type).First(&pref).Error
+	if err == nil && !pref.Enabled {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	notification := models.Notification{
+		UserID:  event.UserID,
+		Type:    event.Type,
+		Title:   event.Title,
+		Message: event.Message,
+	}
+	if event.ReferenceID != 0 {
+		notification.ReferenceID = &event.ReferenceID
+	}
+	return database.DB.Create(&notification).Error
+}
+
+// NotificationPreferences returns whether each event type is enabled for the
+// user's inbox.
+func NotificationPreferences(userID uint) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(events.Types))
+	for _, t := range events.Types {
+		prefs[t] = true
+	}
+
+	var saved []models.NotificationPreference
+	if err := database.DB.Where("user_id = ?", userID).Find(&saved).Error; err != nil {
+		return nil, err
+	}
+	for _, pref := range saved {
+		prefs[pref.Type] = pref.Enabled
+	}
+	return prefs, nil
+}
+
+// SetNotificationPreferences enables or disables the given event types,
+// leaving the others as they are.
+func SetNotificationPreferences(userID uint, updates map[string]bool) (map[string]bool, error) {
+	for t := range updates {
+		if !events.IsValidType(t) {
+			return nil, ErrUnknownNotificationType
+		}
+	}
+
+	for t, enabled := range updates {
+		if err := database.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+		}).Create(&models.NotificationPreference{
+			UserID:  userID,
+			Type:    t,
+			Enabled: enabled,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return NotificationPreferences(userID)
+}
+
+func MarkNotificationRead(userID, id uint) (*models.Notification, error) {
+	var notification models.Notification
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&notification).Error; err != nil {
+		return nil, ErrNotificationNotFound
+	}
+	if notification.ReadAt != nil {
+		return &notification, nil
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&notification).Update("read_at", now).Error; err != nil {
+		return nil, err
+	}
+	notification.ReadAt = &now
+	return &notification, nil
+}
+
+// MarkAllNotificationsRead marks every unread notification read and returns
+// how many there were.
+func MarkAllNotificationsRead(userID uint) (int64, error) {
+	result := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
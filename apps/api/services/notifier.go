@@ -0,0 +1,91 @@
+package services
+
+import (
+	"bytes"
+	"crypto-app-api/config"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"time"
+)
+
+// Recipient is who an event is delivered to. WebhookURL is only used by the
+// webhook channel.
+type Recipient struct {
+	User       models.User
+	WebhookURL string
+}
+
+// Notifier delivers events to a user over one channel.
+type Notifier interface {
+	Notify(to Recipient, event events.Event) error
+}
+
+// notifiers maps each supported delivery channel to its implementation.
+var notifiers = map[string]Notifier{
+	models.ChannelInbox:   InboxNotifier{},
+	models.ChannelEmail:   EmailNotifier{},
+	models.ChannelWebhook: WebhookNotifier{Client: &http.Client{Timeout: 10 * time.Second}},
+}
+
+// InboxNotifier stores events as in-app notifications, subject to the
+// user's notification preferences.
+type InboxNotifier struct{}
+
+func (InboxNotifier) Notify(to Recipient, event events.Event) error {
+	event.UserID = to.User.ID
+	return createNotification(event)
+}
+
+// EmailNotifier sends events through the configured SMTP server, or logs
+// them when none is configured.
+type EmailNotifier struct{}
+
+func (EmailNotifier) Notify(to Recipient, event events.Event) error {
+	cfg := config.AppConfig
+	if cfg.SMTPHost == "" {
+		log.Printf("Email to %s (SMTP not configured): %s - %s", to.User.Email, event.Title, event.Message)
+		return nil
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		cfg.SMTPFrom, to.User.Email, event.Title, event.Message)
+
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return smtp.SendMail(cfg.SMTPHost+":"+cfg.SMTPPort, auth, cfg.SMTPFrom, []string{to.User.Email}, []byte(body))
+}
+
+// WebhookNotifier POSTs events as JSON to the recipient's webhook URL.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+func (n WebhookNotifier) Notify(to Recipient, event events.Event) error {
+	if to.WebhookURL == "" {
+		return errors.New("no webhook URL")
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Post(to.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
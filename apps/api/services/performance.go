@@ -0,0 +1,395 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SnapshotInterval is how often each user's portfolio value is recorded.
+const SnapshotInterval = time.Hour
+
+var ErrInvalidPerformanceRange = errors.New("Range must be one of 1d, 7d, 30d, 90d, 1y or all")
+
+// performanceRanges are the accepted ranges; zero means all history.
+var performanceRanges = map[string]time.Duration{
+	"1d":  24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+	"1y":  365 * 24 * time.Hour,
+	"all": 0,
+}
+
+// Ranges longer than this are reported with one point per day.
+const dailyPointsAfter = 7 * 24 * time.Hour
+
+// PerformancePoint is one point of the equity curve. CumulativeReturn is the
+// time-weighted return since the start of the range, in percent.
+type PerformancePoint struct {
+	Time             time.Time `json:"time"`
+	Value            float64   `json:"value"`
+	NetFlow          float64   `json:"net_flow"`
+	CumulativeReturn float64   `json:"cumulative_return"`
+}
+
+// Performance summarises a user's returns over a range. Returns, drawdown
+// and volatility are in percent; volatility and the Sharpe ratio are
+// annualised.
+type Performance struct {
+	Range              string             `json:"range"`
+	Currency           string             `json:"currency"`
+	StartValue         float64            `json:"start_value"`
+	EndValue           float64            `json:"end_value"`
+	NetFlows           float64            `json:"net_flows"`
+	TimeWeightedReturn float64            `json:"time_weighted_return"`
+	MaxDrawdown        float64            `json:"max_drawdown"`
+	Volatility         float64            `json:"volatility"`
+	SharpeRatio        float64            `json:"sharpe_ratio"`
+	Points             []PerformancePoint `json:"points"`
+}
+
+// RecordPortfolioSnapshots snapshots every user without a snapshot in the
+// current SnapshotInterval. Each user is locked while their snapshot is
+// taken so replicas running the job concurrently skip rather than record
+// the same flows twice.
+func RecordPortfolioSnapshots() error {
+	period := time.Now().Truncate(SnapshotInterval)
+
+	var lastID uint
+	for {
+		var userIDs []uint
+		if err := database.DB.Model(&models.User{}).
+			Where("id > ?", lastID).
+			Where("NOT EXISTS (SELECT 1 FROM portfolio_snapshots s WHERE s.user_id = users.id AND s.recorded_at >= ?)", period).
+			Order("id asc").
+			Limit(200).
+			Pluck("id", &userIDs).Error; err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return nil
+		}
+
+		for _, userID := range userIDs {
+			if err := recordSnapshot(userID, period); err != nil {
+				log.Printf("Failed to snapshot portfolio value of user %d: %v", userID, err)
+			}
+		}
+		lastID = userIDs[len(userIDs)-1]
+	}
+}
+
+func recordSnapshot(userID uint, period time.Time) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ?", userID).
+			Find(&user).Error; err != nil || user.ID == 0 {
+			return err
+		}
+
+		previous, err := latestSnapshot(tx, userID)
+		if err != nil {
+			return err
+		}
+		if previous != nil && !previous.RecordedAt.Before(period) {
+			return nil
+		}
+
+		snapshot, err := measureSnapshot(tx, userID, previous)
+		if err != nil {
+			return err
+		}
+		return tx.Create(snapshot).Error
+	})
+}
+
+func latestSnapshot(tx *gorm.DB, userID uint) (*models.PortfolioSnapshot, error) {
+	var snapshot models.PortfolioSnapshot
+	err := tx.Where("user_id = ?", userID).Order("recorded_at desc").First(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// measureSnapshot values the user's portfolios now. The first snapshot has
+// no net flow since there is nothing before it to compare against.
+func measureSnapshot(tx *gorm.DB, userID uint, previous *models.PortfolioSnapshot) (*models.PortfolioSnapshot, error) {
+	now := time.Now()
+	snapshot := &models.PortfolioSnapshot{UserID: userID, RecordedAt: now}
+
+	var portfolios []models.Portfolio
+	// Contest portfolios are funded by their competition, not the user
+	if err := tx.Where("user_id = ? AND competition_id IS NULL", userID).Find(&portfolios).Error; err != nil {
+		return nil, err
+	}
+	for _, portfolio := range portfolios {
+		balances, err := CashBalances(portfolio)
+		if err != nil {
+			return nil, err
+		}
+		cash, err := TotalCash(balances, models.BaseCurrency)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Cash += cash
+
+		holdings, err := Holdings(tx, portfolio.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, holding := range holdings {
+			snapshot.HoldingsValue += holding.Quantity * holding.Coin.CurrentPrice
+		}
+	}
+
+	// Margin collateral and the equity of leveraged positions net of loans
+	marginCash, marginPositions, err := marginValue(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Cash += marginCash
+	snapshot.HoldingsValue += marginPositions
+
+	// Held withdrawals still belong to the user until they are confirmed
+	var held []models.Transfer
+	if err := tx.Preload("Coin").
+		Where("user_id = ? AND direction = ? AND status = ?", userID, models.TransferWithdrawal, models.TransferStatusPending).
+		Find(&held).Error; err != nil {
+		return nil, err
+	}
+	for _, transfer := range held {
+		value, err := transferValue(transfer)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Cash += value
+	}
+	snapshot.TotalValue = snapshot.Cash + snapshot.HoldingsValue
+
+	if previous != nil {
+		flow, err := netFlows(tx, userID, previous.RecordedAt, now)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.NetFlow = flow
+	}
+	return snapshot, nil
+}
+
+// netFlows is the value that entered minus the value that left the user's
+// account in (from, to]: confirmed transfers and account resets.
+func netFlows(tx *gorm.DB, userID uint, from, to time.Time) (float64, error) {
+	var transfers []models.Transfer
+	if err := tx.Preload("Coin").
+		Where("user_id = ? AND status = ? AND confirmed_at > ? AND confirmed_at <= ?",
+			userID, models.TransferStatusConfirmed, from, to).
+		Find(&transfers).Error; err != nil {
+		return 0, err
+	}
+
+	var flow float64
+	for _, transfer := range transfers {
+		value, err := transferValue(transfer)
+		if err != nil {
+			return 0, err
+		}
+		if transfer.Direction == models.TransferWithdrawal {
+			value = -value
+		}
+		flow += value
+	}
+
+	// A reset replaces the portfolio's value with its new starting balance
+	var resets []models.AccountReset
+	if err := tx.Where("user_id = ? AND created_at > ? AND created_at <= ?", userID, from, to).
+		Find(&resets).Error; err != nil {
+		return 0, err
+	}
+	for _, reset := range resets {
+		flow += reset.StartingBalance - reset.PreviousValue
+	}
+	return flow, nil
+}
+
+// transferValue values a transfer in BaseCurrency. Coin deposits use the
+// price they were credited at; coin withdrawals use the current price, the
+// same price held withdrawals are valued at in snapshots.
+func transferValue(transfer models.Transfer) (float64, error) {
+	if transfer.Asset == models.TransferAssetFiat {
+		return Convert(transfer.Amount, transfer.Currency, models.BaseCurrency)
+	}
+	if transfer.Direction == models.TransferDeposit {
+		return transfer.Amount * transfer.CostBasis, nil
+	}
+	if transfer.Coin == nil {
+		return 0, nil
+	}
+	return transfer.Amount * transfer.Coin.CurrentPrice, nil
+}
+
+// UserPerformance builds the equity curve and return metrics for the range
+// from the user's snapshots, ending with their current value. riskFree is
+// the annual risk-free rate in percent used for the Sharpe ratio.
+func UserPerformance(userID uint, rangeName string, riskFree float64) (*Performance, error) {
+	length, ok := performanceRanges[rangeName]
+	if !ok {
+		return nil, ErrInvalidPerformanceRange
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if length > 0 {
+		query = query.Where("recorded_at >= ?", time.Now().Add(-length))
+	}
+	var snapshots []models.PortfolioSnapshot
+	if err := query.Order("recorded_at asc").Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+
+	var previous *models.PortfolioSnapshot
+	if len(snapshots) > 0 {
+		previous = &snapshots[len(snapshots)-1]
+	}
+	current, err := measureSnapshot(database.DB, userID, previous)
+	if err != nil {
+		return nil, err
+	}
+	snapshots = append(snapshots, *current)
+
+	if length == 0 || length > dailyPointsAfter {
+		snapshots = dailySnapshots(snapshots)
+	}
+
+	return measurePerformance(rangeName, snapshots, riskFree), nil
+}
+
+// dailySnapshots keeps the last snapshot of each UTC day, carrying the flows
+// of the dropped ones.
+func dailySnapshots(snapshots []models.PortfolioSnapshot) []models.PortfolioSnapshot {
+	var daily []models.PortfolioSnapshot
+	for _, snapshot := range snapshots {
+		day := snapshot.RecordedAt.UTC().Truncate(24 * time.Hour)
+		if len(daily) > 0 && daily[len(daily)-1].RecordedAt.UTC().Truncate(24*time.Hour).Equal(day) {
+			last := &daily[len(daily)-1]
+			snapshot.NetFlow += last.NetFlow
+			*last = snapshot
+			continue
+		}
+		daily = append(daily, snapshot)
+	}
+	return daily
+}
+
+// measurePerformance chains per-period returns, treating each period's net
+// flow as arriving at its end, so deposits and withdrawals do not count as
+// gains or losses.
+func measurePerformance(rangeName string, snapshots []models.PortfolioSnapshot, riskFree float64) *Performance {
+	performance := &Performance{
+		Range:    rangeName,
+		Currency: models.BaseCurrency,
+		Points:   make([]PerformancePoint, 0, len(snapshots)),
+	}
+	if len(snapshots) == 0 {
+		return performance
+	}
+
+	performance.StartValue = snapshots[0].TotalValue
+	performance.EndValue = snapshots[len(snapshots)-1].TotalValue
+
+	index, peak := 1.0, 1.0
+	var returns []float64
+	for i, snapshot := range snapshots {
+		if i > 0 {
+			performance.NetFlows += snapshot.NetFlow
+			// Nothing can be lost past the whole value, and once the index
+			// has reached zero there is no base left to grow from, so it
+			// stays at -100%
+			if previous := snapshots[i-1].TotalValue; previous > 0 && index > 0 {
+				r := math.Max((snapshot.TotalValue-snapshot.NetFlow)/previous-1, -1)
+				returns = append(returns, r)
+				index *= 1 + r
+			}
+		}
+		peak = math.Max(peak, index)
+		performance.MaxDrawdown = math.Min(performance.MaxDrawdown, (index/peak-1)*100)
+
+		performance.Points = append(performance.Points, PerformancePoint{
+			Time:             snapshot.RecordedAt,
+			Value:            snapshot.TotalValue,
+			NetFlow:          snapshot.NetFlow,
+			CumulativeReturn: (index - 1) * 100,
+		})
+	}
+	performance.TimeWeightedReturn = (index - 1) * 100
+
+	if len(returns) < 2 {
+		return performance
+	}
+
+	periods := periodsPerYear(performance.Points)
+	if periods == 0 {
+		return performance
+	}
+
+	mean, deviation := meanAndDeviation(returns)
+	performance.Volatility = deviation * math.Sqrt(periods) * 100
+	if deviation > 0 {
+		performance.SharpeRatio = (mean*periods - riskFree/100) / (deviation * math.Sqrt(periods))
+	}
+	return performance
+}
+
+// pointReturn is the portfolio's return between two points of its equity
+// curve. ok is false when the earlier point is at -100%, leaving no base to
+// measure a return from.
+func pointReturn(previous, current PerformancePoint) (float64, bool) {
+	base := 1 + previous.CumulativeReturn/100
+	if base <= 0 {
+		return 0, false
+	}
+	return (1+current.CumulativeReturn/100)/base - 1, true
+}
+
+// periodsPerYear annualises per-point figures using the average spacing
+// between points. It returns 0 when there is no spacing to go by.
+func periodsPerYear(points []PerformancePoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	spacing := points[len(points)-1].Time.Sub(points[0].Time) / time.Duration(len(points)-1)
+	if spacing <= 0 {
+		return 0
+	}
+	return float64(365*24*time.Hour) / float64(spacing)
+}
+
+// meanAndDeviation returns the mean and sample standard deviation.
+func meanAndDeviation(values []float64) (mean, deviation float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+
+	var variance float64
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)-1))
+}
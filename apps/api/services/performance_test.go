@@ -0,0 +1,84 @@
+package services
+
+import (
+	"crypto-app-api/models"
+	"math"
+	"testing"
+	"time"
+)
+
+func snapshotSeries(values, flows []float64) []models.PortfolioSnapshot {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := make([]models.PortfolioSnapshot, len(values))
+	for i := range values {
+		snapshots[i] = models.PortfolioSnapshot{
+			RecordedAt: start.AddDate(0, 0, i),
+			TotalValue: values[i],
+			NetFlow:    flows[i],
+		}
+	}
+	return snapshots
+}
+
+func TestMeasurePerformance(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		flows    []float64
+		want     []float64
+		drawdown float64
+	}{
+		{"gain", []float64{100, 110, 121}, []float64{0, 0, 0}, []float64{0, 10, 21}, 0},
+		{"deposit is not a gain", []float64{100, 200, 220}, []float64{0, 100, 0}, []float64{0, 0, 10}, 0},
+		{"wiped out", []float64{100, 50, 0}, []float64{0, 0, 0}, []float64{0, -50, -100}, -100},
+		// A zero value leaves no base for the next period's return
+		{"funded again after zero", []float64{100, 0, 50, 75}, []float64{0, 0, 50, 0}, []float64{0, -100, -100, -100}, -100},
+		{"starts at zero", []float64{0, 100, 110}, []float64{0, 100, 0}, []float64{0, 0, 10}, 0},
+		// Losses beyond the whole value are capped at -100%
+		{"loss past zero", []float64{100, -20}, []float64{0, 0}, []float64{0, -100}, -100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			performance := measurePerformance("all", snapshotSeries(tt.values, tt.flows), 0)
+			if len(performance.Points) != len(tt.want) {
+				t.Fatalf("got %d points, want %d", len(performance.Points), len(tt.want))
+			}
+			for i, point := range performance.Points {
+				if math.IsNaN(point.CumulativeReturn) || math.IsInf(point.CumulativeReturn, 0) ||
+					math.Abs(point.CumulativeReturn-tt.want[i]) > 1e-9 {
+					t.Errorf("point %d: CumulativeReturn = %v, want %v", i, point.CumulativeReturn, tt.want[i])
+				}
+			}
+			if want := tt.want[len(tt.want)-1]; math.Abs(performance.TimeWeightedReturn-want) > 1e-9 {
+				t.Errorf("TimeWeightedReturn = %v, want %v", performance.TimeWeightedReturn, want)
+			}
+			if math.Abs(performance.MaxDrawdown-tt.drawdown) > 1e-9 {
+				t.Errorf("MaxDrawdown = %v, want %v", performance.MaxDrawdown, tt.drawdown)
+			}
+			for _, value := range []float64{performance.Volatility, performance.SharpeRatio} {
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					t.Errorf("Volatility/SharpeRatio = %v/%v, want finite", performance.Volatility, performance.SharpeRatio)
+				}
+			}
+		})
+	}
+}
+
+func TestPointReturn(t *testing.T) {
+	tests := []struct {
+		previous, current float64
+		want              float64
+		ok                bool
+	}{
+		{0, 10, 0.1, true},
+		{10, 21, 0.1, true},
+		{-50, -100, -1, true},
+		{-100, -100, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := pointReturn(PerformancePoint{CumulativeReturn: tt.previous}, PerformancePoint{CumulativeReturn: tt.current})
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("pointReturn(%v%%, %v%%) = %v, %v, want %v, %v", tt.previous, tt.current, got, ok, tt.want, tt.ok)
+		}
+	}
+}
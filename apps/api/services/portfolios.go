@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPortfolioName is the name given to the portfolio every user starts with.
+const DefaultPortfolioName = "Main"
+
+var (
+	ErrPortfolioNotFound        = errors.New("Portfolio not found")
+	ErrPortfolioArchived        = errors.New("Portfolio is archived")
+	ErrDefaultPortfolioArchive  = errors.New("The default portfolio cannot be archived")
+	ErrInvalidPortfolioName     = errors.New("Portfolio name is required")
+	ErrInvalidPortfolioTransfer = errors.New("Invalid portfolio transfer")
+)
+
+// CreateDefaultPortfolio creates the default portfolio for a new user.
+func CreateDefaultPortfolio(tx *gorm.DB, userID uint, balance float64) (*models.Portfolio, error) {
+	portfolio := models.Portfolio{
+		UserID:    userID,
+		Name:      DefaultPortfolioName,
+		IsDefault: true,
+		Balance:   balance,
+	}
+	if err := tx.Create(&portfolio).Error; err != nil {
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+// ResolvePortfolio returns the user's portfolio with the given ID, or their
+// default portfolio when portfolioID is zero. Archived portfolios are returned
+// too; use ActivePortfolio before changing anything in one.
+func ResolvePortfolio(userID, portfolioID uint) (*models.Portfolio, error) {
+	query := database.DB.Where("user_id = ?", userID)
+	if portfolioID == 0 {
+		query = query.Where("is_default = ?", true)
+	} else {
+		query = query.Where("id = ?", portfolioID)
+	}
+
+	var portfolio models.Portfolio
+	if err := query.First(&portfolio).Error; err != nil {
+		return nil, ErrPortfolioNotFound
+	}
+	return &portfolio, nil
+}
+
+// ActivePortfolio is ResolvePortfolio for operations that modify a portfolio.
+func ActivePortfolio(userID, portfolioID uint) (*models.Portfolio, error) {
+	portfolio, err := ResolvePortfolio(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio.IsArchived() {
+		return nil, ErrPortfolioArchived
+	}
+	return portfolio, nil
+}
+
+// LoadDefaultBalance fills user.Balance from the user's default portfolio.
+func LoadDefaultBalance(user *models.User) error {
+	portfolio, err := ResolvePortfolio(user.ID, 0)
+	if err != nil {
+		return err
+	}
+	user.Balance = portfolio.Balance
+	return nil
+}
+
+func CreatePortfolio(userID uint, name string) (*models.Portfolio, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidPortfolioName
+	}
+
+	portfolio := models.Portfolio{
+		UserID: userID,
+		Name:   name,
+	}
+	if err := database.DB.Create(&portfolio).Error; err != nil {
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+func RenamePortfolio(userID, portfolioID uint, name string) (*models.Portfolio, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidPortfolioName
+	}
+
+	portfolio, err := ResolvePortfolio(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(portfolio).Update("name", name).Error; err != nil {
+		return nil, err
+	}
+	return portfolio, nil
+}
+
+// ArchivePortfolio makes a portfolio read-only. Its holdings and history are
+// kept; the default portfolio cannot be archived.
+func ArchivePortfolio(userID, portfolioID uint) (*models.Portfolio, error) {
+	portfolio, err := ActivePortfolio(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio.IsDefault {
+		return nil, ErrDefaultPortfolioArchive
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(portfolio).Update("archived_at", now).Error; err != nil {
+		return nil, err
+	}
+	portfolio.ArchivedAt = &now
+	return portfolio, nil
+}
+
+// TransferBetweenPortfolios moves cash or coins between two of the user's
+// active portfolios. Coins keep their average price as cost basis, and their
+// tax lots keep their own cost basis and acquisition date.
+func TransferBetweenPortfolios(userID uint, req models.PortfolioTransferRequest) error {
+	if req.Amount <= 0 || req.FromPortfolioID == req.ToPortfolioID {
+		return ErrInvalidPortfolioTransfer
+	}
+
+	from, err := ActivePortfolio(userID, req.FromPortfolioID)
+	if err != nil {
+		return err
+	}
+	to, err := ActivePortfolio(userID, req.ToPortfolioID)
+	if err != nil {
+		return err
+	}
+	if from.IsContest() || to.IsContest() {
+		return ErrContestPortfolio
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		switch req.Asset {
+		case models.TransferAssetFiat:
+			if err := AdjustCashBalance(tx, *from, req.Currency, -req.Amount); err != nil {
+				return err
+			}
+			return AdjustCashBalance(tx, *to, req.Currency, req.Amount)
+		case models.TransferAssetCoin:
+			averagePrice, err := RemoveFromHolding(tx, *from, req.CoinID, req.Amount)
+			if err != nil {
+				return err
+			}
+			if err := AddToHolding(tx, *to, req.CoinID, req.Amount, averagePrice); err != nil {
+				return err
+			}
+			return moveLots(tx, *from, *to, req.CoinID, req.Amount)
+		default:
+			return ErrInvalidPortfolioTransfer
+		}
+	})
+}
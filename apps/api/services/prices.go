@@ -0,0 +1,73 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UpdateCoinPrices applies a batch of market data updates, recording a price
+// history point for each coin, and returns the updated coins. Unknown symbols
+// are ignored.
+func UpdateCoinPrices(updates []models.CoinPriceUpdate) ([]models.Coin, error) {
+	var coins []models.Coin
+	now := time.Now()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, update := range updates {
+			var coin models.Coin
+			if err := tx.Where("symbol = ?", update.Symbol).First(&coin).Error; err != nil {
+				continue
+			}
+
+			fields := map[string]interface{}{
+				"current_price":               update.CurrentPrice,
+				"market_cap":                  update.MarketCap,
+				"volume_24h":                  update.Volume24h,
+				"price_change_24h":            update.PriceChange24h,
+				"price_change_percentage_24h": update.PriceChangePercentage24h,
+				"last_updated":                now,
+			}
+			if update.Category != "" {
+				fields["category"] = update.Category
+				coin.Category = update.Category
+			}
+			if err := tx.Model(&coin).Updates(fields).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Create(&models.PriceHistory{
+				CoinID:     coin.ID,
+				Price:      update.CurrentPrice,
+				MarketCap:  update.MarketCap,
+				Volume24h:  update.Volume24h,
+				RecordedAt: now,
+			}).Error; err != nil {
+				return err
+			}
+
+			coin.CurrentPrice = update.CurrentPrice
+			coin.MarketCap = update.MarketCap
+			coin.Volume24h = update.Volume24h
+			coin.PriceChange24h = update.PriceChange24h
+			coin.PriceChangePercentage24h = update.PriceChangePercentage24h
+			coin.LastUpdated = now
+			coins = append(coins, coin)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateMovers()
+	events.Publish(events.Event{
+		Type:  events.PricesUpdated,
+		Title: "Prices updated",
+		Data:  coins,
+	})
+	return coins, nil
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// minRebalanceTrade skips orders too small to be worth placing, in BaseCurrency.
+const minRebalanceTrade = 1.0
+
+var (
+	ErrInvalidTargets        = errors.New("Target weights must be positive, unique per coin and sum to at most 100")
+	ErrInvalidDriftThreshold = errors.New("Drift threshold must be between 0 and 100")
+	ErrEmptyPortfolio        = errors.New("Portfolio has no value to rebalance")
+)
+
+// RebalancePosition is one coin's current and target share of a portfolio.
+// Weights and drift are in percent of total value.
+type RebalancePosition struct {
+	CoinID        uint    `json:"coin_id"`
+	Symbol        string  `json:"symbol"`
+	Quantity      float64 `json:"quantity"`
+	Price         float64 `json:"price"`
+	Value         float64 `json:"value"`
+	CurrentWeight float64 `json:"current_weight"`
+	TargetWeight  float64 `json:"target_weight"`
+	Drift         float64 `json:"drift"`
+}
+
+// RebalanceOrder is a trade needed to bring a position back to its target.
+type RebalanceOrder struct {
+	CoinID   uint    `json:"coin_id"`
+	Symbol   string  `json:"symbol"`
+	Type     string  `json:"type"`
+	Quantity float64 `json:"quantity"`
+	Price    float64 `json:"price"`
+	Amount   float64 `json:"amount"`
+}
+
+type RebalancePlan struct {
+	PortfolioID    uint                `json:"portfolio_id"`
+	TotalValue     float64             `json:"total_value"`
+	Cash           float64             `json:"cash"`
+	OtherCash      float64             `json:"other_cash"`
+	CashWeight     float64             `json:"cash_weight"`
+	TargetCash     float64             `json:"target_cash_weight"`
+	DriftThreshold float64             `json:"drift_threshold"`
+	MaxDrift       float64             `json:"max_drift"`
+	NeedsRebalance bool                `json:"needs_rebalance"`
+	Positions      []RebalancePosition `json:"positions"`
+	Orders         []RebalanceOrder    `json:"orders"`
+	DryRun         bool                `json:"dry_run"`
+	Trades         []models.Trade      `json:"trades,omitempty"`
+}
+
+// GetRebalanceSettings returns the portfolio's settings, or the defaults if
+// none have been saved yet.
+func GetRebalanceSettings(portfolio models.Portfolio) (*models.RebalanceSettings, error) {
+	settings := models.RebalanceSettings{
+		UserID:         portfolio.UserID,
+		PortfolioID:    portfolio.ID,
+		DriftThreshold: 5,
+		CronExpr:       "0 0 * * *",
+	}
+	err := database.DB.Where("portfolio_id = ?", portfolio.ID).First(&settings).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SetTargetAllocations replaces the portfolio's target weights and updates
+// its rebalance settings. A nil Targets slice leaves the weights untouched.
+func SetTargetAllocations(portfolio models.Portfolio, req models.TargetAllocationRequest) (*models.RebalanceSettings, error) {
+	if req.Targets != nil {
+		seen := make(map[uint]bool)
+		var sum float64
+		for _, target := range req.Targets {
+			if target.Weight <= 0 || seen[target.CoinID] {
+				return nil, ErrInvalidTargets
+			}
+			seen[target.CoinID] = true
+			sum += target.Weight
+		}
+		if sum > 100+1e-9 {
+			return nil, ErrInvalidTargets
+		}
+
+		var count int64
+		database.DB.Model(&models.Coin{}).Where("id IN ?", keys(seen)).Count(&count)
+		if int(count) != len(seen) {
+			return nil, ErrCoinNotFound
+		}
+	}
+
+	settings, err := GetRebalanceSettings(portfolio)
+	if err != nil {
+		return nil, err
+	}
+	if req.DriftThreshold != nil {
+		if *req.DriftThreshold < 0 || *req.DriftThreshold > 100 {
+			return nil, ErrInvalidDriftThreshold
+		}
+		settings.DriftThreshold = *req.DriftThreshold
+	}
+	if req.Cron != "" {
+		if _, err := nextRunAfter(req.Cron, time.Now()); err != nil {
+			return nil, err
+		}
+		settings.CronExpr = req.Cron
+	}
+	if req.AutoRebalance != nil {
+		settings.AutoRebalance = *req.AutoRebalance
+	}
+
+	settings.NextRunAt = nil
+	if settings.AutoRebalance {
+		nextRun, err := nextRunAfter(settings.CronExpr, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		settings.NextRunAt = &nextRun
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Targets != nil {
+			if err := tx.Where("portfolio_id = ?", portfolio.ID).Delete(&models.TargetAllocation{}).Error; err != nil {
+				return err
+			}
+			for _, target := range req.Targets {
+				if err := tx.Create(&models.TargetAllocation{
+					UserID:      portfolio.UserID,
+					PortfolioID: portfolio.ID,
+					CoinID:      target.CoinID,
+					Weight:      target.Weight,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Save(settings).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// PlanRebalance values the portfolio like GetUserStats does (quantity at
+// Coin.CurrentPrice plus cash in every currency, converted to BaseCurrency)
+// and works out the trades needed to reach the target weights. Trades only
+// move BaseCurrency cash, so cash in other currencies is reported as
+// OtherCash, a fixed slice left out of the weights. No orders are planned
+// while the largest drift is below threshold.
+func PlanRebalance(portfolio models.Portfolio, threshold float64) (*RebalancePlan, error) {
+	var current models.Portfolio
+	if err := database.DB.First(&current, portfolio.ID).Error; err != nil {
+		return nil, ErrPortfolioNotFound
+	}
+
+	holdings, err := Holdings(database.DB, portfolio.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []models.TargetAllocation
+	if err := database.DB.Preload("Coin").Where("portfolio_id = ?", portfolio.ID).Find(&targets).Error; err != nil {
+		return nil, err
+	}
+
+	balances, err := CashBalances(current)
+	if err != nil {
+		return nil, err
+	}
+	allCash, err := TotalCash(balances, models.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+	cash := current.Balance
+	otherCash := allCash - cash
+
+	// Weights are of what rebalancing can trade: coins and BaseCurrency cash
+	positions := make(map[uint]*RebalancePosition)
+	total := cash
+	for _, holding := range holdings {
+		value := holding.Quantity * holding.Coin.CurrentPrice
+		total += value
+		positions[holding.CoinID] = &RebalancePosition{
+			CoinID:   holding.CoinID,
+			Symbol:   holding.Coin.Symbol,
+			Quantity: holding.Quantity,
+			Price:    holding.Coin.CurrentPrice,
+			Value:    value,
+		}
+	}
+
+	targetCash := 100.0
+	for _, target := range targets {
+		position, ok := positions[target.CoinID]
+		if !ok {
+			position = &RebalancePosition{
+				CoinID: target.CoinID,
+				Symbol: target.Coin.Symbol,
+				Price:  target.Coin.CurrentPrice,
+			}
+			positions[target.CoinID] = position
+		}
+		position.TargetWeight = target.Weight
+		targetCash -= target.Weight
+	}
+
+	if total <= 0 {
+		return nil, ErrEmptyPortfolio
+	}
+
+	plan := &RebalancePlan{
+		PortfolioID:    portfolio.ID,
+		TotalValue:     total + otherCash,
+		Cash:           cash,
+		OtherCash:      otherCash,
+		CashWeight:     cash / total * 100,
+		TargetCash:     targetCash,
+		DriftThreshold: threshold,
+		DryRun:         true,
+	}
+
+	for _, position := range positions {
+		position.CurrentWeight = position.Value / total * 100
+		position.Drift = position.CurrentWeight - position.TargetWeight
+		plan.MaxDrift = math.Max(plan.MaxDrift, math.Abs(position.Drift))
+		plan.Positions = append(plan.Positions, *position)
+	}
+	sort.Slice(plan.Positions, func(i, j int) bool {
+		return plan.Positions[i].TargetWeight > plan.Positions[j].TargetWeight
+	})
+
+	plan.NeedsRebalance = len(plan.Positions) > 0 && plan.MaxDrift >= threshold
+	if !plan.NeedsRebalance {
+		return plan, nil
+	}
+
+	for _, position := range plan.Positions {
+		diff := position.TargetWeight/100*total - position.Value
+		if math.Abs(diff) < minRebalanceTrade || position.Price <= 0 {
+			continue
+		}
+
+		order := RebalanceOrder{
+			CoinID: position.CoinID,
+			Symbol: position.Symbol,
+			Type:   "buy",
+			Price:  position.Price,
+			Amount: math.Abs(diff),
+		}
+		if diff < 0 {
+			order.Type = "sell"
+		}
+		order.Quantity = order.Amount / order.Price
+		if order.Type == "sell" {
+			order.Quantity = math.Min(order.Quantity, position.Quantity)
+			// Selling out of a position should not leave dust behind
+			if position.TargetWeight == 0 {
+				order.Quantity = position.Quantity
+			}
+		}
+		plan.Orders = append(plan.Orders, order)
+	}
+
+	// Sells first so their proceeds fund the buys
+	sort.SliceStable(plan.Orders, func(i, j int) bool {
+		return plan.Orders[i].Type == "sell" && plan.Orders[j].Type == "buy"
+	})
+	return plan, nil
+}
+
+// ExecuteRebalance places the plan's orders through ExecuteTrade. Buys are
+// capped to the cash actually available, since prices can move between
+// planning and execution.
+func ExecuteRebalance(portfolio models.Portfolio, plan *RebalancePlan) error {
+	plan.DryRun = false
+
+	for _, order := range plan.Orders {
+		quantity := order.Quantity
+		if order.Type == "buy" {
+			var current models.Portfolio
+			if err := database.DB.Select("id", "balance").First(&current, portfolio.ID).Error; err != nil {
+				return err
+			}
+			quantity = math.Min(quantity, current.Balance/order.Price)
+			if quantity*order.Price < minRebalanceTrade {
+				continue
+			}
+		}
+
+		trade, err := ExecuteTrade(portfolio, models.TradeRequest{
+			PortfolioID: portfolio.ID,
+			CoinID:      order.CoinID,
+			Type:        order.Type,
+			Quantity:    quantity,
+			Price:       order.Price,
+		})
+		if err != nil {
+			return err
+		}
+		plan.Trades = append(plan.Trades, *trade)
+	}
+	return nil
+}
+
+// Rebalance plans and, unless dryRun, executes a rebalance, recording the run.
+func Rebalance(portfolio models.Portfolio, threshold float64, dryRun bool, trigger string) (*RebalancePlan, error) {
+	run := models.RebalanceRun{
+		UserID:      portfolio.UserID,
+		PortfolioID: portfolio.ID,
+		Trigger:     trigger,
+		DryRun:      dryRun,
+	}
+	defer func() {
+		if err := database.DB.Create(&run).Error; err != nil {
+			log.Printf("Failed to record rebalance of portfolio %d: %v", portfolio.ID, err)
+		}
+	}()
+
+	plan, err := PlanRebalance(portfolio, threshold)
+	if err != nil {
+		run.Status = models.RebalanceRunFailed
+		run.Error = err.Error()
+		return nil, err
+	}
+	run.MaxDrift = plan.MaxDrift
+
+	switch {
+	case !plan.NeedsRebalance:
+		run.Status = models.RebalanceRunSkipped
+	case dryRun:
+		run.Status = models.RebalanceRunPlanned
+	default:
+		err = ExecuteRebalance(portfolio, plan)
+		run.TradeCount = len(plan.Trades)
+		run.Status = models.RebalanceRunExecuted
+		if err != nil {
+			run.Status = models.RebalanceRunFailed
+			run.Error = err.Error()
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// RunScheduledRebalances rebalances portfolios with automatic rebalancing
+// whose schedule is due, claiming them the same way recurring orders are.
+func RunScheduledRebalances() error {
+	var claimed []models.RebalanceSettings
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("auto_rebalance = ? AND next_run_at <= ?", true, time.Now()).
+			Limit(20).
+			Find(&claimed).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, settings := range claimed {
+			nextRun, err := nextRunAfter(settings.CronExpr, now)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&settings).Updates(map[string]interface{}{
+				"next_run_at": nextRun,
+				"last_run_at": now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, settings := range claimed {
+		portfolio, err := ActivePortfolio(settings.UserID, settings.PortfolioID)
+		if err != nil {
+			continue
+		}
+		if _, err := Rebalance(*portfolio, settings.DriftThreshold, false, models.RebalanceTriggerScheduled); err != nil {
+			log.Printf("Scheduled rebalance of portfolio %d failed: %v", portfolio.ID, err)
+		}
+	}
+	return nil
+}
+
+func keys(set map[uint]bool) []uint {
+	ids := make([]uint, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"crypto-app-api/utils"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxRecurringFailures is how many consecutive failed runs pause an order.
+const maxRecurringFailures = 5
+
+var (
+	ErrRecurringOrderNotFound = errors.New("Recurring order not found")
+	ErrInvalidSchedule        = errors.New("Invalid schedule")
+	ErrRecurringOrderState    = errors.New("Recurring order cannot be changed in its current state")
+)
+
+// CronExprFor turns a recurring order request into the cron expression it is
+// stored and scheduled as.
+func CronExprFor(req models.RecurringOrderRequest) (string, error) {
+	if req.Hour < 0 || req.Hour > 23 || req.Minute < 0 || req.Minute > 59 {
+		return "", ErrInvalidSchedule
+	}
+
+	var expr string
+	switch req.Schedule {
+	case models.ScheduleDaily:
+		expr = fmt.Sprintf("%d %d * * *", req.Minute, req.Hour)
+	case models.ScheduleWeekly:
+		if req.Weekday < 0 || req.Weekday > 6 {
+			return "", ErrInvalidSchedule
+		}
+		expr = fmt.Sprintf("%d %d * * %d", req.Minute, req.Hour, req.Weekday)
+	case models.ScheduleMonthly:
+		// Capped at 28 so every month has a run
+		if req.DayOfMonth < 1 || req.DayOfMonth > 28 {
+			return "", ErrInvalidSchedule
+		}
+		expr = fmt.Sprintf("%d %d %d * *", req.Minute, req.Hour, req.DayOfMonth)
+	case models.ScheduleCron:
+		expr = req.Cron
+	default:
+		return "", ErrInvalidSchedule
+	}
+
+	if _, err := utils.ParseCron(expr); err != nil {
+		return "", ErrInvalidSchedule
+	}
+	return expr, nil
+}
+
+// nextRunAfter returns the order's next run time after t, in UTC.
+func nextRunAfter(cronExpr string, t time.Time) (time.Time, error) {
+	schedule, err := utils.ParseCron(cronExpr)
+	if err != nil {
+		return time.Time{}, ErrInvalidSchedule
+	}
+	next := schedule.Next(t.UTC())
+	if next.IsZero() {
+		return time.Time{}, ErrInvalidSchedule
+	}
+	return next, nil
+}
+
+func CreateRecurringOrder(portfolio models.Portfolio, req models.RecurringOrderRequest) (*models.RecurringOrder, error) {
+	if req.Type == "" {
+		req.Type = "buy"
+	}
+	if req.Type != "buy" && req.Type != "sell" {
+		return nil, ErrInvalidTradeType
+	}
+	if req.Amount <= 0 {
+		return nil, ErrInvalidTradeAmount
+	}
+
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+
+	cronExpr, err := CronExprFor(req)
+	if err != nil {
+		return nil, err
+	}
+	nextRun, err := nextRunAfter(cronExpr, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	order := models.RecurringOrder{
+		UserID:      portfolio.UserID,
+		PortfolioID: portfolio.ID,
+		CoinID:      coin.ID,
+		Type:        req.Type,
+		Amount:      req.Amount,
+		Schedule:    req.Schedule,
+		CronExpr:    cronExpr,
+		Status:      models.RecurringStatusActive,
+		NextRunAt:   nextRun,
+	}
+	if err := database.DB.Create(&order).Error; err != nil {
+		return nil, err
+	}
+
+	order.Coin = coin
+	return &order, nil
+}
+
+// SetRecurringOrderStatus pauses, resumes or cancels an order. Resuming
+// schedules the next run from now rather than replaying missed ones, and
+// cancelled orders cannot be changed again.
+func SetRecurringOrderStatus(userID, orderID uint, status string) (*models.RecurringOrder, error) {
+	var order models.RecurringOrder
+	if err := database.DB.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+		return nil, ErrRecurringOrderNotFound
+	}
+
+	if order.Status == models.RecurringStatusCancelled || order.Status == status {
+		return nil, ErrRecurringOrderState
+	}
+
+	updates := map[string]interface{}{"status": status}
+	if status == models.RecurringStatusActive {
+		nextRun, err := nextRunAfter(order.CronExpr, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		updates["next_run_at"] = nextRun
+		updates["failure_count"] = 0
+	}
+
+	result := database.DB.Model(&order).Where("status = ?", order.Status).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// Lost to a concurrent change of status, such as a run pausing it
+	if result.RowsAffected == 0 {
+		return nil, ErrRecurringOrderState
+	}
+
+	database.DB.Preload("Coin").First(&order, order.ID)
+	return &order, nil
+}
+
+// ExecuteDueRecurringOrders runs every active order whose next run is due.
+// Orders are claimed by advancing next_run_at under a SKIP LOCKED row lock
+// before executing, so each run happens at most once even with several API
+// replicas polling at the same time.
+func ExecuteDueRecurringOrders() error {
+	var claimed []models.RecurringOrder
+	scheduledAt := make(map[uint]time.Time)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_run_at <= ?", models.RecurringStatusActive, time.Now()).
+			Order("next_run_at asc").
+			Limit(50).
+			Find(&claimed).Error; err != nil {
+			return err
+		}
+
+		for _, order := range claimed {
+			scheduledAt[order.ID] = order.NextRunAt
+			nextRun, err := nextRunAfter(order.CronExpr, time.Now())
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&order).Update("next_run_at", nextRun).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, order := range claimed {
+		runRecurringOrder(order, scheduledAt[order.ID])
+	}
+	return nil
+}
+
+func runRecurringOrder(order models.RecurringOrder, scheduledAt time.Time) {
+	run := models.RecurringOrderRun{
+		RecurringOrderID: order.ID,
+		Status:           models.RecurringRunSucceeded,
+		ScheduledAt:      scheduledAt,
+	}
+
+	trade, err := executeRecurringOrder(order)
+	if err != nil {
+		run.Status = models.RecurringRunFailed
+		run.Error = err.Error()
+	} else {
+		run.TradeID = &trade.ID
+	}
+
+	if err := database.DB.Create(&run).Error; err != nil {
+		log.Printf("Failed to record run of recurring order %d: %v", order.ID, err)
+	}
+
+	updates := map[string]interface{}{"last_run_at": time.Now()}
+	if run.Status == models.RecurringRunFailed {
+		updates["failure_count"] = order.FailureCount + 1
+		if order.FailureCount+1 >= maxRecurringFailures {
+			updates["status"] = models.RecurringStatusPaused
+		}
+	} else {
+		updates["failure_count"] = 0
+	}
+	// Only while still active, so a pause or cancel made during the run
+	// stands and does not count the run against the order
+	if err := database.DB.Model(&order).
+		Where("status = ?", models.RecurringStatusActive).
+		Updates(updates).Error; err != nil {
+		log.Printf("Failed to update recurring order %d: %v", order.ID, err)
+	}
+}
+
+func executeRecurringOrder(order models.RecurringOrder) (*models.Trade, error) {
+	portfolio, err := ActivePortfolio(order.UserID, order.PortfolioID)
+	if err != nil {
+		return nil, err
+	}
+	return ExecuteMarketOrder(*portfolio, order.CoinID, order.Type, order.Amount)
+}
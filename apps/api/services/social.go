@@ -0,0 +1,609 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxBioLength caps profile bios.
+	maxBioLength = 500
+
+	// recentTradesShown is how many trades a public profile lists.
+	recentTradesShown = 20
+)
+
+var (
+	ErrTraderNotFound        = errors.New("Trader not found")
+	ErrCopyTradingNotFound   = errors.New("Copy trading not found")
+	ErrInvalidBio            = errors.New("Bio must be at most 500 characters")
+	ErrInvalidLeader         = errors.New("You cannot follow or copy yourself")
+	ErrCopyingNotAllowed     = errors.New("This trader does not allow copying")
+	ErrInvalidCopyLimits     = errors.New("Allocation must be positive and the max trade amount cannot be negative")
+	ErrDuplicateCopyTrading  = errors.New("You are already copying this trader")
+	errLeaderStoppedSharing  = errors.New("The trader no longer allows copying")
+	errCopyAmountTooSmall    = errors.New("Copied amount was too small to trade")
+	errNothingToCopySellFrom = errors.New("Nothing is held to copy the sell from")
+)
+
+// TraderProfile is what other users see of a public profile. Performance
+// and RecentTrades are left out when the trader hides them.
+type TraderProfile struct {
+	Username     string             `json:"username"`
+	Bio          string             `json:"bio"`
+	JoinedAt     time.Time          `json:"joined_at"`
+	Followers    int64              `json:"followers"`
+	Following    int64              `json:"following"`
+	IsFollowing  bool               `json:"is_following"`
+	AllowCopying bool               `json:"allow_copying"`
+	Performance  *PublicPerformance `json:"performance,omitempty"`
+	RecentTrades []PublicTrade      `json:"recent_trades,omitempty"`
+}
+
+// PublicPerformance is a trader's performance in percentages only, so it
+// does not reveal the size of their account.
+type PublicPerformance struct {
+	Range              string                   `json:"range"`
+	TimeWeightedReturn float64                  `json:"time_weighted_return"`
+	MaxDrawdown        float64                  `json:"max_drawdown"`
+	Volatility         float64                  `json:"volatility"`
+	SharpeRatio        float64                  `json:"sharpe_ratio"`
+	Points             []PublicPerformancePoint `json:"points"`
+}
+
+type PublicPerformancePoint struct {
+	Time             time.Time `json:"time"`
+	CumulativeReturn float64   `json:"cumulative_return"`
+}
+
+// PublicTrade is a trade as shown on profiles and in the feed. Quantity and
+// TotalAmount are only set when the trader shows amounts.
+type PublicTrade struct {
+	ID          uint        `json:"id"`
+	Username    string      `json:"username"`
+	Coin        models.Coin `json:"coin"`
+	Type        string      `json:"type"`
+	Price       float64     `json:"price"`
+	Quantity    *float64    `json:"quantity,omitempty"`
+	TotalAmount *float64    `json:"total_amount,omitempty"`
+	Copied      bool        `json:"copied"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// TraderSummary is a row in a following or followers list.
+type TraderSummary struct {
+	Username   string    `json:"username"`
+	Public     bool      `json:"public"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// CopyTradingStatus is a copy trading with the leader's username.
+type CopyTradingStatus struct {
+	models.CopyTrading
+	Leader string `json:"leader"`
+}
+
+// GetProfile returns the user's profile settings.
+func GetProfile(userID uint) (*models.Profile, error) {
+	profile := models.DefaultProfile(userID)
+	if err := database.DB.Where("user_id = ?", userID).Limit(1).Find(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func UpdateProfile(userID uint, req models.ProfileRequest) (*models.Profile, error) {
+	profile, err := GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if len(bio) > maxBioLength {
+			return nil, ErrInvalidBio
+		}
+		profile.Bio = bio
+	}
+	if req.Public != nil {
+		profile.Public = *req.Public
+	}
+	if req.ShowPerformance != nil {
+		profile.ShowPerformance = *req.ShowPerformance
+	}
+	if req.ShowTrades != nil {
+		profile.ShowTrades = *req.ShowTrades
+	}
+	if req.ShowAmounts != nil {
+		profile.ShowAmounts = *req.ShowAmounts
+	}
+	if req.AllowCopying != nil {
+		profile.AllowCopying = *req.AllowCopying
+	}
+
+	if err := database.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(profile).Error; err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// publicTrader looks up a trader by username. Private profiles are only
+// visible to their owner; to everyone else they do not exist.
+func publicTrader(viewerID uint, username string) (*models.User, *models.Profile, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrTraderNotFound
+		}
+		return nil, nil, err
+	}
+	profile, err := GetProfile(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !profile.Public && user.ID != viewerID {
+		return nil, nil, ErrTraderNotFound
+	}
+	return &user, profile, nil
+}
+
+// GetTraderProfile returns a public profile, with performance over the
+// range when the trader shows it.
+func GetTraderProfile(viewerID uint, username, rangeName string) (*TraderProfile, error) {
+	if _, ok := performanceRanges[rangeName]; !ok {
+		return nil, ErrInvalidPerformanceRange
+	}
+	user, profile, err := publicTrader(viewerID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	trader := &TraderProfile{
+		Username:     user.Username,
+		Bio:          profile.Bio,
+		JoinedAt:     user.CreatedAt,
+		AllowCopying: profile.AllowCopying,
+	}
+	if err := database.DB.Model(&models.Follow{}).Where("leader_id = ?", user.ID).Count(&trader.Followers).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(&models.Follow{}).Where("follower_id = ?", user.ID).Count(&trader.Following).Error; err != nil {
+		return nil, err
+	}
+	var following int64
+	if err := database.DB.Model(&models.Follow{}).
+		Where("follower_id = ? AND leader_id = ?", viewerID, user.ID).
+		Count(&following).Error; err != nil {
+		return nil, err
+	}
+	trader.IsFollowing = following > 0
+
+	if profile.ShowPerformance {
+		performance, err := UserPerformance(user.ID, rangeName, 0)
+		if err != nil {
+			return nil, err
+		}
+		trader.Performance = publicPerformance(performance)
+	}
+
+	if profile.ShowTrades {
+		var trades []models.Trade
+		if err := database.DB.Preload("Coin").Preload("User").
+			Where("user_id = ? AND reset_id IS NULL", user.ID).
+			Order("created_at desc, id desc").
+			Limit(recentTradesShown).
+			Find(&trades).Error; err != nil {
+			return nil, err
+		}
+		if trader.RecentTrades, err = PublicTrades(trades); err != nil {
+			return nil, err
+		}
+	}
+	return trader, nil
+}
+
+func publicPerformance(performance *Performance) *PublicPerformance {
+	public := &PublicPerformance{
+		Range:              performance.Range,
+		TimeWeightedReturn: performance.TimeWeightedReturn,
+		MaxDrawdown:        performance.MaxDrawdown,
+		Volatility:         performance.Volatility,
+		SharpeRatio:        performance.SharpeRatio,
+		Points:             make([]PublicPerformancePoint, len(performance.Points)),
+	}
+	for i, point := range performance.Points {
+		public.Points[i] = PublicPerformancePoint{Time: point.Time, CumulativeReturn: point.CumulativeReturn}
+	}
+	return public
+}
+
+// PublicTrades converts trades, loaded with their User and Coin, for
+// display, hiding amounts of traders who do not show them.
+func PublicTrades(trades []models.Trade) ([]PublicTrade, error) {
+	userIDs := make([]uint, 0, len(trades))
+	for _, trade := range trades {
+		userIDs = append(userIDs, trade.UserID)
+	}
+	var profiles []models.Profile
+	if err := database.DB.Where("user_id IN ?", uniqueIDs(userIDs)).Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	showAmounts := make(map[uint]bool, len(profiles))
+	for _, profile := range profiles {
+		showAmounts[profile.UserID] = profile.ShowAmounts
+	}
+
+	public := make([]PublicTrade, len(trades))
+	for i, trade := range trades {
+		public[i] = PublicTrade{
+			ID:        trade.ID,
+			Username:  trade.User.Username,
+			Coin:      trade.Coin,
+			Type:      trade.Type,
+			Price:     trade.Price,
+			Copied:    trade.CopiedFrom != nil,
+			CreatedAt: trade.CreatedAt,
+		}
+		if showAmounts[trade.UserID] {
+			quantity, total := trade.Quantity, trade.TotalAmount
+			public[i].Quantity = &quantity
+			public[i].TotalAmount = &total
+		}
+	}
+	return public, nil
+}
+
+// FeedScope selects the trades of the public traders the user follows that
+// show their trades.
+func FeedScope(userID uint) *gorm.DB {
+	return database.DB.Model(&models.Trade{}).
+		Where("trades.reset_id IS NULL").
+		Where("trades.user_id IN (?)", database.DB.Model(&models.Follow{}).Select("leader_id").Where("follower_id = ?", userID)).
+		Where("trades.user_id IN (?)", database.DB.Model(&models.Profile{}).Select("user_id").Where("public AND show_trades"))
+}
+
+func FollowTrader(userID uint, username string) error {
+	leader, _, err := publicTrader(userID, username)
+	if err != nil {
+		return err
+	}
+	if leader.ID == userID {
+		return ErrInvalidLeader
+	}
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.Follow{FollowerID: userID, LeaderID: leader.ID}).Error
+}
+
+// UnfollowTrader stops following a trader, even one whose profile has since
+// gone private.
+func UnfollowTrader(userID uint, username string) error {
+	var leader models.User
+	if err := database.DB.Where("username = ?", username).First(&leader).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTraderNotFound
+		}
+		return err
+	}
+	return database.DB.Where("follower_id = ? AND leader_id = ?", userID, leader.ID).Delete(&models.Follow{}).Error
+}
+
+// ListFollowing lists the traders the user follows, most recent first.
+func ListFollowing(userID uint) ([]TraderSummary, error) {
+	var follows []models.Follow
+	if err := database.DB.Preload("Leader").
+		Where("follower_id = ?", userID).
+		Order("created_at desc").
+		Find(&follows).Error; err != nil {
+		return nil, err
+	}
+
+	leaderIDs := make([]uint, len(follows))
+	for i, follow := range follows {
+		leaderIDs[i] = follow.LeaderID
+	}
+	var public []uint
+	if err := database.DB.Model(&models.Profile{}).
+		Where("user_id IN ? AND public", leaderIDs).
+		Pluck("user_id", &public).Error; err != nil {
+		return nil, err
+	}
+	isPublic := make(map[uint]bool, len(public))
+	for _, id := range public {
+		isPublic[id] = true
+	}
+
+	summaries := make([]TraderSummary, len(follows))
+	for i, follow := range follows {
+		summaries[i] = TraderSummary{
+			Username:   follow.Leader.Username,
+			Public:     isPublic[follow.LeaderID],
+			FollowedAt: follow.CreatedAt,
+		}
+	}
+	return summaries, nil
+}
+
+// ListFollowers lists the users following the user, most recent first.
+// Followers with private profiles are counted but not named.
+func ListFollowers(userID uint) ([]TraderSummary, int64, error) {
+	var follows []models.Follow
+	if err := database.DB.Preload("Follower").
+		Where("leader_id = ? AND follower_id IN (?)", userID,
+			database.DB.Model(&models.Profile{}).Select("user_id").Where("public")).
+		Order("created_at desc").
+		Find(&follows).Error; err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := database.DB.Model(&models.Follow{}).Where("leader_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	summaries := make([]TraderSummary, len(follows))
+	for i, follow := range follows {
+		summaries[i] = TraderSummary{
+			Username:   follow.Follower.Username,
+			Public:     true,
+			FollowedAt: follow.CreatedAt,
+		}
+	}
+	return summaries, total, nil
+}
+
+func ListCopyTradings(userID uint) ([]CopyTradingStatus, error) {
+	var copies []models.CopyTrading
+	if err := database.DB.Preload("Leader").
+		Where("follower_id = ?", userID).
+		Order("created_at asc").
+		Find(&copies).Error; err != nil {
+		return nil, err
+	}
+
+	statuses := make([]CopyTradingStatus, len(copies))
+	for i, copying := range copies {
+		statuses[i] = CopyTradingStatus{CopyTrading: copying, Leader: copying.Leader.Username}
+	}
+	return statuses, nil
+}
+
+func resolveCopyTrading(userID, id uint) (*models.CopyTrading, error) {
+	var copying models.CopyTrading
+	if err := database.DB.Preload("Leader").Where("id = ? AND follower_id = ?", id, userID).First(&copying).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyTradingNotFound
+		}
+		return nil, err
+	}
+	return &copying, nil
+}
+
+// copyPortfolio is the active, non-contest portfolio of the user's to copy
+// trades into.
+func copyPortfolio(userID, portfolioID uint) (*models.Portfolio, error) {
+	portfolio, err := ActivePortfolio(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio.IsContest() {
+		return nil, ErrContestPortfolio
+	}
+	return portfolio, nil
+}
+
+// CreateCopyTrading starts copying a public trader who allows it.
+func CreateCopyTrading(userID uint, req models.CopyTradingRequest) (*CopyTradingStatus, error) {
+	leader, profile, err := publicTrader(userID, req.Leader)
+	if err != nil {
+		return nil, err
+	}
+	if leader.ID == userID {
+		return nil, ErrInvalidLeader
+	}
+	if !profile.AllowCopying {
+		return nil, ErrCopyingNotAllowed
+	}
+	if req.Allocation <= 0 || req.MaxTradeAmount < 0 {
+		return nil, ErrInvalidCopyLimits
+	}
+	portfolio, err := copyPortfolio(userID, req.PortfolioID)
+	if err != nil {
+		return nil, err
+	}
+
+	copying := models.CopyTrading{
+		FollowerID:     userID,
+		LeaderID:       leader.ID,
+		PortfolioID:    portfolio.ID,
+		Allocation:     req.Allocation,
+		MaxTradeAmount: req.MaxTradeAmount,
+		Active:         req.Active == nil || *req.Active,
+	}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&copying)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDuplicateCopyTrading
+	}
+	return &CopyTradingStatus{CopyTrading: copying, Leader: leader.Username}, nil
+}
+
+// UpdateCopyTrading changes the portfolio, limits or active state of a copy
+// trading. The leader cannot be changed.
+func UpdateCopyTrading(userID, id uint, req models.CopyTradingRequest) (*CopyTradingStatus, error) {
+	copying, err := resolveCopyTrading(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Allocation <= 0 || req.MaxTradeAmount < 0 {
+		return nil, ErrInvalidCopyLimits
+	}
+
+	updates := map[string]interface{}{
+		"allocation":       req.Allocation,
+		"max_trade_amount": req.MaxTradeAmount,
+	}
+	if req.PortfolioID != 0 {
+		portfolio, err := copyPortfolio(userID, req.PortfolioID)
+		if err != nil {
+			return nil, err
+		}
+		updates["portfolio_id"] = portfolio.ID
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+		if *req.Active {
+			updates["last_error"] = ""
+		}
+	}
+	if err := database.DB.Model(copying).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if copying, err = resolveCopyTrading(userID, id); err != nil {
+		return nil, err
+	}
+	return &CopyTradingStatus{CopyTrading: *copying, Leader: copying.Leader.Username}, nil
+}
+
+func DeleteCopyTrading(userID, id uint) error {
+	copying, err := resolveCopyTrading(userID, id)
+	if err != nil {
+		return err
+	}
+	return database.DB.Delete(copying).Error
+}
+
+// SubscribeCopyTrading mirrors executed trades to their traders' copiers.
+// Trades that are themselves copies are not copied again, so copy trading
+// never cascades or loops, and contest portfolios are left out since they
+// are isolated from the rest of the account.
+func SubscribeCopyTrading() {
+	events.Subscribe(func(event events.Event) {
+		trade, ok := event.Data.(models.Trade)
+		if !ok || trade.CopiedFrom != nil {
+			return
+		}
+
+		var copies []models.CopyTrading
+		if err := database.DB.Where("leader_id = ? AND active", trade.UserID).Find(&copies).Error; err != nil {
+			log.Printf("Failed to load copy tradings of user %d: %v", trade.UserID, err)
+			return
+		}
+		if len(copies) == 0 {
+			return
+		}
+
+		var portfolio models.Portfolio
+		if err := database.DB.First(&portfolio, trade.PortfolioID).Error; err != nil || portfolio.IsContest() {
+			return
+		}
+		profile, err := GetProfile(trade.UserID)
+		if err != nil {
+			log.Printf("Failed to load profile of user %d: %v", trade.UserID, err)
+			return
+		}
+
+		for _, copying := range copies {
+			if !profile.Public || !profile.AllowCopying {
+				recordCopyResult(copying, errLeaderStoppedSharing)
+				continue
+			}
+			recordCopyResult(copying, copyTrade(copying, trade, portfolio))
+		}
+	}, events.TradeExecuted)
+}
+
+// copyTrade mirrors the leader's trade at the coin's current price. Buys
+// spend the leader's amount scaled by the allocation over the value of the
+// leader's portfolio, capped by MaxTradeAmount and the follower's cash;
+// sells sell the same fraction of the follower's holding as the leader sold
+// of theirs.
+func copyTrade(copying models.CopyTrading, trade models.Trade, leaderPortfolio models.Portfolio) error {
+	portfolio, err := copyPortfolio(copying.FollowerID, copying.PortfolioID)
+	if err != nil {
+		return err
+	}
+	var coin models.Coin
+	if err := database.DB.First(&coin, trade.CoinID).Error; err != nil {
+		return ErrCoinNotFound
+	}
+	if coin.CurrentPrice <= 0 {
+		return ErrInvalidTradeAmount
+	}
+
+	req := models.TradeRequest{
+		PortfolioID: portfolio.ID,
+		CoinID:      coin.ID,
+		Type:        trade.Type,
+		Price:       coin.CurrentPrice,
+		CopiedFrom:  &trade.ID,
+	}
+	if trade.Type == "buy" {
+		leaderValue, err := portfolioValue(database.DB, leaderPortfolio)
+		if err != nil {
+			return err
+		}
+		if leaderValue <= 0 {
+			return errCopyAmountTooSmall
+		}
+		amount := math.Min(trade.TotalAmount*copying.Allocation/leaderValue, portfolio.Balance)
+		if copying.MaxTradeAmount > 0 {
+			amount = math.Min(amount, copying.MaxTradeAmount)
+		}
+		if amount < 0.01 {
+			return errCopyAmountTooSmall
+		}
+		req.Quantity = amount / coin.CurrentPrice
+	} else {
+		var leaderHolding, holding models.UserCoin
+		if err := database.DB.Where("portfolio_id = ? AND coin_id = ?", trade.PortfolioID, coin.ID).
+			Limit(1).
+			Find(&leaderHolding).Error; err != nil {
+			return err
+		}
+		if err := database.DB.Where("portfolio_id = ? AND coin_id = ?", portfolio.ID, coin.ID).
+			Limit(1).
+			Find(&holding).Error; err != nil {
+			return err
+		}
+		if holding.Quantity <= 0 {
+			return errNothingToCopySellFrom
+		}
+		fraction := trade.Quantity / (leaderHolding.Quantity + trade.Quantity)
+		req.Quantity = holding.Quantity
+		if fraction < 1-lotEpsilon {
+			req.Quantity = holding.Quantity * fraction
+		}
+	}
+
+	_, err = ExecuteTrade(*portfolio, req)
+	return err
+}
+
+// recordCopyResult notes the outcome of copying a trade. The copy is
+// deactivated when it can no longer work until the follower changes it.
+func recordCopyResult(copying models.CopyTrading, err error) {
+	updates := map[string]interface{}{"last_error": ""}
+	if err == nil {
+		updates["last_copied_at"] = time.Now()
+	} else {
+		updates["last_error"] = err.Error()
+		if errors.Is(err, errLeaderStoppedSharing) || errors.Is(err, ErrPortfolioArchived) ||
+			errors.Is(err, ErrPortfolioNotFound) || errors.Is(err, ErrContestPortfolio) {
+			updates["active"] = false
+		}
+	}
+	if err := database.DB.Model(&copying).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record copy trading %d: %v", copying.ID, err)
+	}
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lotEpsilon absorbs floating point drift between lots and holdings.
+const lotEpsilon = 1e-9
+
+var (
+	ErrInvalidLotMethod    = errors.New("Tax lot method must be one of fifo, lifo, hifo or specific_id")
+	ErrInvalidLotSelection = errors.New("Selected lots must be open lots of the coin in this portfolio covering exactly the quantity sold")
+	ErrInvalidTaxYear      = errors.New("Invalid tax year")
+)
+
+// lotOrders is the order each method consumes lots in. Specific
+// identification falls back to FIFO for sells that do not pick lots, such as
+// automated ones.
+var lotOrders = map[string]string{
+	models.LotMethodFIFO:       "acquired_at asc, id asc",
+	models.LotMethodLIFO:       "acquired_at desc, id desc",
+	models.LotMethodHIFO:       "cost_basis desc, acquired_at asc, id asc",
+	models.LotMethodSpecificID: "acquired_at asc, id asc",
+}
+
+func IsValidLotMethod(method string) bool {
+	_, ok := lotOrders[method]
+	return ok
+}
+
+// consumedLot is a quantity taken out of one lot.
+type consumedLot struct {
+	Lot      models.TaxLot
+	Quantity float64
+}
+
+// openLot records coins acquired into the portfolio as a new lot.
+func openLot(tx *gorm.DB, portfolio models.Portfolio, coinID uint, quantity, costBasis float64, source string, tradeID *uint, acquiredAt time.Time) error {
+	return tx.Create(&models.TaxLot{
+		UserID:      portfolio.UserID,
+		PortfolioID: portfolio.ID,
+		CoinID:      coinID,
+		Source:      source,
+		TradeID:     tradeID,
+		Quantity:    quantity,
+		Remaining:   quantity,
+		CostBasis:   costBasis,
+		AcquiredAt:  acquiredAt,
+	}).Error
+}
+
+// consumeLots takes quantity of a coin out of the portfolio's open lots,
+// using the selected lots when given and the user's lot method otherwise.
+// Holdings are authoritative, so a shortfall in lots left by rounding is
+// ignored rather than blocking the trade.
+func consumeLots(tx *gorm.DB, portfolio models.Portfolio, coinID uint, quantity float64, selections []models.LotSelection) ([]consumedLot, error) {
+	if len(selections) > 0 {
+		return consumeSelectedLots(tx, portfolio, coinID, quantity, selections)
+	}
+
+	var user models.User
+	if err := tx.Select("tax_lot_method").First(&user, portfolio.UserID).Error; err != nil {
+		return nil, err
+	}
+	order, ok := lotOrders[user.TaxLotMethod]
+	if !ok {
+		order = lotOrders[models.LotMethodFIFO]
+	}
+
+	var lots []models.TaxLot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("portfolio_id = ? AND coin_id = ? AND remaining > 0", portfolio.ID, coinID).
+		Order(order).
+		Find(&lots).Error; err != nil {
+		return nil, err
+	}
+
+	var consumed []consumedLot
+	left := quantity
+	for _, lot := range lots {
+		if left <= lotEpsilon {
+			break
+		}
+		take := math.Min(lot.Remaining, left)
+		if err := reduceLot(tx, lot, take); err != nil {
+			return nil, err
+		}
+		consumed = append(consumed, consumedLot{Lot: lot, Quantity: take})
+		left -= take
+	}
+	return consumed, nil
+}
+
+func consumeSelectedLots(tx *gorm.DB, portfolio models.Portfolio, coinID uint, quantity float64, selections []models.LotSelection) ([]consumedLot, error) {
+	var consumed []consumedLot
+	var total float64
+	seen := make(map[uint]bool)
+	for _, selection := range selections {
+		if selection.Quantity <= 0 || seen[selection.LotID] {
+			return nil, ErrInvalidLotSelection
+		}
+		seen[selection.LotID] = true
+
+		var lot models.TaxLot
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND portfolio_id = ? AND coin_id = ?", selection.LotID, portfolio.ID, coinID).
+			First(&lot).Error; err != nil {
+			return nil, ErrInvalidLotSelection
+		}
+		if selection.Quantity > lot.Remaining+lotEpsilon {
+			return nil, ErrInvalidLotSelection
+		}
+
+		take := math.Min(selection.Quantity, lot.Remaining)
+		if err := reduceLot(tx, lot, take); err != nil {
+			return nil, err
+		}
+		consumed = append(consumed, consumedLot{Lot: lot, Quantity: take})
+		total += selection.Quantity
+	}
+
+	if math.Abs(total-quantity) > lotEpsilon*math.Max(1, quantity) {
+		return nil, ErrInvalidLotSelection
+	}
+	return consumed, nil
+}
+
+func reduceLot(tx *gorm.DB, lot models.TaxLot, quantity float64) error {
+	remaining := lot.Remaining - quantity
+	if remaining < lotEpsilon {
+		remaining = 0
+	}
+	return tx.Model(&lot).Update("remaining", remaining).Error
+}
+
+// sellLots consumes the lots sold by a sell trade and records the realized
+// gain on each.
+func sellLots(tx *gorm.DB, portfolio models.Portfolio, trade models.Trade, selections []models.LotSelection) error {
+	consumed, err := consumeLots(tx, portfolio, trade.CoinID, trade.Quantity, selections)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range consumed {
+		costBasis := part.Quantity * part.Lot.CostBasis
+		proceeds := part.Quantity * trade.Price
+		if err := tx.Create(&models.LotDisposal{
+			UserID:      portfolio.UserID,
+			PortfolioID: portfolio.ID,
+			LotID:       part.Lot.ID,
+			TradeID:     trade.ID,
+			CoinID:      trade.CoinID,
+			Quantity:    part.Quantity,
+			CostBasis:   costBasis,
+			Proceeds:    proceeds,
+			Gain:        proceeds - costBasis,
+			Term:        holdingTerm(part.Lot.AcquiredAt, trade.CreatedAt),
+			AcquiredAt:  part.Lot.AcquiredAt,
+			DisposedAt:  trade.CreatedAt,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveLots moves quantity of a coin's lots between portfolios, keeping their
+// cost basis and acquisition date.
+func moveLots(tx *gorm.DB, from, to models.Portfolio, coinID uint, quantity float64) error {
+	consumed, err := consumeLots(tx, from, coinID, quantity, nil)
+	if err != nil {
+		return err
+	}
+	for _, part := range consumed {
+		if err := openLot(tx, to, coinID, part.Quantity, part.Lot.CostBasis, models.LotSourceTransfer, nil, part.Lot.AcquiredAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdingTerm classifies a gain as long-term once the coin was held for
+// more than a year.
+func holdingTerm(acquiredAt, disposedAt time.Time) string {
+	if disposedAt.After(acquiredAt.AddDate(1, 0, 0)) {
+		return models.GainLongTerm
+	}
+	return models.GainShortTerm
+}
+
+// GainSummary totals realized gains.
+type GainSummary struct {
+	Disposals int     `json:"disposals"`
+	Proceeds  float64 `json:"proceeds"`
+	CostBasis float64 `json:"cost_basis"`
+	Gain      float64 `json:"gain"`
+}
+
+func (s *GainSummary) add(disposal models.LotDisposal) {
+	s.Disposals++
+	s.Proceeds += disposal.Proceeds
+	s.CostBasis += disposal.CostBasis
+	s.Gain += disposal.Gain
+}
+
+// TaxReport lists a user's realized gains for a calendar year (UTC) across
+// all portfolios, in BaseCurrency.
+type TaxReport struct {
+	Year      int                  `json:"year"`
+	Method    string               `json:"method"`
+	Currency  string               `json:"currency"`
+	ShortTerm GainSummary          `json:"short_term"`
+	LongTerm  GainSummary          `json:"long_term"`
+	Total     GainSummary          `json:"total"`
+	Disposals []models.LotDisposal `json:"disposals"`
+}
+
+func BuildTaxReport(userID uint, year int) (*TaxReport, error) {
+	if year < 2000 || year > time.Now().Year() {
+		return nil, ErrInvalidTaxYear
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	report := &TaxReport{
+		Year:      year,
+		Method:    user.TaxLotMethod,
+		Currency:  models.BaseCurrency,
+		Disposals: []models.LotDisposal{},
+	}
+	if err := database.DB.Preload("Coin").
+		Where("user_id = ? AND disposed_at >= ? AND disposed_at < ?", userID, start, start.AddDate(1, 0, 0)).
+		Order("disposed_at asc, id asc").
+		Find(&report.Disposals).Error; err != nil {
+		return nil, err
+	}
+
+	for _, disposal := range report.Disposals {
+		if disposal.Term == models.GainLongTerm {
+			report.LongTerm.add(disposal)
+		} else {
+			report.ShortTerm.add(disposal)
+		}
+		report.Total.add(disposal)
+	}
+	return report, nil
+}
+
+// WriteTaxReportCSV writes one row per disposal, laid out like a capital
+// gains schedule, followed by short-term, long-term and total rows.
+func WriteTaxReportCSV(w io.Writer, report *TaxReport) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{{"description", "date_acquired", "date_sold", "proceeds", "cost_basis", "gain", "term", "trade_id", "lot_id"}}
+	for _, disposal := range report.Disposals {
+		rows = append(rows, []string{
+			fmt.Sprintf("%g %s", disposal.Quantity, disposal.Coin.Symbol),
+			disposal.AcquiredAt.UTC().Format("2006-01-02"),
+			disposal.DisposedAt.UTC().Format("2006-01-02"),
+			formatAmount(disposal.Proceeds),
+			formatAmount(disposal.CostBasis),
+			formatAmount(disposal.Gain),
+			disposal.Term,
+			fmt.Sprint(disposal.TradeID),
+			fmt.Sprint(disposal.LotID),
+		})
+	}
+	for _, summary := range []struct {
+		Label string
+		GainSummary
+	}{
+		{"Short-term total", report.ShortTerm},
+		{"Long-term total", report.LongTerm},
+		{"Total", report.Total},
+	} {
+		rows = append(rows, []string{
+			summary.Label, "", "",
+			formatAmount(summary.Proceeds),
+			formatAmount(summary.CostBasis),
+			formatAmount(summary.Gain),
+			"", "", "",
+		})
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bufio"
+	"crypto-app-api/models"
+	"crypto-app-api/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many trades are loaded at a time while exporting.
+const exportBatchSize = 500
+
+var ErrInvalidExportFormat = errors.New("Format must be one of csv, json or xlsx")
+
+// ExportFormats maps each export format to its content type.
+var ExportFormats = map[string]string{
+	"csv":  "text/csv",
+	"json": "application/json",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// tradeExportColumns is the export layout, which the generic import profile
+// reads back.
+var tradeExportColumns = []string{"id", "executed_at", "portfolio_id", "symbol", "type", "quantity", "price", "total_amount", "fee", "external_id"}
+
+// tradeWriter writes exported trades in one format.
+type tradeWriter interface {
+	Write(trade models.Trade) error
+	Close() error
+}
+
+// ExportTrades writes the trades matched by scope to w, oldest first, loading
+// them in batches so large histories are never held in memory at once.
+func ExportTrades(w io.Writer, format string, scope *gorm.DB) error {
+	buffered := bufio.NewWriter(w)
+	writer, err := newTradeWriter(buffered, format)
+	if err != nil {
+		return err
+	}
+
+	var trades []models.Trade
+	result := scope.Preload("Coin").
+		Order("id asc").
+		FindInBatches(&trades, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, trade := range trades {
+				if err := writer.Write(trade); err != nil {
+					return err
+				}
+			}
+			return buffered.Flush()
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+func newTradeWriter(w io.Writer, format string) (tradeWriter, error) {
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(tradeExportColumns); err != nil {
+			return nil, err
+		}
+		return &csvTradeWriter{writer: writer}, nil
+	case "json":
+		if _, err := io.WriteString(w, "["); err != nil {
+			return nil, err
+		}
+		return &jsonTradeWriter{w: w, encoder: json.NewEncoder(w)}, nil
+	case "xlsx":
+		writer, err := utils.NewXLSXWriter(w, "Trades")
+		if err != nil {
+			return nil, err
+		}
+		header := make([]interface{}, len(tradeExportColumns))
+		for i, column := range tradeExportColumns {
+			header[i] = column
+		}
+		if err := writer.WriteRow(header); err != nil {
+			return nil, err
+		}
+		return &xlsxTradeWriter{writer: writer}, nil
+	default:
+		return nil, ErrInvalidExportFormat
+	}
+}
+
+type csvTradeWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvTradeWriter) Write(trade models.Trade) error {
+	return w.writer.Write([]string{
+		strconv.FormatUint(uint64(trade.ID), 10),
+		trade.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatUint(uint64(trade.PortfolioID), 10),
+		trade.Coin.Symbol,
+		trade.Type,
+		strconv.FormatFloat(trade.Quantity, 'f', -1, 64),
+		strconv.FormatFloat(trade.Price, 'f', -1, 64),
+		strconv.FormatFloat(trade.TotalAmount, 'f', -1, 64),
+		strconv.FormatFloat(trade.Fee, 'f', -1, 64),
+		trade.ExternalID,
+	})
+}
+
+func (w *csvTradeWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// jsonTradeWriter writes a JSON array one element at a time.
+type jsonTradeWriter struct {
+	w       io.Writer
+	encoder *json.Encoder
+	written bool
+}
+
+func (w *jsonTradeWriter) Write(trade models.Trade) error {
+	if w.written {
+		if _, err := io.WriteString(w.w, ","); err != nil {
+			return err
+		}
+	}
+	w.written = true
+	return w.encoder.Encode(trade)
+}
+
+func (w *jsonTradeWriter) Close() error {
+	_, err := io.WriteString(w.w, "]")
+	return err
+}
+
+type xlsxTradeWriter struct {
+	writer *utils.XLSXWriter
+}
+
+func (w *xlsxTradeWriter) Write(trade models.Trade) error {
+	return w.writer.WriteRow([]interface{}{
+		trade.ID,
+		trade.CreatedAt.UTC().Format(time.RFC3339),
+		trade.PortfolioID,
+		trade.Coin.Symbol,
+		trade.Type,
+		trade.Quantity,
+		trade.Price,
+		trade.TotalAmount,
+		trade.Fee,
+		trade.ExternalID,
+	})
+}
+
+func (w *xlsxTradeWriter) Close() error {
+	return w.writer.Close()
+}
@@ -0,0 +1,660 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxImportRows caps the trades in one import file.
+	MaxImportRows = 10000
+	// importPreviewRows is how many parsed trades the report echoes back.
+	importPreviewRows = 20
+	// importHeaderSearch is how many leading lines may precede the header,
+	// as some exchanges put a preamble above it.
+	importHeaderSearch = 10
+)
+
+var (
+	ErrUnknownImportProfile = errors.New("Profile must be one of generic, binance, coinbase or kraken")
+	ErrInvalidImportFile    = errors.New("Import file must be a CSV with a header row containing the mapped columns")
+	ErrTooManyImportRows    = errors.New("Import files are limited to 10000 trades")
+
+	errInvalidImportNumber = errors.New("invalid number")
+)
+
+// ImportProfiles are the column mappings of the trade history exports of
+// common exchanges. generic reads this API's own CSV export.
+var ImportProfiles = map[string]models.TradeImportMapping{
+	"generic": {
+		Time:       "executed_at",
+		Symbol:     "symbol",
+		Side:       "type",
+		Quantity:   "quantity",
+		Price:      "price",
+		Total:      "total_amount",
+		Fee:        "fee",
+		ExternalID: "external_id",
+	},
+	"binance": {
+		Time:     "Date(UTC)|Date",
+		Symbol:   "Pair|Market",
+		Side:     "Side|Type",
+		Quantity: "Executed|Amount",
+		Price:    "Price",
+		Total:    "Amount|Total",
+		Fee:      "Fee",
+	},
+	"coinbase": {
+		Time:           "Timestamp",
+		Symbol:         "Asset",
+		Side:           "Transaction Type",
+		Quantity:       "Quantity Transacted",
+		Price:          "Spot Price at Transaction|Price at Transaction",
+		Total:          "Subtotal",
+		Fee:            "Fees and/or Spread|Fees",
+		ExternalID:     "ID",
+		SkipOtherTypes: true,
+	},
+	"kraken": {
+		Time:       "time",
+		Symbol:     "pair",
+		Side:       "type",
+		Quantity:   "vol",
+		Price:      "price",
+		Total:      "cost",
+		Fee:        "fee",
+		ExternalID: "txid",
+	},
+}
+
+// importTimeLayouts are tried in order when the mapping has no TimeFormat.
+var importTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"2006-01-02",
+}
+
+// importQuoteSuffixes are stripped from pairs such as BTCUSDT or XXBTZUSD.
+var importQuoteSuffixes = []string{"USDT", "USDC", "BUSD", "ZUSD", "ZEUR", "ZGBP", "USD", "EUR", "GBP"}
+
+// importSymbolAliases maps exchange specific tickers to the usual ones.
+var importSymbolAliases = map[string]string{"XBT": "BTC", "XDG": "DOGE"}
+
+// ImportRowError is a problem with one line of the file.
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportedTrade is a trade parsed from an import file.
+type ImportedTrade struct {
+	Line       int       `json:"line"`
+	ExecutedAt time.Time `json:"executed_at"`
+	Symbol     string    `json:"symbol"`
+	CoinID     uint      `json:"coin_id"`
+	Type       string    `json:"type"`
+	Quantity   float64   `json:"quantity"`
+	Price      float64   `json:"price"`
+	Fee        float64   `json:"fee"`
+	ExternalID string    `json:"external_id,omitempty"`
+	Duplicate  bool      `json:"duplicate"`
+}
+
+// ImportReport is the outcome of validating, and unless it was a dry run or
+// some rows were invalid, importing a file. Nothing is imported while any row
+// has an error.
+type ImportReport struct {
+	Profile    string           `json:"profile"`
+	DryRun     bool             `json:"dry_run"`
+	Rows       int              `json:"rows"`
+	Skipped    int              `json:"skipped"`
+	Valid      int              `json:"valid"`
+	Duplicates int              `json:"duplicates"`
+	Imported   int              `json:"imported"`
+	Errors     []ImportRowError `json:"errors"`
+	Preview    []ImportedTrade  `json:"preview"`
+}
+
+// importColumns are the header positions of each mapped field, -1 when the
+// file has no such column.
+type importColumns struct {
+	Time, Symbol, Side, Quantity, Price, Total, Fee, ExternalID int
+}
+
+// ImportTrades reads a trade history CSV laid out as described by the
+// profile, with any non-empty fields of mapping overriding it, into the
+// portfolio. Trades already in the portfolio, matched by external ID or else
+// by coin, side, quantity, price and time, are skipped.
+//
+// Imported trades move cash, holdings and tax lots as if they had been made
+// here, fees included, so the cash for buys has to be deposited first. They
+// do not notify.
+func ImportTrades(portfolio models.Portfolio, r io.Reader, profile string, mapping *models.TradeImportMapping, dryRun bool) (*ImportReport, error) {
+	if portfolio.IsContest() {
+		return nil, ErrContestPortfolio
+	}
+	columnsMapping, ok := ImportProfiles[profile]
+	if !ok {
+		return nil, ErrUnknownImportProfile
+	}
+	if mapping != nil {
+		columnsMapping = mergeImportMapping(columnsMapping, *mapping)
+	}
+
+	report := &ImportReport{
+		Profile: profile,
+		DryRun:  dryRun,
+		Errors:  []ImportRowError{},
+		Preview: []ImportedTrade{},
+	}
+
+	rows, err := readImportRows(r, columnsMapping, report)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 0 {
+		if err := validateImportRows(portfolio, rows, report); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range rows {
+		if len(report.Preview) == importPreviewRows {
+			break
+		}
+		report.Preview = append(report.Preview, row)
+	}
+
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	var pending []ImportedTrade
+	for _, row := range rows {
+		if !row.Duplicate {
+			pending = append(pending, row)
+		}
+	}
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range pending {
+			if err := applyImportedTrade(tx, portfolio, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	report.Imported = len(pending)
+	return report, nil
+}
+
+func mergeImportMapping(base, override models.TradeImportMapping) models.TradeImportMapping {
+	for _, field := range []struct {
+		Target *string
+		Value  string
+	}{
+		{&base.Time, override.Time},
+		{&base.Symbol, override.Symbol},
+		{&base.Side, override.Side},
+		{&base.Quantity, override.Quantity},
+		{&base.Price, override.Price},
+		{&base.Total, override.Total},
+		{&base.Fee, override.Fee},
+		{&base.ExternalID, override.ExternalID},
+		{&base.TimeFormat, override.TimeFormat},
+	} {
+		if field.Value != "" {
+			*field.Target = field.Value
+		}
+	}
+	if override.SkipOtherTypes {
+		base.SkipOtherTypes = true
+	}
+	return base
+}
+
+// readImportRows parses the file into trades sorted by execution time,
+// recording row problems on the report.
+func readImportRows(r io.Reader, mapping models.TradeImportMapping, report *ImportReport) ([]ImportedTrade, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var columns *importColumns
+	for i := 0; i < importHeaderSearch && columns == nil; i++ {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, ErrInvalidImportFile
+		}
+		columns = findImportColumns(record, mapping)
+	}
+	if columns == nil {
+		return nil, ErrInvalidImportFile
+	}
+
+	var coins []models.Coin
+	if err := database.DB.Find(&coins).Error; err != nil {
+		return nil, err
+	}
+	bySymbol := make(map[string]models.Coin, len(coins))
+	for _, coin := range coins {
+		bySymbol[strings.ToUpper(coin.Symbol)] = coin
+	}
+
+	var rows []ImportedTrade
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			return nil, ErrInvalidImportFile
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+
+		report.Rows++
+		if report.Rows > MaxImportRows {
+			return nil, ErrTooManyImportRows
+		}
+
+		row, skip, err := parseImportRow(record, *columns, mapping, bySymbol)
+		if err != nil {
+			report.Errors = append(report.Errors, ImportRowError{Line: line, Error: err.Error()})
+			continue
+		}
+		if skip {
+			report.Skipped++
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].ExecutedAt.Before(rows[j].ExecutedAt)
+	})
+	return rows, nil
+}
+
+// findImportColumns returns the mapped columns when record is a header row
+// containing all the required ones.
+func findImportColumns(record []string, mapping models.TradeImportMapping) *importColumns {
+	index := make(map[string]int, len(record))
+	for i, name := range record {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+	find := func(names string) int {
+		for _, name := range strings.Split(names, "|") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if i, ok := index[name]; ok && name != "" {
+				return i
+			}
+		}
+		return -1
+	}
+
+	columns := importColumns{
+		Time:       find(mapping.Time),
+		Symbol:     find(mapping.Symbol),
+		Side:       find(mapping.Side),
+		Quantity:   find(mapping.Quantity),
+		Price:      find(mapping.Price),
+		Total:      find(mapping.Total),
+		Fee:        find(mapping.Fee),
+		ExternalID: find(mapping.ExternalID),
+	}
+	if columns.Time < 0 || columns.Symbol < 0 || columns.Side < 0 || columns.Quantity < 0 ||
+		(columns.Price < 0 && columns.Total < 0) {
+		return nil
+	}
+	return &columns
+}
+
+// parseImportRow parses one record. skip is set for rows that are neither
+// buys nor sells when the mapping says to ignore them.
+func parseImportRow(record []string, columns importColumns, mapping models.TradeImportMapping, coins map[string]models.Coin) (row ImportedTrade, skip bool, err error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row.Type = importSide(field(columns.Side))
+	if row.Type == "" {
+		if mapping.SkipOtherTypes {
+			return row, true, nil
+		}
+		return row, false, fmt.Errorf("Unknown trade side %q", field(columns.Side))
+	}
+
+	coin, ok := resolveImportSymbol(field(columns.Symbol), coins)
+	if !ok {
+		return row, false, fmt.Errorf("Unknown coin %q", field(columns.Symbol))
+	}
+	row.CoinID = coin.ID
+	row.Symbol = coin.Symbol
+
+	if row.ExecutedAt, err = parseImportTime(field(columns.Time), mapping.TimeFormat); err != nil {
+		return row, false, fmt.Errorf("Invalid time %q", field(columns.Time))
+	}
+
+	if row.Quantity, err = parseImportNumber(field(columns.Quantity)); err != nil || row.Quantity <= 0 {
+		return row, false, fmt.Errorf("Invalid quantity %q", field(columns.Quantity))
+	}
+
+	if raw := field(columns.Price); raw != "" {
+		if row.Price, err = parseImportNumber(raw); err != nil {
+			return row, false, fmt.Errorf("Invalid price %q", raw)
+		}
+	}
+	if row.Price <= 0 {
+		raw := field(columns.Total)
+		if raw == "" {
+			return row, false, errors.New("Missing price")
+		}
+		total, err := parseImportNumber(raw)
+		if err != nil || total <= 0 {
+			return row, false, fmt.Errorf("Invalid total %q", raw)
+		}
+		row.Price = total / row.Quantity
+	}
+
+	if raw := field(columns.Fee); raw != "" {
+		if row.Fee, err = parseImportNumber(raw); err != nil {
+			return row, false, fmt.Errorf("Invalid fee %q", raw)
+		}
+	}
+	row.ExternalID = field(columns.ExternalID)
+	return row, false, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// importSide normalises exchange side labels such as "BUY", "b" or
+// "Advanced Trade Sell", returning "" for anything else.
+func importSide(raw string) string {
+	side := strings.ToLower(raw)
+	switch {
+	case side == "b" || strings.Contains(side, "buy") || strings.Contains(side, "bought"):
+		return "buy"
+	case side == "s" || strings.Contains(side, "sell") || strings.Contains(side, "sold"):
+		return "sell"
+	}
+	return ""
+}
+
+// resolveImportSymbol finds the coin of an asset or pair such as BTC,
+// BTC/USD, BTCUSDT or XXBTZUSD.
+func resolveImportSymbol(raw string, coins map[string]models.Coin) (models.Coin, bool) {
+	symbol := strings.ToUpper(strings.TrimSpace(raw))
+	candidates := []string{symbol}
+	if i := strings.IndexAny(symbol, "/-_ "); i > 0 {
+		candidates = append(candidates, symbol[:i])
+	}
+	for _, suffix := range importQuoteSuffixes {
+		if len(symbol) > len(suffix) && strings.HasSuffix(symbol, suffix) {
+			candidates = append(candidates, strings.TrimSuffix(symbol, suffix))
+			break
+		}
+	}
+
+	for _, candidate := range candidates {
+		for _, name := range []string{candidate, strings.TrimPrefix(candidate, "X")} {
+			if alias, ok := importSymbolAliases[name]; ok {
+				name = alias
+			}
+			if coin, ok := coins[name]; ok && name != "" {
+				return coin, true
+			}
+		}
+	}
+	return models.Coin{}, false
+}
+
+func parseImportTime(raw, layout string) (time.Time, error) {
+	if layout != "" {
+		return time.Parse(layout, raw)
+	}
+	for _, layout := range importTimeLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	// Unix timestamps, in seconds or milliseconds
+	seconds, err := strconv.ParseFloat(raw, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, errors.New("unrecognised time")
+	}
+	if seconds > 1e12 {
+		seconds /= 1000
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC(), nil
+}
+
+// parseImportNumber reads amounts such as "1234.5", "1.5e-5", "$1,234.50"
+// or "0.5BTC". A leading sign and currency sign, a trailing asset and comma
+// thousands separators are removed, and what is left must be a plain decimal
+// number. Signs are dropped since the side says which way the trade went.
+func parseImportNumber(raw string) (float64, error) {
+	number := strings.TrimSpace(raw)
+	if strings.HasPrefix(number, "-") || strings.HasPrefix(number, "+") {
+		number = number[1:]
+	}
+	for _, sign := range []string{"$", "€", "£"} {
+		number = strings.TrimPrefix(number, sign)
+	}
+	number = strings.TrimRightFunc(strings.TrimRightFunc(number, unicode.IsLetter), unicode.IsSpace)
+
+	if strings.Contains(number, ",") {
+		whole, fraction, hasFraction := strings.Cut(number, ".")
+		groups := strings.Split(whole, ",")
+		if len(groups[0]) < 1 || len(groups[0]) > 3 {
+			return 0, errInvalidImportNumber
+		}
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return 0, errInvalidImportNumber
+			}
+		}
+		number = strings.Join(groups, "")
+		if hasFraction {
+			number += "." + fraction
+		}
+	}
+
+	// ParseFloat also reads forms no export uses, such as "Inf" or hex
+	for i, r := range number {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == 'e', r == 'E':
+		case (r == '-' || r == '+') && i > 0 && (number[i-1] == 'e' || number[i-1] == 'E'):
+		default:
+			return 0, errInvalidImportNumber
+		}
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, errInvalidImportNumber
+	}
+	return math.Abs(value), nil
+}
+
+// validateImportRows marks duplicates and checks that every buy is covered
+// by the portfolio's cash and every sell by the holding it would come out of
+// at that point.
+func validateImportRows(portfolio models.Portfolio, rows []ImportedTrade, report *ImportReport) error {
+	seen, err := existingTradeKeys(portfolio, rows)
+	if err != nil {
+		return err
+	}
+
+	holdings, err := Holdings(database.DB, portfolio.ID)
+	if err != nil {
+		return err
+	}
+	held := make(map[uint]float64, len(holdings))
+	for _, holding := range holdings {
+		held[holding.CoinID] = holding.Quantity
+	}
+
+	checkImportRows(rows, seen, held, portfolio.Balance, report)
+	return nil
+}
+
+// checkImportRows replays the rows in order against the trades already seen,
+// the quantities held and the BaseCurrency cash, recording duplicates and
+// uncovered trades on the report.
+func checkImportRows(rows []ImportedTrade, seen map[string]bool, held map[uint]float64, cash float64, report *ImportReport) {
+	for i := range rows {
+		row := &rows[i]
+		key := importTradeKey(row.ExternalID, row.CoinID, row.Type, row.Quantity, row.Price, row.ExecutedAt)
+		if seen[key] {
+			row.Duplicate = true
+			report.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		if row.Type == "buy" {
+			cost := row.Quantity*row.Price + row.Fee
+			if cost > cash+lotEpsilon {
+				report.Errors = append(report.Errors, ImportRowError{
+					Line:  row.Line,
+					Error: fmt.Sprintf("Buy of %g %s costs %.2f, more than the %.2f cash at that point", row.Quantity, row.Symbol, cost, cash),
+				})
+				continue
+			}
+			cash -= cost
+			held[row.CoinID] += row.Quantity
+		} else {
+			if row.Quantity > held[row.CoinID]+lotEpsilon {
+				report.Errors = append(report.Errors, ImportRowError{
+					Line:  row.Line,
+					Error: fmt.Sprintf("Sell of %g %s exceeds the %g held at that point", row.Quantity, row.Symbol, held[row.CoinID]),
+				})
+				continue
+			}
+			cash += row.Quantity*row.Price - row.Fee
+			held[row.CoinID] -= row.Quantity
+		}
+		report.Valid++
+	}
+}
+
+// existingTradeKeys returns the dedup keys of the portfolio's trades that
+// could match the rows.
+func existingTradeKeys(portfolio models.Portfolio, rows []ImportedTrade) (map[string]bool, error) {
+	var externalIDs []string
+	for _, row := range rows {
+		if row.ExternalID != "" {
+			externalIDs = append(externalIDs, row.ExternalID)
+		}
+	}
+	from := rows[0].ExecutedAt.Truncate(time.Second)
+	to := rows[len(rows)-1].ExecutedAt.Truncate(time.Second).Add(time.Second)
+
+	query := database.DB.Where("portfolio_id = ?", portfolio.ID)
+	if len(externalIDs) > 0 {
+		query = query.Where("(created_at >= ? AND created_at < ?) OR external_id IN ?", from, to, externalIDs)
+	} else {
+		query = query.Where("created_at >= ? AND created_at < ?", from, to)
+	}
+
+	var trades []models.Trade
+	if err := query.Find(&trades).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(trades))
+	for _, trade := range trades {
+		if trade.ExternalID != "" {
+			keys[importTradeKey(trade.ExternalID, 0, "", 0, 0, time.Time{})] = true
+		}
+		keys[importTradeKey("", trade.CoinID, trade.Type, trade.Quantity, trade.Price, trade.CreatedAt)] = true
+	}
+	return keys, nil
+}
+
+// importTradeKey identifies a trade by its external ID when it has one, and
+// otherwise by what was traded when, to the second.
+func importTradeKey(externalID string, coinID uint, tradeType string, quantity, price float64, executedAt time.Time) string {
+	if externalID != "" {
+		return "external:" + externalID
+	}
+	return fmt.Sprintf("%d:%s:%.8f:%.8f:%d", coinID, tradeType, quantity, price, executedAt.Unix())
+}
+
+// applyImportedTrade books one row like ExecuteTrade would, also charging
+// its fee.
+func applyImportedTrade(tx *gorm.DB, portfolio models.Portfolio, row ImportedTrade) error {
+	totalAmount := row.Quantity * row.Price
+	if row.Type == "buy" {
+		if err := AdjustCashBalance(tx, portfolio, models.BaseCurrency, -(totalAmount + row.Fee)); err != nil {
+			return err
+		}
+		if err := AddToHolding(tx, portfolio, row.CoinID, row.Quantity, row.Price); err != nil {
+			return err
+		}
+	} else {
+		if _, err := RemoveFromHolding(tx, portfolio, row.CoinID, row.Quantity); err != nil {
+			return err
+		}
+		if err := AdjustCashBalance(tx, portfolio, models.BaseCurrency, totalAmount-row.Fee); err != nil {
+			return err
+		}
+	}
+
+	trade := models.Trade{
+		UserID:      portfolio.UserID,
+		PortfolioID: portfolio.ID,
+		CoinID:      row.CoinID,
+		Type:        row.Type,
+		Quantity:    row.Quantity,
+		Price:       row.Price,
+		TotalAmount: totalAmount,
+		Fee:         row.Fee,
+		ExternalID:  row.ExternalID,
+		CreatedAt:   row.ExecutedAt,
+	}
+	if err := tx.Create(&trade).Error; err != nil {
+		return err
+	}
+
+	if trade.Type == "buy" {
+		return openLot(tx, portfolio, trade.CoinID, trade.Quantity, trade.Price, models.LotSourceBuy, &trade.ID, trade.CreatedAt)
+	}
+	return sellLots(tx, portfolio, trade, nil)
+}
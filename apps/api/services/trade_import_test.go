@@ -0,0 +1,226 @@
+package services
+
+import (
+	"crypto-app-api/models"
+	"encoding/csv"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseImportNumber(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    float64
+		invalid bool
+	}{
+		{raw: "1234.5", want: 1234.5},
+		{raw: "1,234.5", want: 1234.5},
+		{raw: "1,234,567", want: 1234567},
+		{raw: "$1,234.50", want: 1234.5},
+		{raw: "-$1,234.50", want: 1234.5},
+		{raw: "€12.5", want: 12.5},
+		{raw: "1.5e-5", want: 0.000015},
+		{raw: "2E3", want: 2000},
+		{raw: "-3", want: 3},
+		{raw: "+3", want: 3},
+		{raw: "0.5BTC", want: 0.5},
+		{raw: "15,000.25 USDT", want: 15000.25},
+		{raw: " 7 ", want: 7},
+		{raw: "", invalid: true},
+		{raw: "abc", invalid: true},
+		{raw: "1,23.5", invalid: true},
+		{raw: "12,3456", invalid: true},
+		{raw: ",123", invalid: true},
+		{raw: "1.234,5", invalid: true},
+		{raw: "1 234", invalid: true},
+		{raw: "1..5", invalid: true},
+		{raw: "1-5", invalid: true},
+		{raw: "0x1p-2", invalid: true},
+		{raw: "NaN", invalid: true},
+		{raw: "Inf", invalid: true},
+		{raw: "1e999", invalid: true},
+		{raw: "--3", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := parseImportNumber(tt.raw)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("parseImportNumber(%q) = %v, want an error", tt.raw, got)
+			}
+			continue
+		}
+		if err != nil || math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("parseImportNumber(%q) = %v, %v, want %v", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+var importTestCoins = map[string]models.Coin{
+	"BTC":  {ID: 1, Symbol: "BTC"},
+	"ETH":  {ID: 2, Symbol: "ETH"},
+	"DOGE": {ID: 3, Symbol: "DOGE"},
+}
+
+// parseImportCSV runs a header and rows through the profile the way
+// readImportRows does, without the coin lookup.
+func parseImportCSV(t *testing.T, profile, file string) ([]ImportedTrade, []string, int) {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(file)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid test CSV: %v", err)
+	}
+	mapping := ImportProfiles[profile]
+	columns := findImportColumns(records[0], mapping)
+	if columns == nil {
+		t.Fatalf("%s profile did not find its columns in %q", profile, records[0])
+	}
+
+	var rows []ImportedTrade
+	var errs []string
+	skipped := 0
+	for _, record := range records[1:] {
+		row, skip, err := parseImportRow(record, *columns, mapping, importTestCoins)
+		switch {
+		case err != nil:
+			errs = append(errs, err.Error())
+		case skip:
+			skipped++
+		default:
+			rows = append(rows, row)
+		}
+	}
+	return rows, errs, skipped
+}
+
+func TestImportProfiles(t *testing.T) {
+	tests := []struct {
+		profile string
+		file    string
+		want    []ImportedTrade
+		skipped int
+	}{
+		{
+			profile: "generic",
+			file: "executed_at,symbol,type,quantity,price,total_amount,fee,external_id\n" +
+				"2024-01-02T10:00:00Z,BTC,buy,0.5,\"40,000\",\"20,000\",10,t-1\n",
+			want: []ImportedTrade{
+				{ExecutedAt: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), Symbol: "BTC", CoinID: 1, Type: "buy", Quantity: 0.5, Price: 40000, Fee: 10, ExternalID: "t-1"},
+			},
+		},
+		{
+			profile: "binance",
+			file: "Date(UTC),Pair,Side,Price,Executed,Amount,Fee\n" +
+				"2024-01-02 10:00:00,BTCUSDT,SELL,\"42,000.00\",0.25BTC,\"10,500.00USDT\",10.5USDT\n" +
+				"2024-01-03 11:30:00,ETHUSDT,BUY,2200,1.5e-3ETH,3.3USDT,0.0033USDT\n",
+			want: []ImportedTrade{
+				{ExecutedAt: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), Symbol: "BTC", CoinID: 1, Type: "sell", Quantity: 0.25, Price: 42000, Fee: 10.5},
+				{ExecutedAt: time.Date(2024, 1, 3, 11, 30, 0, 0, time.UTC), Symbol: "ETH", CoinID: 2, Type: "buy", Quantity: 0.0015, Price: 2200, Fee: 0.0033},
+			},
+		},
+		{
+			profile: "coinbase",
+			file: "ID,Timestamp,Transaction Type,Asset,Quantity Transacted,Spot Price Currency,Spot Price at Transaction,Subtotal,Total (inclusive of fees and/or spread),Fees and/or Spread,Notes\n" +
+				"cb-1,2024-01-02 10:00:00 UTC,Buy,ETH,2,USD,\"$2,100.00\",\"$4,200.00\",\"$4,225.00\",$25.00,Bought 2 ETH\n" +
+				"cb-2,2024-01-02 12:00:00 UTC,Send,ETH,-1,USD,\"$2,100.00\",,,,Sent 1 ETH\n" +
+				"cb-3,2024-01-03 09:00:00 UTC,Advanced Trade Sell,ETH,-1,USD,\"$2,200.00\",\"-$2,200.00\",\"-$2,190.00\",$10.00,Sold 1 ETH\n",
+			want: []ImportedTrade{
+				{ExecutedAt: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), Symbol: "ETH", CoinID: 2, Type: "buy", Quantity: 2, Price: 2100, Fee: 25, ExternalID: "cb-1"},
+				{ExecutedAt: time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC), Symbol: "ETH", CoinID: 2, Type: "sell", Quantity: 1, Price: 2200, Fee: 10, ExternalID: "cb-3"},
+			},
+			skipped: 1,
+		},
+		{
+			profile: "kraken",
+			file: "txid,ordertxid,pair,time,type,ordertype,price,cost,fee,vol,margin,misc,ledgers\n" +
+				"TX1,OX1,XXBTZUSD,2024-01-02 10:00:00.1234,buy,limit,40000.0,2000.0,3.2,0.05,0,,\n" +
+				"TX2,OX2,XDGUSD,1704189600,sell,market,,150.0,0.24,1000,0,,\n",
+			want: []ImportedTrade{
+				{ExecutedAt: time.Date(2024, 1, 2, 10, 0, 0, 123400000, time.UTC), Symbol: "BTC", CoinID: 1, Type: "buy", Quantity: 0.05, Price: 40000, Fee: 3.2, ExternalID: "TX1"},
+				{ExecutedAt: time.Unix(1704189600, 0).UTC(), Symbol: "DOGE", CoinID: 3, Type: "sell", Quantity: 1000, Price: 0.15, Fee: 0.24, ExternalID: "TX2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			rows, errs, skipped := parseImportCSV(t, tt.profile, tt.file)
+			if len(errs) > 0 {
+				t.Fatalf("row errors: %v", errs)
+			}
+			if skipped != tt.skipped {
+				t.Errorf("skipped %d rows, want %d", skipped, tt.skipped)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("parsed %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := rows[i]
+				if !got.ExecutedAt.Equal(want.ExecutedAt) || got.Symbol != want.Symbol || got.CoinID != want.CoinID ||
+					got.Type != want.Type || got.ExternalID != want.ExternalID ||
+					math.Abs(got.Quantity-want.Quantity) > 1e-12 || math.Abs(got.Price-want.Price) > 1e-9 ||
+					math.Abs(got.Fee-want.Fee) > 1e-12 {
+					t.Errorf("row %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImportInvalidRows(t *testing.T) {
+	file := "executed_at,symbol,type,quantity,price,total_amount,fee\n" +
+		"2024-01-02T10:00:00Z,BTC,buy,1.2.3,40000,,\n" +
+		"2024-01-02T10:00:00Z,BTC,buy,1,\"40,00\",,\n" +
+		"2024-01-02T10:00:00Z,BTC,buy,1,,\"4,0000\",\n" +
+		"2024-01-02T10:00:00Z,BTC,buy,1,,,\n" +
+		"2024-01-02T10:00:00Z,BTC,buy,1,40000,,1 0\n" +
+		"2024-01-02T10:00:00Z,BTC,hold,1,40000,,\n" +
+		"2024-01-02T10:00:00Z,SHIB,buy,1,40000,,\n" +
+		"yesterday,BTC,buy,1,40000,,\n"
+	want := []string{
+		`Invalid quantity "1.2.3"`,
+		`Invalid price "40,00"`,
+		`Invalid total "4,0000"`,
+		"Missing price",
+		`Invalid fee "1 0"`,
+		`Unknown trade side "hold"`,
+		`Unknown coin "SHIB"`,
+		`Invalid time "yesterday"`,
+	}
+
+	rows, errs, _ := parseImportCSV(t, "generic", file)
+	if len(rows) != 0 {
+		t.Errorf("parsed %d rows, want none", len(rows))
+	}
+	if strings.Join(errs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("row errors =\n%s\nwant\n%s", strings.Join(errs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckImportRows(t *testing.T) {
+	at := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	rows := []ImportedTrade{
+		{Line: 2, CoinID: 1, Symbol: "BTC", Type: "buy", Quantity: 1, Price: 900, Fee: 10, ExecutedAt: at},
+		// Costs more than the 90 left
+		{Line: 3, CoinID: 2, Symbol: "ETH", Type: "buy", Quantity: 1, Price: 100, ExecutedAt: at.Add(time.Hour)},
+		{Line: 4, CoinID: 1, Symbol: "BTC", Type: "sell", Quantity: 0.5, Price: 1000, Fee: 5, ExecutedAt: at.Add(2 * time.Hour)},
+		// Paid for by the sale
+		{Line: 5, CoinID: 2, Symbol: "ETH", Type: "buy", Quantity: 1, Price: 100, ExecutedAt: at.Add(3 * time.Hour)},
+		{Line: 6, CoinID: 2, Symbol: "ETH", Type: "sell", Quantity: 2, Price: 100, ExecutedAt: at.Add(4 * time.Hour)},
+		{Line: 7, CoinID: 1, Symbol: "BTC", Type: "buy", Quantity: 1, Price: 1, ExternalID: "dup", ExecutedAt: at.Add(5 * time.Hour)},
+	}
+	seen := map[string]bool{importTradeKey("dup", 0, "", 0, 0, time.Time{}): true}
+	report := &ImportReport{}
+
+	checkImportRows(rows, seen, map[uint]float64{}, 1000, report)
+
+	if report.Valid != 3 || report.Duplicates != 1 || !rows[5].Duplicate {
+		t.Errorf("report = %+v, want 3 valid and row 7 duplicate", report)
+	}
+	if len(report.Errors) != 2 || report.Errors[0].Line != 3 || report.Errors[1].Line != 6 {
+		t.Fatalf("errors = %+v, want lines 3 and 6", report.Errors)
+	}
+	if !strings.Contains(report.Errors[0].Error, "cash") || !strings.Contains(report.Errors[1].Error, "held") {
+		t.Errorf("errors = %+v, want a cash shortfall then a holding shortfall", report.Errors)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidTradeType   = errors.New("Trade type must be 'buy' or 'sell'")
+	ErrInvalidTradeAmount = errors.New("Quantity and price must be positive")
+)
+
+// ExecuteTrade fills a buy or sell in the given portfolio at req.Price,
+// moving BaseCurrency cash and coin holdings and recording the trade. This is
+// the single execution path for manual trades and everything automated on top
+// of them. Contest trades ignore req.Price and fill at the coin's current
+// price, so entrants compete on the same market.
+func ExecuteTrade(portfolio models.Portfolio, req models.TradeRequest) (*models.Trade, error) {
+	if req.Type != "buy" && req.Type != "sell" {
+		return nil, ErrInvalidTradeType
+	}
+	if req.Quantity <= 0 || req.Price <= 0 {
+		return nil, ErrInvalidTradeAmount
+	}
+	if portfolio.IsArchived() {
+		return nil, ErrPortfolioArchived
+	}
+	if err := checkContestTrade(portfolio, req.CoinID); err != nil {
+		return nil, err
+	}
+
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+	if portfolio.IsContest() {
+		if coin.CurrentPrice <= 0 {
+			return nil, ErrInvalidTradeAmount
+		}
+		req.Price = coin.CurrentPrice
+	}
+
+	totalAmount := req.Quantity * req.Price
+	var trade models.Trade
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Type == "buy" {
+			if err := AdjustCashBalance(tx, portfolio, models.BaseCurrency, -totalAmount); err != nil {
+				return err
+			}
+			if err := AddToHolding(tx, portfolio, req.CoinID, req.Quantity, req.Price); err != nil {
+				return err
+			}
+		} else { // sell
+			if _, err := RemoveFromHolding(tx, portfolio, req.CoinID, req.Quantity); err != nil {
+				return err
+			}
+			if err := AdjustCashBalance(tx, portfolio, models.BaseCurrency, totalAmount); err != nil {
+				return err
+			}
+		}
+
+		// Create trade record
+		trade = models.Trade{
+			UserID:      portfolio.UserID,
+			PortfolioID: portfolio.ID,
+			CoinID:      req.CoinID,
+			Type:        req.Type,
+			Quantity:    req.Quantity,
+			Price:       req.Price,
+			TotalAmount: totalAmount,
+			CopiedFrom:  req.CopiedFrom,
+		}
+		if err := tx.Create(&trade).Error; err != nil {
+			return err
+		}
+
+		if trade.Type == "buy" {
+			return openLot(tx, portfolio, trade.CoinID, trade.Quantity, trade.Price, models.LotSourceBuy, &trade.ID, trade.CreatedAt)
+		}
+		return sellLots(tx, portfolio, trade, req.Lots)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Load trade with relations
+	trade.Coin = coin
+
+	verb := "Bought"
+	if trade.Type == "sell" {
+		verb = "Sold"
+	}
+	events.Publish(events.Event{
+		Type:        events.TradeExecuted,
+		UserID:      trade.UserID,
+		Title:       fmt.Sprintf("%s %s", verb, coin.Symbol),
+		Message:     fmt.Sprintf("%s %g %s at %.2f (total %.2f)", verb, trade.Quantity, coin.Symbol, trade.Price, trade.TotalAmount),
+		ReferenceID: trade.ID,
+		Data:        trade,
+		OccurredAt:  trade.CreatedAt,
+	})
+	return &trade, nil
+}
+
+// ExecuteMarketOrder trades amount of BaseCurrency worth of a coin at its
+// current price.
+func ExecuteMarketOrder(portfolio models.Portfolio, coinID uint, tradeType string, amount float64) (*models.Trade, error) {
+	var coin models.Coin
+	if err := database.DB.First(&coin, coinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+	if amount <= 0 || coin.CurrentPrice <= 0 {
+		return nil, ErrInvalidTradeAmount
+	}
+
+	return ExecuteTrade(portfolio, models.TradeRequest{
+		PortfolioID: portfolio.ID,
+		CoinID:      coinID,
+		Type:        tradeType,
+		Quantity:    amount / coin.CurrentPrice,
+		Price:       coin.CurrentPrice,
+	})
+}
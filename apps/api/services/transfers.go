@@ -0,0 +1,350 @@
+package services
+
+import (
+	"crypto-app-api/config"
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxTransferDelay caps the per-request delay override.
+const maxTransferDelay = 24 * time.Hour
+
+var (
+	ErrInvalidTransfer    = errors.New("Invalid transfer request")
+	ErrTransferNotPending = errors.New("Transfer is no longer pending")
+	ErrTransferNotFound   = errors.New("Transfer not found")
+)
+
+// CreateTransfer records a simulated deposit into or withdrawal from a
+// portfolio. Withdrawn funds are held immediately; everything settles once the
+// confirmation delay elapses, or straight away when the delay is zero.
+func CreateTransfer(portfolio models.Portfolio, direction string, req models.TransferRequest) (*models.Transfer, error) {
+	if req.Amount <= 0 {
+		return nil, ErrInvalidTransfer
+	}
+	if portfolio.IsContest() {
+		return nil, ErrContestPortfolio
+	}
+
+	delay := config.AppConfig.DepositDelay
+	if direction == models.TransferWithdrawal {
+		delay = config.AppConfig.WithdrawalDelay
+	}
+	if req.DelaySeconds != nil {
+		delay = time.Duration(*req.DelaySeconds) * time.Second
+		if delay < 0 || delay > maxTransferDelay {
+			return nil, ErrInvalidTransfer
+		}
+	}
+
+	transfer := models.Transfer{
+		UserID:      portfolio.UserID,
+		PortfolioID: portfolio.ID,
+		Direction:   direction,
+		Asset:       req.Asset,
+		Amount:      req.Amount,
+		Status:      models.TransferStatusPending,
+		AvailableAt: time.Now().Add(delay),
+	}
+
+	switch req.Asset {
+	case models.TransferAssetFiat:
+		transfer.Currency = NormalizeCurrency(req.Currency)
+		if _, err := GetFxRate(transfer.Currency); err != nil {
+			return nil, err
+		}
+	case models.TransferAssetCoin:
+		var coin models.Coin
+		if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+			return nil, ErrCoinNotFound
+		}
+		transfer.CoinID = &coin.ID
+	default:
+		return nil, ErrInvalidTransfer
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Hold withdrawn funds so they cannot be traded while pending
+		if direction == models.TransferWithdrawal {
+			if transfer.Asset == models.TransferAssetFiat {
+				if err := AdjustCashBalance(tx, portfolio, transfer.Currency, -transfer.Amount); err != nil {
+					return err
+				}
+			} else {
+				averagePrice, err := RemoveFromHolding(tx, portfolio, *transfer.CoinID, transfer.Amount)
+				if err != nil {
+					return err
+				}
+				if _, err := consumeLots(tx, portfolio, *transfer.CoinID, transfer.Amount, nil); err != nil {
+					return err
+				}
+				transfer.CostBasis = averagePrice
+			}
+		}
+
+		if err := tx.Create(&transfer).Error; err != nil {
+			return err
+		}
+
+		if delay == 0 {
+			return confirmTransfer(tx, &transfer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	database.DB.Preload("Coin").First(&transfer, transfer.ID)
+	if transfer.Status == models.TransferStatusConfirmed {
+		publishTransferConfirmed(transfer)
+	}
+	return &transfer, nil
+}
+
+// CancelTransfer cancels a pending transfer, releasing any held withdrawal.
+func CancelTransfer(userID, transferID uint) (*models.Transfer, error) {
+	var transfer models.Transfer
+	if err := database.DB.Where("id = ? AND user_id = ?", transferID, userID).First(&transfer).Error; err != nil {
+		return nil, ErrTransferNotFound
+	}
+
+	var portfolio models.Portfolio
+	if err := database.DB.First(&portfolio, transfer.PortfolioID).Error; err != nil {
+		return nil, ErrPortfolioNotFound
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Transfer{}).
+			Where("id = ? AND status = ?", transfer.ID, models.TransferStatusPending).
+			Update("status", models.TransferStatusCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTransferNotPending
+		}
+
+		if transfer.Direction != models.TransferWithdrawal {
+			return nil
+		}
+		if transfer.Asset == models.TransferAssetFiat {
+			return AdjustCashBalance(tx, portfolio, transfer.Currency, transfer.Amount)
+		}
+		// The withdrawn lots are gone, so the coins come back as one lot at
+		// their average cost, acquired when the withdrawal was requested
+		if err := AddToHolding(tx, portfolio, *transfer.CoinID, transfer.Amount, transfer.CostBasis); err != nil {
+			return err
+		}
+		return openLot(tx, portfolio, *transfer.CoinID, transfer.Amount, transfer.CostBasis, models.LotSourceTransfer, nil, transfer.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transfer.Status = models.TransferStatusCancelled
+	return &transfer, nil
+}
+
+// SettleDueTransfers confirms pending transfers whose delay has elapsed.
+func SettleDueTransfers() error {
+	var due []models.Transfer
+	if err := database.DB.Preload("Coin").
+		Where("status = ? AND available_at <= ?", models.TransferStatusPending, time.Now()).
+		Order("available_at asc").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		return err
+	}
+
+	for i := range due {
+		if err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return confirmTransfer(tx, &due[i])
+		}); err != nil {
+			if !errors.Is(err, ErrTransferNotPending) {
+				log.Printf("Failed to settle transfer %d: %v", due[i].ID, err)
+			}
+			continue
+		}
+		publishTransferConfirmed(due[i])
+	}
+	return nil
+}
+
+// publishTransferConfirmed announces a settled deposit or withdrawal.
+func publishTransferConfirmed(transfer models.Transfer) {
+	title, verb := "Deposit confirmed", "deposited"
+	if transfer.Direction == models.TransferWithdrawal {
+		title, verb = "Withdrawal confirmed", "withdrawn"
+	}
+
+	asset := transfer.Currency
+	if transfer.Coin != nil {
+		asset = transfer.Coin.Symbol
+	}
+
+	events.Publish(events.Event{
+		Type:        events.BalanceChanged,
+		UserID:      transfer.UserID,
+		Title:       title,
+		Message:     fmt.Sprintf("%g %s %s", transfer.Amount, asset, verb),
+		ReferenceID: transfer.ID,
+		Data:        transfer,
+	})
+}
+
+// confirmTransfer marks a transfer confirmed and credits deposits. The status
+// update only matches while the transfer is still pending, so concurrent
+// settlers cannot credit the same deposit twice.
+func confirmTransfer(tx *gorm.DB, transfer *models.Transfer) error {
+	now := time.Now()
+	result := tx.Model(&models.Transfer{}).
+		Where("id = ? AND status = ?", transfer.ID, models.TransferStatusPending).
+		Updates(map[string]interface{}{
+			"status":       models.TransferStatusConfirmed,
+			"confirmed_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTransferNotPending
+	}
+	transfer.Status = models.TransferStatusConfirmed
+	transfer.ConfirmedAt = &now
+
+	if transfer.Direction != models.TransferDeposit {
+		return nil
+	}
+
+	var portfolio models.Portfolio
+	if err := tx.First(&portfolio, transfer.PortfolioID).Error; err != nil {
+		return err
+	}
+
+	if transfer.Asset == models.TransferAssetFiat {
+		return AdjustCashBalance(tx, portfolio, transfer.Currency, transfer.Amount)
+	}
+
+	// Coins arriving from outside are valued at the current market price
+	var coin models.Coin
+	if err := tx.First(&coin, *transfer.CoinID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(transfer).Update("cost_basis", coin.CurrentPrice).Error; err != nil {
+		return err
+	}
+	if err := AddToHolding(tx, portfolio, coin.ID, transfer.Amount, coin.CurrentPrice); err != nil {
+		return err
+	}
+	return openLot(tx, portfolio, coin.ID, transfer.Amount, coin.CurrentPrice, models.LotSourceDeposit, nil, *transfer.ConfirmedAt)
+}
+
+// ResetAccount archives the portfolio's trade history, clears its holdings,
+// cash and pending transfers, and restores it to startingBalance.
+func ResetAccount(portfolio models.Portfolio, startingBalance float64) (*models.AccountReset, error) {
+	if startingBalance <= 0 {
+		return nil, ErrInvalidTransfer
+	}
+	if portfolio.IsContest() {
+		return nil, ErrContestPortfolio
+	}
+
+	var reset models.AccountReset
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.Portfolio
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, portfolio.ID).Error; err != nil {
+			return err
+		}
+
+		previousValue, err := portfolioValue(tx, locked)
+		if err != nil {
+			return err
+		}
+
+		reset = models.AccountReset{
+			UserID:          locked.UserID,
+			PortfolioID:     locked.ID,
+			StartingBalance: startingBalance,
+			PreviousBalance: locked.Balance,
+			PreviousValue:   previousValue,
+		}
+		if err := tx.Create(&reset).Error; err != nil {
+			return err
+		}
+
+		archived := tx.Model(&models.Trade{}).
+			Where("portfolio_id = ? AND reset_id IS NULL", locked.ID).
+			Update("reset_id", reset.ID)
+		if archived.Error != nil {
+			return archived.Error
+		}
+		reset.ArchivedTrades = archived.RowsAffected
+		if err := tx.Model(&reset).Update("archived_trades", reset.ArchivedTrades).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("portfolio_id = ?", locked.ID).Delete(&models.UserCoin{}).Error; err != nil {
+			return err
+		}
+		// Lots are closed rather than deleted so past disposals keep them
+		if err := tx.Model(&models.TaxLot{}).
+			Where("portfolio_id = ? AND remaining > 0", locked.ID).
+			Update("remaining", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("portfolio_id = ?", locked.ID).Delete(&models.FiatBalance{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Transfer{}).
+			Where("portfolio_id = ? AND status = ?", locked.ID, models.TransferStatusPending).
+			Update("status", models.TransferStatusCancelled).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&locked).Update("balance", startingBalance).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.Publish(events.Event{
+		Type:        events.BalanceChanged,
+		UserID:      reset.UserID,
+		Title:       "Account reset",
+		Message:     fmt.Sprintf("Portfolio reset to %.2f %s", startingBalance, models.BaseCurrency),
+		ReferenceID: reset.ID,
+		Data:        reset,
+		OccurredAt:  reset.CreatedAt,
+	})
+	return &reset, nil
+}
+
+// portfolioValue returns cash plus holdings at current prices, in BaseCurrency.
+func portfolioValue(tx *gorm.DB, portfolio models.Portfolio) (float64, error) {
+	balances, err := CashBalances(portfolio)
+	if err != nil {
+		return 0, err
+	}
+	total, err := TotalCash(balances, models.BaseCurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	holdings, err := Holdings(tx, portfolio.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, holding := range holdings {
+		total += holding.Quantity * holding.Coin.CurrentPrice
+	}
+	return total, nil
+}
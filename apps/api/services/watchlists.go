@@ -0,0 +1,282 @@
+package services
+
+import (
+	"crypto-app-api/database"
+	"crypto-app-api/models"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultWatchlistName is the name given to the watchlist every user starts with.
+const DefaultWatchlistName = "Watchlist"
+
+var (
+	ErrWatchlistNotFound      = errors.New("Watchlist not found")
+	ErrWatchlistEntryNotFound = errors.New("Watchlist item not found")
+	ErrDuplicateWatchlistCoin = errors.New("Coin already in watchlist")
+	ErrInvalidWatchlistName   = errors.New("Watchlist name is required")
+	ErrDefaultWatchlistDelete = errors.New("The default watchlist cannot be deleted")
+	ErrInvalidWatchlistOrder  = errors.New("Order must list every item in the watchlist exactly once")
+	ErrInvalidTargetPrice     = errors.New("Target price must be positive")
+)
+
+// ResolveWatchlist returns the user's watchlist with the given ID, or their
+// default watchlist when id is zero, creating it if needed.
+func ResolveWatchlist(userID, id uint) (*models.WatchlistGroup, error) {
+	var group models.WatchlistGroup
+	if id != 0 {
+		if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&group).Error; err != nil {
+			return nil, ErrWatchlistNotFound
+		}
+		return &group, nil
+	}
+
+	err := database.DB.Where("user_id = ? AND is_default = ?", userID, true).First(&group).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		group = models.WatchlistGroup{UserID: userID, Name: DefaultWatchlistName, IsDefault: true}
+		if err = database.DB.Create(&group).Error; err != nil {
+			// Lost a race with a concurrent request creating it
+			err = database.DB.Where("user_id = ? AND is_default = ?", userID, true).First(&group).Error
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// WatchlistEntries returns a watchlist's coins in display order.
+func WatchlistEntries(groupID uint) ([]models.Watchlist, error) {
+	var entries []models.Watchlist
+	err := database.DB.Preload("Coin").
+		Where("group_id = ?", groupID).
+		Order("position asc, id asc").
+		Find(&entries).Error
+	return entries, err
+}
+
+func CreateWatchlist(userID uint, name string) (*models.WatchlistGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidWatchlistName
+	}
+
+	group := models.WatchlistGroup{UserID: userID, Name: name}
+	if err := database.DB.Create(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func RenameWatchlist(userID, id uint, name string) (*models.WatchlistGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidWatchlistName
+	}
+
+	group, err := ResolveWatchlist(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(group).Update("name", name).Error; err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// DeleteWatchlist removes a watchlist and its entries. The default watchlist
+// cannot be deleted.
+func DeleteWatchlist(userID, id uint) error {
+	group, err := ResolveWatchlist(userID, id)
+	if err != nil {
+		return err
+	}
+	if group.IsDefault {
+		return ErrDefaultWatchlistDelete
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.Watchlist{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+}
+
+// AddWatchlistEntry appends a coin to the end of a watchlist.
+func AddWatchlistEntry(group models.WatchlistGroup, req models.WatchlistEntryRequest) (*models.Watchlist, error) {
+	if req.TargetPrice != nil && *req.TargetPrice <= 0 {
+		return nil, ErrInvalidTargetPrice
+	}
+
+	var coin models.Coin
+	if err := database.DB.First(&coin, req.CoinID).Error; err != nil {
+		return nil, ErrCoinNotFound
+	}
+
+	entry := models.Watchlist{
+		UserID:      group.UserID,
+		GroupID:     group.ID,
+		CoinID:      coin.ID,
+		Position:    nextWatchlistPosition(database.DB, group.ID),
+		Notes:       req.Notes,
+		TargetPrice: req.TargetPrice,
+	}
+
+	// The (list, coin) unique index turns a duplicate into a no-op insert
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDuplicateWatchlistCoin
+	}
+
+	entry.Coin = coin
+	return &entry, nil
+}
+
+func nextWatchlistPosition(tx *gorm.DB, groupID uint) int {
+	var position int
+	tx.Model(&models.Watchlist{}).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Where("group_id = ?", groupID).
+		Scan(&position)
+	return position
+}
+
+// UpdateWatchlistEntry replaces an entry's notes and target price.
+func UpdateWatchlistEntry(group models.WatchlistGroup, entryID uint, req models.WatchlistEntryRequest) (*models.Watchlist, error) {
+	if req.TargetPrice != nil && *req.TargetPrice <= 0 {
+		return nil, ErrInvalidTargetPrice
+	}
+
+	var entry models.Watchlist
+	if err := database.DB.Where("id = ? AND group_id = ?", entryID, group.ID).First(&entry).Error; err != nil {
+		return nil, ErrWatchlistEntryNotFound
+	}
+
+	if err := database.DB.Model(&entry).Updates(map[string]interface{}{
+		"notes":        req.Notes,
+		"target_price": req.TargetPrice,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	database.DB.Preload("Coin").First(&entry, entry.ID)
+	return &entry, nil
+}
+
+// RemoveWatchlistEntry removes one of the user's watchlist entries by ID,
+// limited to one watchlist unless groupID is zero.
+func RemoveWatchlistEntry(userID, groupID, entryID uint) error {
+	query := database.DB.Where("id = ? AND user_id = ?", entryID, userID)
+	if groupID != 0 {
+		query = query.Where("group_id = ?", groupID)
+	}
+	result := query.Delete(&models.Watchlist{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWatchlistEntryNotFound
+	}
+	return nil
+}
+
+// BulkUpdateWatchlist adds and removes coins by ID in one transaction and
+// returns how many entries were added and removed. Coins already on the list
+// are skipped.
+func BulkUpdateWatchlist(group models.WatchlistGroup, add, remove []uint) (int64, int64, error) {
+	if len(add) > 0 {
+		var count int64
+		database.DB.Model(&models.Coin{}).Where("id IN ?", add).Count(&count)
+		if int(count) != len(uniqueIDs(add)) {
+			return 0, 0, ErrCoinNotFound
+		}
+	}
+
+	var added, removed int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(remove) > 0 {
+			result := tx.Where("group_id = ? AND coin_id IN ?", group.ID, remove).Delete(&models.Watchlist{})
+			if result.Error != nil {
+				return result.Error
+			}
+			removed = result.RowsAffected
+		}
+
+		position := nextWatchlistPosition(tx, group.ID)
+		for _, coinID := range uniqueIDs(add) {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Watchlist{
+				UserID:   group.UserID,
+				GroupID:  group.ID,
+				CoinID:   coinID,
+				Position: position,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				added++
+				position++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return added, removed, nil
+}
+
+// ReorderWatchlist sets the display order of a watchlist. entryIDs must list
+// every entry on it exactly once.
+func ReorderWatchlist(group models.WatchlistGroup, entryIDs []uint) ([]models.Watchlist, error) {
+	var existing []uint
+	if err := database.DB.Model(&models.Watchlist{}).Where("group_id = ?", group.ID).Pluck("id", &existing).Error; err != nil {
+		return nil, err
+	}
+
+	if len(entryIDs) != len(existing) || len(uniqueIDs(entryIDs)) != len(entryIDs) {
+		return nil, ErrInvalidWatchlistOrder
+	}
+	onList := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		onList[id] = true
+	}
+	for _, id := range entryIDs {
+		if !onList[id] {
+			return nil, ErrInvalidWatchlistOrder
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for position, id := range entryIDs {
+			if err := tx.Model(&models.Watchlist{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return WatchlistEntries(group.ID)
+}
+
+// uniqueIDs returns ids with duplicates removed, keeping the first occurrence.
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto-app-api/database"
+	"crypto-app-api/events"
+	"crypto-app-api/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxWebhookEndpoints   = 10
+	maxWebhookAttempts    = 6
+	webhookRetryBase      = 30 * time.Second
+	webhookRetryMax       = time.Hour
+	webhookAttemptLease   = time.Minute
+	maxWebhookResponseLog = 1024
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("Webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("Webhook delivery not found")
+	ErrInvalidWebhookEndpoint  = errors.New("Webhook URL must be an absolute http(s) URL")
+	ErrWebhookAddressBlocked   = errors.New("Webhook URL must resolve to a public address")
+	ErrInvalidWebhookEvent     = errors.New("Unknown webhook event type")
+	ErrTooManyWebhooks         = errors.New("Webhook endpoint limit reached")
+)
+
+// WebhookSender POSTs signed payloads to webhook endpoints.
+type WebhookSender struct {
+	Client *http.Client
+}
+
+var webhookSender = WebhookSender{Client: newWebhookClient()}
+
+// newWebhookClient returns a client that refuses to connect to addresses
+// isPublicAddress rejects. The check runs on the address actually dialed, so
+// a hostname re-pointed at an internal address after the endpoint was saved
+// is still refused. Proxies are not used, as they would be dialed instead.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicAddress(ip) {
+				return ErrWebhookAddressBlocked
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// isPublicAddress reports whether webhooks may be sent to ip: anything but
+// loopback, private, link-local, unspecified and multicast addresses, which
+// would let users reach the server's own network.
+func isPublicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// checkWebhookHost resolves host and rejects it unless every address it
+// resolves to is public.
+func checkWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return ErrInvalidWebhookEndpoint
+	}
+	for _, addr := range addrs {
+		if !isPublicAddress(addr.IP) {
+			return ErrWebhookAddressBlocked
+		}
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+// keyed with the endpoint secret, as sent in X-Webhook-Signature. Receivers
+// recompute it to check the payload came from us and was not altered.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send makes one delivery attempt and returns the response status and a
+// truncated copy of the body.
+func (s WebhookSender) Send(endpoint models.WebhookEndpoint, delivery models.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crypto-app-webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookPayload(endpoint.Secret, timestamp, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseLog))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// applyWebhookEndpoint validates req and copies it onto endpoint. The URL's
+// host must resolve to public addresses only.
+func applyWebhookEndpoint(endpoint *models.WebhookEndpoint, req models.WebhookEndpointRequest) error {
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidWebhookEndpoint
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := checkWebhookHost(ctx, u.Hostname()); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var types []string
+	for _, t := range req.EventTypes {
+		t = strings.TrimSpace(t)
+		if !events.IsValidType(t) {
+			return ErrInvalidWebhookEvent
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+
+	endpoint.URL = u.String()
+	endpoint.Description = req.Description
+	endpoint.EventTypes = strings.Join(types, ",")
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+	return nil
+}
+
+// CreateWebhookEndpoint registers an endpoint with a freshly generated
+// signing secret.
+func CreateWebhookEndpoint(userID uint, req models.WebhookEndpointRequest) (*models.WebhookEndpoint, error) {
+	var count int64
+	database.DB.Model(&models.WebhookEndpoint{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxWebhookEndpoints {
+		return nil, ErrTooManyWebhooks
+	}
+
+	endpoint := models.WebhookEndpoint{UserID: userID, Active: true}
+	if err := applyWebhookEndpoint(&endpoint, req); err != nil {
+		return nil, err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Secret = secret
+
+	if err := database.DB.Create(&endpoint).Error; err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+func UpdateWebhookEndpoint(userID, id uint, req models.WebhookEndpointRequest) (*models.WebhookEndpoint, error) {
+	endpoint, err := findWebhookEndpoint(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyWebhookEndpoint(endpoint, req); err != nil {
+		return nil, err
+	}
+	if err := database.DB.Save(endpoint).Error; err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// RotateWebhookSecret replaces the endpoint's signing secret.
+func RotateWebhookSecret(userID, id uint) (*models.WebhookEndpoint, error) {
+	endpoint, err := findWebhookEndpoint(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(endpoint).Update("secret", secret).Error; err != nil {
+		return nil, err
+	}
+	endpoint.Secret = secret
+	return endpoint, nil
+}
+
+// DeleteWebhookEndpoint removes an endpoint along with its delivery log.
+func DeleteWebhookEndpoint(userID, id uint) error {
+	endpoint, err := findWebhookEndpoint(userID, id)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ?", endpoint.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(endpoint).Error
+	})
+}
+
+func findWebhookEndpoint(userID, id uint) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&endpoint).Error; err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	return &endpoint, nil
+}
+
+// SubscribeWebhooks queues a delivery to every active endpoint of the event's
+// owner that accepts its type, and makes the first attempt straight away.
+func SubscribeWebhooks() {
+	events.Subscribe(func(event events.Event) {
+		var endpoints []models.WebhookEndpoint
+		if err := database.DB.Where("user_id = ? AND active = ?", event.UserID, true).Find(&endpoints).Error; err != nil {
+			log.Printf("Failed to load webhooks for user %d: %v", event.UserID, err)
+			return
+		}
+
+		var payload []byte
+		for _, endpoint := range endpoints {
+			if !endpoint.Accepts(event.Type) {
+				continue
+			}
+			if payload == nil {
+				var err error
+				if payload, err = json.Marshal(event); err != nil {
+					log.Printf("Failed to encode %s webhook payload: %v", event.Type, err)
+					return
+				}
+			}
+
+			delivery, err := queueWebhookDelivery(endpoint, event.Type, string(payload), nil)
+			if err != nil {
+				log.Printf("Failed to queue webhook delivery to endpoint %d: %v", endpoint.ID, err)
+				continue
+			}
+			attemptWebhookDelivery(endpoint, *delivery)
+		}
+	}, events.Types...)
+}
+
+// queueWebhookDelivery records a pending delivery. It is leased for the
+// caller's immediate attempt so the retry job leaves it alone meanwhile.
+func queueWebhookDelivery(endpoint models.WebhookEndpoint, eventType, payload string, redeliveryOf *uint) (*models.WebhookDelivery, error) {
+	delivery := newWebhookDelivery(endpoint, eventType, payload, redeliveryOf, time.Now())
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// newWebhookDelivery builds a pending delivery of payload to endpoint,
+// leased from now for the first attempt. Redeliveries point back at the
+// delivery they repeat.
+func newWebhookDelivery(endpoint models.WebhookEndpoint, eventType, payload string, redeliveryOf *uint, now time.Time) models.WebhookDelivery {
+	lease := now.Add(webhookAttemptLease)
+	return models.WebhookDelivery{
+		EndpointID:    endpoint.ID,
+		UserID:        endpoint.UserID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: &lease,
+		RedeliveryOf:  redeliveryOf,
+	}
+}
+
+// webhookBackoff is the wait after the given number of failed attempts:
+// 30s, 1m, 2m, 4m... capped at an hour.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookRetryBase
+	for i := 1; i < attempts && backoff < webhookRetryMax; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookRetryMax {
+		backoff = webhookRetryMax
+	}
+	return backoff
+}
+
+// attemptWebhookDelivery sends a delivery and records the outcome.
+func attemptWebhookDelivery(endpoint models.WebhookEndpoint, delivery models.WebhookDelivery) *models.WebhookDelivery {
+	var (
+		code int
+		body string
+		err  error
+	)
+	if endpoint.Active {
+		code, body, err = webhookSender.Send(endpoint, delivery)
+	} else {
+		err = errors.New("endpoint is disabled")
+	}
+
+	updates := webhookAttemptUpdates(delivery, endpoint.Active, code, body, err, time.Now())
+	if err := database.DB.Model(&delivery).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+	database.DB.First(&delivery, delivery.ID)
+	return &delivery
+}
+
+// webhookAttemptUpdates are the delivery log changes for an attempt made at
+// now that got code and body back, or err. Failed attempts are retried with
+// exponential backoff until maxWebhookAttempts is reached or the endpoint
+// is disabled.
+func webhookAttemptUpdates(delivery models.WebhookDelivery, active bool, code int, body string, err error, now time.Time) map[string]interface{} {
+	updates := map[string]interface{}{
+		"attempts":        delivery.Attempts + 1,
+		"last_attempt_at": now,
+		"response_code":   code,
+		"response_body":   body,
+	}
+
+	switch {
+	case err == nil:
+		updates["status"] = models.WebhookDeliverySucceeded
+		updates["error"] = ""
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+	case delivery.Attempts+1 >= maxWebhookAttempts || !active:
+		updates["status"] = models.WebhookDeliveryFailed
+		updates["error"] = err.Error()
+		updates["next_attempt_at"] = nil
+	default:
+		updates["error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(webhookBackoff(delivery.Attempts + 1))
+	}
+	return updates
+}
+
+// RetryWebhookDeliveries retries pending deliveries that are due. They are
+// leased under a SKIP LOCKED row lock first so replicas never send the same
+// attempt twice.
+func RetryWebhookDeliveries() error {
+	var due []models.WebhookDelivery
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+			Order("next_attempt_at asc").
+			Limit(50).
+			Find(&due).Error; err != nil {
+			return err
+		}
+
+		if len(due) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(due))
+		for i, delivery := range due {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(webhookAttemptLease)).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range due {
+		var endpoint models.WebhookEndpoint
+		if err := database.DB.First(&endpoint, delivery.EndpointID).Error; err != nil {
+			continue
+		}
+		attemptWebhookDelivery(endpoint, delivery)
+	}
+	return nil
+}
+
+// RedeliverWebhook sends a past delivery's payload again as a new delivery,
+// leaving the original in the log.
+func RedeliverWebhook(userID, endpointID, deliveryID uint) (*models.WebhookDelivery, error) {
+	endpoint, err := findWebhookEndpoint(userID, endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	var original models.WebhookDelivery
+	if err := database.DB.Where("id = ? AND endpoint_id = ?", deliveryID, endpoint.ID).First(&original).Error; err != nil {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+
+	delivery, err := queueWebhookDelivery(*endpoint, original.EventType, original.Payload, &original.ID)
+	if err != nil {
+		return nil, err
+	}
+	return attemptWebhookDelivery(*endpoint, *delivery), nil
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"crypto-app-api/models"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the requests made to it and answers each with the
+// next of statuses, repeating the last one.
+type webhookReceiver struct {
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+
+	status := r.statuses[len(r.statuses)-1]
+	if len(r.requests) <= len(r.statuses) {
+		status = r.statuses[len(r.requests)-1]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, http.StatusText(status))
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) (*webhookReceiver, models.WebhookEndpoint, WebhookSender) {
+	t.Helper()
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	endpoint := models.WebhookEndpoint{ID: 3, UserID: 7, URL: server.URL, Secret: "whsec_test", Active: true}
+	return receiver, endpoint, WebhookSender{Client: server.Client()}
+}
+
+// verifySignature checks a request's signature header the way a receiver
+// would.
+func verifySignature(t *testing.T, req *http.Request, body, secret string) {
+	t.Helper()
+	timestamp, err := strconv.ParseInt(req.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header %q", req.Header.Get("X-Webhook-Timestamp"))
+	}
+	want := "sha256=" + SignWebhookPayload(secret, timestamp, []byte(body))
+	if got := req.Header.Get("X-Webhook-Signature"); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookSendSignsPayload(t *testing.T) {
+	receiver, endpoint, sender := newWebhookReceiver(t, http.StatusOK)
+	delivery := newWebhookDelivery(endpoint, "trade.executed", `{"id":1}`, nil, time.Now())
+	delivery.ID = 42
+
+	code, body, err := sender.Send(endpoint, delivery)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if code != http.StatusOK || body != "OK" {
+		t.Errorf("Send() = %d %q, want 200 \"OK\"", code, body)
+	}
+
+	if len(receiver.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(receiver.requests))
+	}
+	req := receiver.requests[0]
+	if receiver.bodies[0] != `{"id":1}` {
+		t.Errorf("body = %q", receiver.bodies[0])
+	}
+	for header, want := range map[string]string{
+		"Content-Type":       "application/json",
+		"X-Webhook-Event":    "trade.executed",
+		"X-Webhook-Delivery": "42",
+	} {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	verifySignature(t, req, receiver.bodies[0], endpoint.Secret)
+
+	// A different secret must not verify
+	timestamp, _ := strconv.ParseInt(req.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if req.Header.Get("X-Webhook-Signature") == "sha256="+SignWebhookPayload("whsec_other", timestamp, []byte(receiver.bodies[0])) {
+		t.Error("signature verified with the wrong secret")
+	}
+}
+
+func TestWebhookSendServerError(t *testing.T) {
+	_, endpoint, sender := newWebhookReceiver(t, http.StatusServiceUnavailable)
+
+	code, body, err := sender.Send(endpoint, newWebhookDelivery(endpoint, "trade.executed", "{}", nil, time.Now()))
+	if err == nil {
+		t.Fatal("Send() error = nil for a 503")
+	}
+	if code != http.StatusServiceUnavailable || body != "Service Unavailable" {
+		t.Errorf("Send() = %d %q, want the 503 and its body for the log", code, body)
+	}
+}
+
+func TestWebhookSendTruncatesResponseLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 3*maxWebhookResponseLog))
+	}))
+	defer server.Close()
+	endpoint := models.WebhookEndpoint{URL: server.URL, Secret: "whsec_test", Active: true}
+
+	_, body, err := WebhookSender{Client: server.Client()}.Send(endpoint, models.WebhookDelivery{Payload: "{}"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(body) != maxWebhookResponseLog {
+		t.Errorf("logged %d bytes of the response, want %d", len(body), maxWebhookResponseLog)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// TestWebhookRetriesWithBackoff drives a delivery through two 5xx responses
+// and a success the way the retry job does, applying each attempt's log
+// updates before the next.
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	receiver, endpoint, sender := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	delivery := newWebhookDelivery(endpoint, "trade.executed", `{"id":1}`, nil, now)
+	delivery.ID = 9
+
+	wantCodes := []int{500, 502, 200}
+	wantWaits := []time.Duration{30 * time.Second, time.Minute}
+	for attempt, wantCode := range wantCodes {
+		code, body, err := sender.Send(endpoint, delivery)
+		updates := webhookAttemptUpdates(delivery, endpoint.Active, code, body, err, now)
+
+		if updates["response_code"] != wantCode {
+			t.Errorf("attempt %d: response_code = %v, want %d", attempt+1, updates["response_code"], wantCode)
+		}
+		if updates["attempts"] != attempt+1 {
+			t.Errorf("attempt %d: attempts = %v", attempt+1, updates["attempts"])
+		}
+		if attempt < len(wantWaits) {
+			if _, ok := updates["status"]; ok {
+				t.Errorf("attempt %d: status = %v, want it left pending", attempt+1, updates["status"])
+			}
+			next, ok := updates["next_attempt_at"].(time.Time)
+			if !ok || next.Sub(now) != wantWaits[attempt] {
+				t.Errorf("attempt %d: next_attempt_at = %v, want %s later", attempt+1, updates["next_attempt_at"], wantWaits[attempt])
+			}
+			delivery.Attempts++
+			now = next
+			continue
+		}
+		if updates["status"] != models.WebhookDeliverySucceeded || updates["delivered_at"] != now || updates["next_attempt_at"] != nil {
+			t.Errorf("final attempt: updates = %v, want succeeded at %s", updates, now)
+		}
+	}
+
+	if len(receiver.requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(receiver.requests))
+	}
+	for i, req := range receiver.requests {
+		if req.Header.Get("X-Webhook-Delivery") != "9" {
+			t.Errorf("retry %d sent delivery %q, want the same delivery 9", i, req.Header.Get("X-Webhook-Delivery"))
+		}
+		verifySignature(t, req, receiver.bodies[i], endpoint.Secret)
+	}
+}
+
+func TestWebhookAttemptUpdatesGivesUp(t *testing.T) {
+	_, endpoint, sender := newWebhookReceiver(t, http.StatusInternalServerError)
+	now := time.Now()
+
+	delivery := newWebhookDelivery(endpoint, "trade.executed", "{}", nil, now)
+	delivery.Attempts = maxWebhookAttempts - 1
+	code, body, err := sender.Send(endpoint, delivery)
+	updates := webhookAttemptUpdates(delivery, true, code, body, err, now)
+	if updates["status"] != models.WebhookDeliveryFailed || updates["next_attempt_at"] != nil {
+		t.Errorf("last attempt: updates = %v, want failed with no retry", updates)
+	}
+	if updates["response_code"] != http.StatusInternalServerError || updates["error"] == "" {
+		t.Errorf("last attempt: updates = %v, want the 500 and error logged", updates)
+	}
+
+	// Disabled endpoints are not retried
+	updates = webhookAttemptUpdates(models.WebhookDelivery{}, false, 0, "", errors.New("endpoint is disabled"), now)
+	if updates["status"] != models.WebhookDeliveryFailed {
+		t.Errorf("disabled endpoint: status = %v, want failed", updates["status"])
+	}
+}
+
+// TestWebhookRedelivery sends a failed delivery's payload again as a new
+// delivery, like RedeliverWebhook does.
+func TestWebhookRedelivery(t *testing.T) {
+	receiver, endpoint, sender := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusOK)
+	now := time.Now()
+
+	original := newWebhookDelivery(endpoint, "balance.changed", `{"amount":10}`, nil, now)
+	original.ID = 11
+	code, body, err := sender.Send(endpoint, original)
+	if updates := webhookAttemptUpdates(original, true, code, body, err, now); updates["response_code"] != http.StatusInternalServerError {
+		t.Fatalf("original: response_code = %v, want 500", updates["response_code"])
+	}
+
+	redelivery := newWebhookDelivery(endpoint, original.EventType, original.Payload, &original.ID, now)
+	redelivery.ID = 12
+	if redelivery.RedeliveryOf == nil || *redelivery.RedeliveryOf != original.ID {
+		t.Errorf("RedeliveryOf = %v, want %d", redelivery.RedeliveryOf, original.ID)
+	}
+	if redelivery.Status != models.WebhookDeliveryPending || redelivery.Attempts != 0 {
+		t.Errorf("redelivery = %+v, want a fresh pending delivery", redelivery)
+	}
+
+	code, body, err = sender.Send(endpoint, redelivery)
+	updates := webhookAttemptUpdates(redelivery, true, code, body, err, now)
+	if updates["status"] != models.WebhookDeliverySucceeded || updates["response_code"] != http.StatusOK {
+		t.Errorf("redelivery: updates = %v, want succeeded with 200", updates)
+	}
+
+	if len(receiver.requests) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(receiver.requests))
+	}
+	if receiver.bodies[1] != receiver.bodies[0] || receiver.requests[1].Header.Get("X-Webhook-Event") != "balance.changed" {
+		t.Errorf("redelivery sent %q, want the original payload %q", receiver.bodies[1], receiver.bodies[0])
+	}
+	if got := receiver.requests[1].Header.Get("X-Webhook-Delivery"); got != "12" {
+		t.Errorf("redelivery X-Webhook-Delivery = %q, want 12", got)
+	}
+	verifySignature(t, receiver.requests[1], receiver.bodies[1], endpoint.Secret)
+}
+
+func TestWebhookEndpointAddress(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://93.184.216.34/hooks", nil},
+		{"http://[2606:2800:220:1:248:1893:25c8:1946]:8080/hooks", nil},
+		{"ftp://93.184.216.34/hooks", ErrInvalidWebhookEndpoint},
+		{"https:///hooks", ErrInvalidWebhookEndpoint},
+		{"http://127.0.0.1:8080/hooks", ErrWebhookAddressBlocked},
+		{"http://localhost/hooks", ErrWebhookAddressBlocked},
+		{"http://[::1]/hooks", ErrWebhookAddressBlocked},
+		{"http://169.254.169.254/latest/meta-data", ErrWebhookAddressBlocked},
+		{"http://10.0.0.5/hooks", ErrWebhookAddressBlocked},
+		{"http://172.16.3.4/hooks", ErrWebhookAddressBlocked},
+		{"http://192.168.1.10/hooks", ErrWebhookAddressBlocked},
+		{"http://[fd00::1]/hooks", ErrWebhookAddressBlocked},
+		{"http://[fe80::1]/hooks", ErrWebhookAddressBlocked},
+		{"http://0.0.0.0/hooks", ErrWebhookAddressBlocked},
+		{"http://224.0.0.1/hooks", ErrWebhookAddressBlocked},
+		{"http://[::ffff:127.0.0.1]/hooks", ErrWebhookAddressBlocked},
+	}
+	for _, tt := range tests {
+		var endpoint models.WebhookEndpoint
+		err := applyWebhookEndpoint(&endpoint, models.WebhookEndpointRequest{URL: tt.url})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("applyWebhookEndpoint(%q) error = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+// TestWebhookClientRefusesInternalAddresses sends to a receiver on loopback
+// through the production client, as a hostname rebound to it after the
+// endpoint was saved would.
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	receiver, endpoint, _ := newWebhookReceiver(t, http.StatusOK)
+
+	code, _, err := WebhookSender{Client: newWebhookClient()}.Send(endpoint, newWebhookDelivery(endpoint, "trade.executed", "{}", nil, time.Now()))
+	if !errors.Is(err, ErrWebhookAddressBlocked) || code != 0 {
+		t.Errorf("Send() = %d, %v, want it refused with ErrWebhookAddressBlocked", code, err)
+	}
+	if len(receiver.requests) != 0 {
+		t.Errorf("receiver got %d requests, want none", len(receiver.requests))
+	}
+}
@@ -0,0 +1,250 @@
+// Package strategies defines trading strategies that can be replayed over
+// price history by the backtester.
+//
+// A strategy sees the bars up to and including the one that just closed and
+// the simulated position, and answers with an order to fill at the open of
+// the next bar, or nil to hold.
+package strategies
+
+import (
+	"crypto-app-api/indicators"
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	Buy  = "buy"
+	Sell = "sell"
+)
+
+var (
+	ErrUnknownStrategy = errors.New("Strategy must be one of sma_crossover, rsi_mean_reversion or dca")
+	ErrInvalidParams   = errors.New("Invalid strategy parameters")
+)
+
+// Bar is one candle of history. Index numbers bars from the first one of the
+// run, so bars fetched before it for warmup have negative indexes.
+type Bar struct {
+	Index  int
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+// Position is the simulated account, in BaseCurrency and coin units.
+type Position struct {
+	Cash         float64
+	Quantity     float64
+	AveragePrice float64
+}
+
+// Order asks for a buy spending Amount of cash or a sell of Quantity coins.
+// Zero means all the cash or the whole position.
+type Order struct {
+	Side     string
+	Amount   float64
+	Quantity float64
+}
+
+// Strategy decides what to trade after each bar closes.
+type Strategy interface {
+	// Warmup is how many bars must have closed before Next is first called.
+	Warmup() int
+	// Next is called with every bar closed so far, oldest first.
+	Next(history []Bar, position Position) *Order
+}
+
+// Params are a strategy's numeric settings by name.
+type Params map[string]float64
+
+type definition struct {
+	defaults Params
+	build    func(Params) (Strategy, error)
+}
+
+var definitions = map[string]definition{
+	"sma_crossover": {
+		defaults: Params{"fast": 10, "slow": 30},
+		build:    newSMACrossover,
+	},
+	"rsi_mean_reversion": {
+		defaults: Params{"period": 14, "oversold": 30, "overbought": 70},
+		build:    newRSIMeanReversion,
+	},
+	"dca": {
+		defaults: Params{"amount": 100, "every": 24},
+		build:    newDCA,
+	},
+}
+
+// Names lists the available strategies.
+func Names() []string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New builds the named strategy. Params not given take their defaults; the
+// returned params are the ones actually used.
+func New(name string, params Params) (Strategy, Params, error) {
+	definition, ok := definitions[name]
+	if !ok {
+		return nil, nil, ErrUnknownStrategy
+	}
+
+	resolved := make(Params, len(definition.defaults))
+	for key, value := range definition.defaults {
+		resolved[key] = value
+	}
+	for key, value := range params {
+		if _, ok := definition.defaults[key]; !ok {
+			return nil, nil, ErrInvalidParams
+		}
+		resolved[key] = value
+	}
+
+	strategy, err := definition.build(resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+	return strategy, resolved, nil
+}
+
+// period reads a whole, positive bar count.
+func (p Params) period(key string) (int, error) {
+	value := p[key]
+	if value < 1 || value != float64(int(value)) {
+		return 0, ErrInvalidParams
+	}
+	return int(value), nil
+}
+
+func closes(bars []Bar) []float64 {
+	values := make([]float64, len(bars))
+	for i, bar := range bars {
+		values[i] = bar.Close
+	}
+	return values
+}
+
+// smaCrossover buys with all its cash when the fast moving average crosses
+// above the slow one and sells everything when it crosses back below.
+type smaCrossover struct {
+	fast, slow int
+}
+
+func newSMACrossover(params Params) (Strategy, error) {
+	fast, err := params.period("fast")
+	if err != nil {
+		return nil, err
+	}
+	slow, err := params.period("slow")
+	if err != nil || fast >= slow {
+		return nil, ErrInvalidParams
+	}
+	return &smaCrossover{fast: fast, slow: slow}, nil
+}
+
+func (s *smaCrossover) Warmup() int {
+	return s.slow + 1
+}
+
+func (s *smaCrossover) Next(history []Bar, position Position) *Order {
+	values := closes(history[len(history)-s.slow-1:])
+	fast, err := indicators.SMA(values, s.fast)
+	if err != nil {
+		return nil
+	}
+	slow, err := indicators.SMA(values, s.slow)
+	if err != nil {
+		return nil
+	}
+
+	// Both series end at the latest bar; compare it with the one before
+	fastNow, fastBefore := fast[len(fast)-1], fast[len(fast)-2]
+	slowNow, slowBefore := slow[1], slow[0]
+	switch {
+	case fastBefore <= slowBefore && fastNow > slowNow && position.Quantity == 0:
+		return &Order{Side: Buy}
+	case fastBefore >= slowBefore && fastNow < slowNow && position.Quantity > 0:
+		return &Order{Side: Sell}
+	}
+	return nil
+}
+
+// rsiMeanReversion buys with all its cash when RSI drops below oversold and
+// sells everything once it rises above overbought.
+type rsiMeanReversion struct {
+	period               int
+	oversold, overbought float64
+}
+
+func newRSIMeanReversion(params Params) (Strategy, error) {
+	period, err := params.period("period")
+	if err != nil {
+		return nil, err
+	}
+	oversold, overbought := params["oversold"], params["overbought"]
+	if oversold <= 0 || overbought >= 100 || oversold >= overbought {
+		return nil, ErrInvalidParams
+	}
+	return &rsiMeanReversion{period: period, oversold: oversold, overbought: overbought}, nil
+}
+
+// Wilder smoothing depends on every earlier point, so RSI is computed over
+// several periods of history for it to settle.
+func (s *rsiMeanReversion) Warmup() int {
+	return s.period * 5
+}
+
+func (s *rsiMeanReversion) Next(history []Bar, position Position) *Order {
+	rsi, err := indicators.RSI(closes(history[len(history)-s.Warmup():]), s.period)
+	if err != nil {
+		return nil
+	}
+
+	latest := rsi[len(rsi)-1]
+	switch {
+	case latest < s.oversold && position.Quantity == 0:
+		return &Order{Side: Buy}
+	case latest > s.overbought && position.Quantity > 0:
+		return &Order{Side: Sell}
+	}
+	return nil
+}
+
+// dca buys a fixed amount every so many bars and never sells.
+type dca struct {
+	amount float64
+	every  int
+}
+
+func newDCA(params Params) (Strategy, error) {
+	every, err := params.period("every")
+	if err != nil {
+		return nil, err
+	}
+	if params["amount"] <= 0 {
+		return nil, ErrInvalidParams
+	}
+	return &dca{amount: params["amount"], every: every}, nil
+}
+
+func (s *dca) Warmup() int {
+	return 1
+}
+
+func (s *dca) Next(history []Bar, position Position) *Order {
+	index := history[len(history)-1].Index
+	if index < 0 || index%s.every != 0 || position.Cash <= 0 {
+		return nil
+	}
+	return &Order{Side: Buy, Amount: s.amount}
+}
@@ -0,0 +1,162 @@
+package strategies
+
+import (
+	"errors"
+	"testing"
+)
+
+func closingBars(closes ...float64) []Bar {
+	bars := make([]Bar, len(closes))
+	for i, value := range closes {
+		bars[i] = Bar{Index: i, Open: value, Close: value}
+	}
+	return bars
+}
+
+func mustNew(t *testing.T, name string, params Params) Strategy {
+	t.Helper()
+	strategy, _, err := New(name, params)
+	if err != nil {
+		t.Fatalf("New(%q, %v) error = %v", name, params, err)
+	}
+	return strategy
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  Params
+		want    Params
+		wantErr error
+	}{
+		{name: "sma_crossover", want: Params{"fast": 10, "slow": 30}},
+		{name: "sma_crossover", params: Params{"fast": 5}, want: Params{"fast": 5, "slow": 30}},
+		{name: "sma_crossover", params: Params{"fast": 30}, wantErr: ErrInvalidParams},
+		{name: "sma_crossover", params: Params{"fast": 2.5}, wantErr: ErrInvalidParams},
+		{name: "sma_crossover", params: Params{"period": 5}, wantErr: ErrInvalidParams},
+		{name: "rsi_mean_reversion", want: Params{"period": 14, "oversold": 30, "overbought": 70}},
+		{name: "rsi_mean_reversion", params: Params{"oversold": 80}, wantErr: ErrInvalidParams},
+		{name: "rsi_mean_reversion", params: Params{"overbought": 100}, wantErr: ErrInvalidParams},
+		{name: "rsi_mean_reversion", params: Params{"period": 0}, wantErr: ErrInvalidParams},
+		{name: "dca", params: Params{"amount": 50}, want: Params{"amount": 50, "every": 24}},
+		{name: "dca", params: Params{"amount": 0}, wantErr: ErrInvalidParams},
+		{name: "dca", params: Params{"every": -1}, wantErr: ErrInvalidParams},
+		{name: "grid", wantErr: ErrUnknownStrategy},
+	}
+	for _, tt := range tests {
+		_, params, err := New(tt.name, tt.params)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("New(%q, %v) error = %v, want %v", tt.name, tt.params, err, tt.wantErr)
+			continue
+		}
+		if len(params) != len(tt.want) {
+			t.Errorf("New(%q, %v) params = %v, want %v", tt.name, tt.params, params, tt.want)
+			continue
+		}
+		for key, value := range tt.want {
+			if params[key] != value {
+				t.Errorf("New(%q, %v) params = %v, want %v", tt.name, tt.params, params, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSMACrossover(t *testing.T) {
+	strategy := mustNew(t, "sma_crossover", Params{"fast": 2, "slow": 3})
+	if strategy.Warmup() != 4 {
+		t.Errorf("Warmup() = %d, want 4", strategy.Warmup())
+	}
+
+	flat := Position{Cash: 1000}
+	holding := Position{Quantity: 1, AveragePrice: 10}
+	tests := []struct {
+		name     string
+		history  []Bar
+		position Position
+		want     *Order
+	}{
+		// fast 10 -> 11.5 crosses above slow 10 -> 11
+		{"crosses above", closingBars(10, 10, 10, 13), flat, &Order{Side: Buy}},
+		{"crosses above while holding", closingBars(10, 10, 10, 13), holding, nil},
+		// fast 10 -> 8.5 crosses below slow 10 -> 9
+		{"crosses below", closingBars(10, 10, 10, 7), holding, &Order{Side: Sell}},
+		{"crosses below while flat", closingBars(10, 10, 10, 7), flat, nil},
+		// fast stays above slow
+		{"already above", closingBars(10, 11, 12, 13), flat, nil},
+		// Only the latest slow+1 bars count
+		{"older bars ignored", closingBars(50, 1, 10, 10, 10, 13), flat, &Order{Side: Buy}},
+	}
+	for _, tt := range tests {
+		if got := strategy.Next(tt.history, tt.position); !sameOrder(got, tt.want) {
+			t.Errorf("%s: Next() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRSIMeanReversion(t *testing.T) {
+	strategy := mustNew(t, "rsi_mean_reversion", Params{"period": 2, "oversold": 30, "overbought": 70})
+	if strategy.Warmup() != 10 {
+		t.Errorf("Warmup() = %d, want 10", strategy.Warmup())
+	}
+
+	falling := closingBars(20, 19, 18, 17, 16, 15, 14, 13, 12, 11)
+	rising := closingBars(11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	// Ends on a bounce that leaves RSI between the bands
+	choppy := closingBars(10, 12, 10, 12, 10, 12, 10, 12, 10, 11)
+	flat := Position{Cash: 1000}
+	holding := Position{Quantity: 1, AveragePrice: 15}
+	tests := []struct {
+		name     string
+		history  []Bar
+		position Position
+		want     *Order
+	}{
+		{"oversold", falling, flat, &Order{Side: Buy}},
+		{"oversold while holding", falling, holding, nil},
+		{"overbought", rising, holding, &Order{Side: Sell}},
+		{"overbought while flat", rising, flat, nil},
+		{"in between", choppy, flat, nil},
+		{"in between while holding", choppy, holding, nil},
+	}
+	for _, tt := range tests {
+		if got := strategy.Next(tt.history, tt.position); !sameOrder(got, tt.want) {
+			t.Errorf("%s: Next() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDCA(t *testing.T) {
+	strategy := mustNew(t, "dca", Params{"amount": 50, "every": 3})
+	if strategy.Warmup() != 1 {
+		t.Errorf("Warmup() = %d, want 1", strategy.Warmup())
+	}
+
+	tests := []struct {
+		index int
+		cash  float64
+		want  *Order
+	}{
+		{0, 1000, &Order{Side: Buy, Amount: 50}},
+		{1, 1000, nil},
+		{2, 1000, nil},
+		{3, 1000, &Order{Side: Buy, Amount: 50}},
+		{6, 20, &Order{Side: Buy, Amount: 50}},
+		{9, 0, nil},
+		// Warmup bars from before the run never buy
+		{-3, 1000, nil},
+	}
+	for _, tt := range tests {
+		history := []Bar{{Index: tt.index - 1}, {Index: tt.index}}
+		if got := strategy.Next(history, Position{Cash: tt.cash}); !sameOrder(got, tt.want) {
+			t.Errorf("bar %d with %v cash: Next() = %+v, want %+v", tt.index, tt.cash, got, tt.want)
+		}
+	}
+}
+
+func sameOrder(got, want *Order) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return *got == *want
+}
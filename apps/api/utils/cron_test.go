@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Monday
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"*/15 * * * *", []string{"2024-01-01 12:15", "2024-01-01 12:30", "2024-01-01 12:45"}},
+		{"0 9 * * *", []string{"2024-01-02 09:00", "2024-01-03 09:00", "2024-01-04 09:00"}},
+		{"0 9 * * 1", []string{"2024-01-08 09:00", "2024-01-15 09:00", "2024-01-22 09:00"}},
+		{"0 0 1,15 * *", []string{"2024-01-15 00:00", "2024-02-01 00:00", "2024-02-15 00:00"}},
+		// Both day fields restricted: either may match
+		{"0 9 13 * 1", []string{"2024-01-08 09:00", "2024-01-13 09:00", "2024-01-15 09:00"}},
+		// A step from "*" is still unrestricted, so both day fields must match:
+		// odd days of the month that are Mondays
+		{"0 9 */2 * 1", []string{"2024-01-15 09:00", "2024-01-29 09:00", "2024-02-05 09:00"}},
+		{"0 9 13 * */2", []string{"2024-01-13 09:00", "2024-02-13 09:00", "2024-04-13 09:00"}},
+		{"30 8 * 2 1-5", []string{"2024-02-01 08:30", "2024-02-02 08:30", "2024-02-05 08:30"}},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) error = %v", tt.expr, err)
+			continue
+		}
+		at := from
+		for i, want := range tt.want {
+			at = schedule.Next(at)
+			if got := at.Format("2006-01-02 15:04"); got != want {
+				t.Errorf("%q run %d = %s, want %s", tt.expr, i+1, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestCronNextNeverMatches(t *testing.T) {
+	schedule, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("ParseCron() error = %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next() = %s, want the zero time", next)
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 7", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err != ErrInvalidCron {
+			t.Errorf("ParseCron(%q) error = %v, want ErrInvalidCron", expr, err)
+		}
+	}
+}
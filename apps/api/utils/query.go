@@ -0,0 +1,364 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QueryError reports a list query parameter that could not be used.
+type QueryError struct {
+	Param string
+}
+
+func (e *QueryError) Error() string {
+	return "Invalid query parameter: " + e.Param
+}
+
+// Pagination is the page/limit pair of a list request.
+type Pagination struct {
+	Page  int
+	Limit int
+}
+
+// ParsePagination reads ?page= and ?limit=. Missing or out-of-range values
+// fall back to page 1 and defaultLimit rather than failing the request.
+func ParsePagination(c *fiber.Ctx, defaultLimit, maxLimit int) Pagination {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultLimit)))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	return Pagination{Page: page, Limit: limit}
+}
+
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Meta is the pagination block returned alongside a page of results.
+func (p Pagination) Meta(total int64) fiber.Map {
+	return fiber.Map{
+		"page":  p.Page,
+		"limit": p.Limit,
+		"total": total,
+		"pages": (total + int64(p.Limit) - 1) / int64(p.Limit),
+	}
+}
+
+// Cursor is the sort key and ID of the last row of a page. Lists ordered by
+// a key and then ID continue after it, so rows inserted or removed meanwhile
+// neither shift nor repeat later pages the way offsets do.
+type Cursor struct {
+	Time   *time.Time `json:"t,omitempty"`
+	Number *float64   `json:"n,omitempty"`
+	ID     uint       `json:"id"`
+}
+
+// NewCursor encodes the position after a row whose sort key is a time.Time
+// or float64.
+func NewCursor(key interface{}, id uint) string {
+	cursor := Cursor{ID: id}
+	switch value := key.(type) {
+	case time.Time:
+		cursor.Time = &value
+	case float64:
+		cursor.Number = &value
+	case int:
+		number := float64(value)
+		cursor.Number = &number
+	}
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// ParseCursor reads ?cursor=, returning nil when it is missing.
+func ParseCursor(c *fiber.Ctx) (*Cursor, error) {
+	raw := c.Query("cursor")
+	if raw == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, &QueryError{Param: "cursor"}
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil || (cursor.Time == nil) == (cursor.Number == nil) {
+		return nil, &QueryError{Param: "cursor"}
+	}
+	return &cursor, nil
+}
+
+func (c *Cursor) key() interface{} {
+	if c.Time != nil {
+		return *c.Time
+	}
+	return *c.Number
+}
+
+// KeysetPage orders query by key and then id, both descending when desc, and
+// starts the page after cursor when there is one or at the pagination
+// offset otherwise. key and id are SQL expressions chosen by the caller,
+// never user input. One row more than the limit is fetched so TrimPage can
+// tell whether another page follows.
+func KeysetPage(query *gorm.DB, pagination Pagination, cursor *Cursor, key, id string, desc bool) *gorm.DB {
+	direction, comparison := "asc", ">"
+	if desc {
+		direction, comparison = "desc", "<"
+	}
+	if cursor != nil {
+		query = query.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", key, id, comparison), cursor.key(), cursor.ID)
+	} else {
+		query = query.Offset(pagination.Offset())
+	}
+	return query.Order(fmt.Sprintf("%s %s, %s %s", key, direction, id, direction)).Limit(pagination.Limit + 1)
+}
+
+// TrimPage drops the extra row fetched by KeysetPage, reporting whether
+// there was one.
+func TrimPage[T any](rows []T, pagination Pagination) ([]T, bool) {
+	if len(rows) > pagination.Limit {
+		return rows[:pagination.Limit], true
+	}
+	return rows, false
+}
+
+// KeysetMeta is the pagination block of a KeysetPage. next is the cursor of
+// the following page, or "" on the last one. Offset fields are only included
+// when the page was not fetched by cursor.
+func KeysetMeta(pagination Pagination, cursor *Cursor, total int64, next string) fiber.Map {
+	meta := fiber.Map{"limit": pagination.Limit, "total": total}
+	if cursor == nil {
+		meta = pagination.Meta(total)
+	}
+	meta["next_cursor"] = nil
+	if next != "" {
+		meta["next_cursor"] = next
+	}
+	return meta
+}
+
+// Aggregates evaluates named aggregate SQL expressions, such as
+// "SUM(total_amount)", over the rows matched by query, which should not be
+// paginated yet. Empty sets aggregate to 0. Expressions come from the
+// caller, never user input.
+func Aggregates(query *gorm.DB, expressions map[string]string) (map[string]float64, error) {
+	names := make([]string, 0, len(expressions))
+	for name := range expressions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	selects := make([]string, len(names))
+	for i, name := range names {
+		selects[i] = fmt.Sprintf("COALESCE(%s, 0)::float8 AS %s", expressions[name], name)
+	}
+
+	row := make(map[string]interface{}, len(names))
+	if err := query.Session(&gorm.Session{}).Select(strings.Join(selects, ", ")).Scan(&row).Error; err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]float64, len(names))
+	for _, name := range names {
+		totals[name], _ = row[name].(float64)
+	}
+	return totals, nil
+}
+
+// ParseSort reads ?sort= and ?order= against a whitelist mapping accepted sort
+// names to columns, so user input never reaches the ORDER BY clause directly.
+func ParseSort(c *fiber.Ctx, fields map[string]string, defaultSort, defaultOrder string) (clause.OrderByColumn, error) {
+	column, ok := fields[c.Query("sort", defaultSort)]
+	if !ok {
+		return clause.OrderByColumn{}, &QueryError{Param: "sort"}
+	}
+
+	order := strings.ToLower(c.Query("order", defaultOrder))
+	if order != "asc" && order != "desc" {
+		return clause.OrderByColumn{}, &QueryError{Param: "order"}
+	}
+
+	return clause.OrderByColumn{
+		Column: clause.Column{Name: column},
+		Desc:   order == "desc",
+	}, nil
+}
+
+// ParseFloatRange reads the optional <key>_min and <key>_max bounds.
+func ParseFloatRange(c *fiber.Ctx, key string) (min, max *float64, err error) {
+	if min, err = parseOptionalFloat(c, key+"_min"); err != nil {
+		return nil, nil, err
+	}
+	if max, err = parseOptionalFloat(c, key+"_max"); err != nil {
+		return nil, nil, err
+	}
+	if min != nil && max != nil && *min > *max {
+		return nil, nil, &QueryError{Param: key + "_min"}
+	}
+	return min, max, nil
+}
+
+// FilterFloatRange narrows query to rows whose column, an SQL expression
+// chosen by the caller, lies within the <key>_min and <key>_max bounds.
+func FilterFloatRange(c *fiber.Ctx, query *gorm.DB, key, column string) (*gorm.DB, error) {
+	min, max, err := ParseFloatRange(c, key)
+	if err != nil {
+		return nil, err
+	}
+	if min != nil {
+		query = query.Where(column+" >= ?", *min)
+	}
+	if max != nil {
+		query = query.Where(column+" <= ?", *max)
+	}
+	return query, nil
+}
+
+func parseOptionalFloat(c *fiber.Ctx, param string) (*float64, error) {
+	raw := c.Query(param)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, &QueryError{Param: param}
+	}
+	return &value, nil
+}
+
+// ParseInt reads an optional integer parameter, returning fallback when it
+// is missing.
+func ParseInt(c *fiber.Ctx, param string, fallback int) (int, error) {
+	raw := c.Query(param)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, &QueryError{Param: param}
+	}
+	return value, nil
+}
+
+// ParseFloat reads an optional float parameter, returning fallback when it
+// is missing.
+func ParseFloat(c *fiber.Ctx, param string, fallback float64) (float64, error) {
+	value, err := parseOptionalFloat(c, param)
+	if err != nil || value == nil {
+		return fallback, err
+	}
+	return *value, nil
+}
+
+// ParseTimeRange reads optional from and to bounds given as RFC 3339 times
+// or YYYY-MM-DD dates. A date-only upper bound covers that whole day; the
+// returned upper bound is exclusive.
+func ParseTimeRange(c *fiber.Ctx, fromParam, toParam string) (from, to *time.Time, err error) {
+	if from, _, err = parseOptionalTime(c, fromParam); err != nil {
+		return nil, nil, err
+	}
+	var dateOnly bool
+	if to, dateOnly, err = parseOptionalTime(c, toParam); err != nil {
+		return nil, nil, err
+	}
+	if to != nil && dateOnly {
+		end := to.AddDate(0, 0, 1)
+		to = &end
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, &QueryError{Param: fromParam}
+	}
+	return from, to, nil
+}
+
+// FilterTimeRange narrows query to rows whose column falls within the ?from=
+// and ?to= bounds read by ParseTimeRange.
+func FilterTimeRange(c *fiber.Ctx, query *gorm.DB, column string) (*gorm.DB, error) {
+	from, to, err := ParseTimeRange(c, "from", "to")
+	if err != nil {
+		return nil, err
+	}
+	if from != nil {
+		query = query.Where(column+" >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where(column+" < ?", *to)
+	}
+	return query, nil
+}
+
+func parseOptionalTime(c *fiber.Ctx, param string) (*time.Time, bool, error) {
+	raw := c.Query(param)
+	if raw == "" {
+		return nil, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return nil, false, &QueryError{Param: param}
+	}
+	return &t, true, nil
+}
+
+// ParseIDList reads a comma-separated list of IDs.
+func ParseIDList(c *fiber.Ctx, param string) ([]uint, error) {
+	var ids []uint
+	for _, item := range ParseList(c, param) {
+		id, err := strconv.ParseUint(item, 10, 32)
+		if err != nil {
+			return nil, &QueryError{Param: param}
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// ParseList reads a comma-separated parameter, dropping empty items.
+func ParseList(c *fiber.Ctx, param string) []string {
+	var items []string
+	for _, item := range strings.Split(c.Query(param), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// EscapeLike escapes LIKE wildcards so s is matched literally.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// PrefixTSQuery turns free text into a Postgres tsquery matching every word
+// as a prefix, e.g. "bit coin" becomes "bit:* & coin:*". Characters with
+// meaning in tsquery syntax are dropped. It returns "" when nothing is left.
+func PrefixTSQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		word = strings.Map(func(r rune) rune {
+			if r == '-' || r == '_' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || r > 127 {
+				return r
+			}
+			return -1
+		}, word)
+		if word != "" {
+			terms = append(terms, word+":*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
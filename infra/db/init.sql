@@ -20,6 +20,7 @@ CREATE TABLE IF NOT EXISTS coins (
     id SERIAL PRIMARY KEY,
     symbol VARCHAR(10) UNIQUE NOT NULL,
     name VARCHAR(100) NOT NULL,
+    category VARCHAR(50),
     current_price DECIMAL(20,8) NOT NULL,
     market_cap BIGINT,
     volume_24h BIGINT,
@@ -62,6 +63,15 @@ CREATE TABLE IF NOT EXISTS watchlists (
     UNIQUE(user_id, coin_id)
 );
 
+-- Create fx_rates table (units of currency per 1 USD)
+CREATE TABLE IF NOT EXISTS fx_rates (
+    id SERIAL PRIMARY KEY,
+    currency VARCHAR(3) UNIQUE NOT NULL,
+    rate DECIMAL(20,8) NOT NULL,
+    last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Create indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
@@ -72,22 +82,33 @@ CREATE INDEX IF NOT EXISTS idx_trades_created_at ON trades(created_at);
 CREATE INDEX IF NOT EXISTS idx_watchlists_user_id ON watchlists(user_id);
 
 -- Insert sample coins
-INSERT INTO coins (symbol, name, current_price, market_cap, volume_24h, price_change_24h, price_change_percentage_24h) 
+INSERT INTO coins (symbol, name, category, current_price, market_cap, volume_24h, price_change_24h, price_change_percentage_24h) 
 VALUES 
-    ('BTC', 'Bitcoin', 45000.00, 850000000000, 25000000000, 1200.50, 2.74),
-    ('ETH', 'Ethereum', 2800.00, 340000000000, 15000000000, -85.25, -2.95),
-    ('BNB', 'Binance Coin', 320.00, 52000000000, 1800000000, 15.75, 5.18),
-    ('ADA', 'Cardano', 0.45, 15000000000, 850000000, 0.02, 4.65),
-    ('DOT', 'Polkadot', 6.80, 8500000000, 420000000, -0.15, -2.16),
-    ('XRP', 'XRP', 0.58, 29000000000, 1200000000, 0.03, 5.45),
-    ('LINK', 'Chainlink', 14.50, 8200000000, 680000000, 0.85, 6.23),
-    ('LTC', 'Litecoin', 95.00, 7000000000, 2100000000, 2.50, 2.70),
-    ('SOL', 'Solana', 110.00, 48000000000, 1900000000, 5.20, 4.96),
-    ('MATIC', 'Polygon', 0.85, 8300000000, 450000000, 0.04, 4.92)
+    ('BTC', 'Bitcoin', 'currency', 45000.00, 850000000000, 25000000000, 1200.50, 2.74),
+    ('ETH', 'Ethereum', 'layer-1', 2800.00, 340000000000, 15000000000, -85.25, -2.95),
+    ('BNB', 'Binance Coin', 'exchange', 320.00, 52000000000, 1800000000, 15.75, 5.18),
+    ('ADA', 'Cardano', 'layer-1', 0.45, 15000000000, 850000000, 0.02, 4.65),
+    ('DOT', 'Polkadot', 'layer-1', 6.80, 8500000000, 420000000, -0.15, -2.16),
+    ('XRP', 'XRP', 'payments', 0.58, 29000000000, 1200000000, 0.03, 5.45),
+    ('LINK', 'Chainlink', 'oracle', 14.50, 8200000000, 680000000, 0.85, 6.23),
+    ('LTC', 'Litecoin', 'currency', 95.00, 7000000000, 2100000000, 2.50, 2.70),
+    ('SOL', 'Solana', 'layer-1', 110.00, 48000000000, 1900000000, 5.20, 4.96),
+    ('MATIC', 'Polygon', 'layer-2', 0.85, 8300000000, 450000000, 0.04, 4.92)
 ON CONFLICT (symbol) DO UPDATE SET
+    category = EXCLUDED.category,
     current_price = EXCLUDED.current_price,
     market_cap = EXCLUDED.market_cap,
     volume_24h = EXCLUDED.volume_24h,
     price_change_24h = EXCLUDED.price_change_24h,
     price_change_percentage_24h = EXCLUDED.price_change_percentage_24h,
     last_updated = CURRENT_TIMESTAMP;
+
+-- Insert sample FX rates
+INSERT INTO fx_rates (currency, rate)
+VALUES
+    ('EUR', 0.92),
+    ('VND', 24500.00),
+    ('GBP', 0.79)
+ON CONFLICT (currency) DO UPDATE SET
+    rate = EXCLUDED.rate,
+    last_updated = CURRENT_TIMESTAMP;